@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// attachType associates an alias with a database attached to another
+type attachType struct {
+	alias string
+	db    *DB
+}
+
+// Attach opens the pinion database at path and makes the record types stored
+// in it available through db. Each record type is served by exactly one file:
+// db itself if it contains records of the type, otherwise the first attached
+// database, in order of attachment, that does. Types that are found in none of
+// them are stored in db. This permits, for example, record types that are no
+// longer written to be archived in a separate file while still being read
+// through a single handle. Records of one type are not merged across files:
+// if several files hold the type, only the records of the file that serves it
+// are visible. If writable is false, the attached file is opened read-only
+// and attempts to modify its records fail. The attached database is opened
+// with only those options of db that concern storage and access, such as
+// BoltOpt, the batch sizes, the locking options, Clock and the scan limits;
+// its record types are not registered, so no lifecycle hooks, backfill or
+// open checks run, and derived records, Bloom filters and sketches are not
+// maintained for the types it serves. It is closed by Detach or Close.
+func (db *DB) Attach(alias, path string, writable bool) (err error) {
+	var adb *DB
+	if db.bolt() == nil {
+		return ErrNotOpen
+	}
+	if db.attachment(alias) != nil {
+		return fmt.Errorf("database alias \"%s\" is already attached", alias)
+	}
+	opt := Options{
+		BoltOpt:           db.opt.BoltOpt,
+		BatchSize:         db.opt.BatchSize,
+		BatchBytes:        db.opt.BatchBytes,
+		SmallFootprint:    db.opt.SmallFootprint,
+		OpenRetries:       db.opt.OpenRetries,
+		OpenRetryDelay:    db.opt.OpenRetryDelay,
+		LockFile:          db.opt.LockFile,
+		AllowNetworkFS:    db.opt.AllowNetworkFS,
+		Clock:             db.opt.Clock,
+		Rand:              db.opt.Rand,
+		MaxScanRecords:    db.opt.MaxScanRecords,
+		MaxScanBytes:      db.opt.MaxScanBytes,
+		ScanYieldRecords:  db.opt.ScanYieldRecords,
+		ScanYieldInterval: db.opt.ScanYieldInterval,
+	}
+	opt.BoltOpt.ReadOnly = !writable
+	adb, err = Open(path, 0600, opt)
+	if err == nil {
+		db.mu.Lock()
+		db.attached = append(db.attached[:len(db.attached):len(db.attached)], attachType{alias: alias, db: adb})
+		db.mu.Unlock()
+	}
+	return
+}
+
+// Detach closes the database attached to db with the specified alias.
+func (db *DB) Detach(alias string) (err error) {
+	var adb *DB
+	db.mu.Lock()
+	var list []attachType
+	for _, a := range db.attached {
+		if a.alias == alias {
+			adb = a.db
+		} else {
+			list = append(list, a)
+		}
+	}
+	db.attached = list
+	db.mu.Unlock()
+	if adb != nil {
+		err = adb.Close()
+	} else {
+		err = fmt.Errorf("no database is attached with alias \"%s\"", alias)
+	}
+	return
+}
+
+// attachment returns the database attached with the specified alias, or nil
+// if there is none.
+func (db *DB) attachment(alias string) *DB {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, a := range db.attached {
+		if a.alias == alias {
+			return a.db
+		}
+	}
+	return nil
+}
+
+// owner returns the database that serves the record type of recPtr. This is
+// db itself unless other databases are attached.
+func (db *DB) owner(recPtr Record) *DB {
+	return db.ownerName(recPtr.Name())
+}
+
+// ownerName functions like owner for the type named nameStr.
+func (db *DB) ownerName(nameStr string) (odb *DB) {
+	db.mu.RLock()
+	list := db.attached
+	db.mu.RUnlock()
+	odb = db
+	if len(list) > 0 {
+		var found bool
+		name := []byte(nameStr)
+		has := func(tx *bbolt.Tx) error {
+			found = tx.Bucket(name) != nil
+			return nil
+		}
+		db.view(has)
+		for j := 0; j < len(list) && !found; j++ {
+			list[j].db.view(has)
+			if found {
+				odb = list[j].db
+			}
+		}
+	}
+	return
+}
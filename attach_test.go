@@ -0,0 +1,83 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates access to records kept in a separate file.
+func ExampleDB_Attach() {
+	var db, old *pinion.DB
+	var err error
+	var count int
+	const oldStr = "example/attach_2016.db"
+	old, err = quantityDB(oldStr, 1, 5)
+	if err == nil {
+		old.Close()
+		db, err = pinion.Create("example/attach.db", 0600, pinion.Options{})
+		if err == nil {
+			err = db.AddRec(&personType{name: nameType{last: "Smith", first: "Ann"}})
+			if err == nil {
+				err = db.Attach("2016", oldStr, false)
+			}
+			if err == nil {
+				count, err = quantityCount(db)
+				fmt.Printf("%d quantities\n", count)
+			}
+			if err == nil {
+				q := quantityRec(6)
+				fmt.Println(db.PutRec(&q) != nil)
+				err = db.Detach("2016")
+			}
+			if err == nil {
+				var p personType
+				err = db.GetRec(&p, idxPersonID)
+				fmt.Println(p)
+			}
+			db.Close()
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 5 quantities
+	// true
+	// Ann  Smith / 1
+}
+
+// This example shows that the lifecycle hooks of the registered record types
+// run only for the database they are registered with, not for the files
+// attached to it.
+func ExampleDB_Attach_hooks() {
+	var db, old *pinion.DB
+	var err error
+	const oldStr = "example/attach_tracked.db"
+	old, err = pinion.Create(oldStr, 0600, pinion.Options{})
+	if err == nil {
+		rec := trackedQuantityType{quantityRec(3)}
+		err = old.PutRec(&rec)
+		old.Close()
+	}
+	if err == nil {
+		opt := pinion.Options{Records: []pinion.Record{&trackedQuantityType{}}}
+		db, err = pinion.Create("example/attach_hooks.db", 0600, opt)
+		if err == nil {
+			err = db.Attach("old", oldStr, false)
+			if err == nil {
+				var found bool
+				found, err = db.Exists(&trackedQuantityType{quantityRec(3)}, idxQuantityID)
+				fmt.Println("attached record 3 stored:", found)
+			}
+			db.Close()
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// open: record 3 stored: false
+	// attached record 3 stored: true
+	// close
+}
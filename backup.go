@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Backup writes a copy of the database to w and returns the number of bytes
+// written. The copy is made in a single read transaction, so it is consistent
+// even though records may be written while it is in progress, and it can be
+// opened like any other database file once saved. Since bbolt cannot reuse
+// pages freed while a read transaction is open, the database file may grow
+// if there are many writes during a backup to a slow destination. Only the
+// records of db itself are copied, not those of attached databases.
+func (db *DB) Backup(w io.Writer) (n int64, err error) {
+	err = db.view(func(tx *bbolt.Tx) (err error) {
+		n, err = tx.WriteTo(w)
+		return
+	})
+	return
+}
+
+// BackupInfo describes a backup made by a runner started with StartBackups.
+type BackupInfo struct {
+	Started  time.Time     // Time at which the backup began
+	Duration time.Duration // Time taken by the backup
+	Size     int64         // Bytes written
+	Err      error         // Reason the backup failed, or nil
+}
+
+// BackupRunner makes backups of a database at regular intervals. See
+// DB.StartBackups.
+type BackupRunner struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// aborter is implemented by a backup target that discards what has been
+// written when a backup fails, rather than keeping it as Close would
+type aborter interface {
+	abort()
+}
+
+// backupTo makes a backup to the writer obtained from target.
+func (db *DB) backupTo(target func() (io.WriteCloser, error)) (info BackupInfo) {
+	var w io.WriteCloser
+	info.Started = time.Now()
+	w, info.Err = target()
+	if info.Err == nil {
+		info.Size, info.Err = db.Backup(w)
+		if a, ok := w.(aborter); ok && info.Err != nil {
+			a.abort()
+		} else if err := w.Close(); info.Err == nil {
+			info.Err = err
+		}
+	}
+	info.Duration = time.Since(info.Started)
+	return
+}
+
+// StartBackups starts a goroutine that backs up the database, as Backup
+// does, every interval until the returned runner is stopped or the database
+// is closed. For each backup, target is called to obtain the writer to which
+// it is written; the writer is closed when the backup is complete. The
+// outcome of each backup is passed to Options.BackupHook. If that is nil,
+// failures are written with the standard logger. BackupFiles supplies a
+// target that writes files to a directory and retains a fixed number of
+// them.
+func (db *DB) StartBackups(interval time.Duration, target func() (io.WriteCloser, error)) *BackupRunner {
+	br := &BackupRunner{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(br.done)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-br.stop:
+				return
+			case <-tick.C:
+				info := db.backupTo(target)
+				if errors.Is(info.Err, ErrNotOpen) {
+					return
+				}
+				if db.opt.BackupHook != nil {
+					db.opt.BackupHook(info)
+				} else if info.Err != nil {
+					log.Printf("pinion: backup failed: %v", info.Err)
+				}
+			}
+		}
+	}()
+	return br
+}
+
+// Stop ends the backups made by br. A backup in progress is completed first.
+func (br *BackupRunner) Stop() {
+	br.once.Do(func() {
+		close(br.stop)
+	})
+	<-br.done
+}
+
+// backupFile is a backup target that is written under a temporary name and
+// renamed when complete
+type backupFile struct {
+	*os.File
+	path string // Final path
+	// rotate is called once the file has been renamed
+	rotate func() error
+}
+
+// Close implements the io.Closer interface.
+func (bf *backupFile) Close() (err error) {
+	err = bf.File.Sync()
+	if closeErr := bf.File.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(bf.File.Name(), bf.path)
+	}
+	if err == nil {
+		err = bf.rotate()
+	} else {
+		os.Remove(bf.File.Name())
+	}
+	return
+}
+
+// abort implements the aborter interface.
+func (bf *backupFile) abort() {
+	bf.File.Close()
+	os.Remove(bf.File.Name())
+}
+
+// backupTimeFormat is the layout of the time in the name of a backup file. It
+// sorts in chronological order.
+const backupTimeFormat = "20060102-150405.000"
+
+// BackupFiles returns a target for StartBackups that writes each backup to a
+// new file in dir named prefix followed by the UTC time of the backup and
+// ".db", with permissions that allow access only by its owner. A file is
+// written under a temporary name and renamed when it is complete, so a partial
+// backup is never mistaken for a complete one. Once a backup is complete, the
+// oldest backup files beyond the most recent keep are removed; if keep is not
+// greater than zero, all are retained.
+func BackupFiles(dir, prefix string, keep int) func() (io.WriteCloser, error) {
+	return func() (w io.WriteCloser, err error) {
+		var fl *os.File
+		path := filepath.Join(dir, prefix+time.Now().UTC().Format(backupTimeFormat)+".db")
+		fl, err = os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+		if err == nil {
+			w = &backupFile{File: fl, path: path, rotate: func() (err error) {
+				var list []string
+				if keep > 0 {
+					list, err = filepath.Glob(filepath.Join(dir, prefix+"*.db"))
+				}
+				if len(list) > keep {
+					sort.Strings(list)
+					for _, name := range list[:len(list)-keep] {
+						if err == nil {
+							err = os.Remove(name)
+						}
+					}
+				}
+				return
+			}}
+		}
+		return
+	}
+}
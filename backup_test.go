@@ -0,0 +1,101 @@
+package pinion_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example backs up a database to a buffer, which could as well be a
+// network stream, and opens the restored copy.
+func ExampleDB_Backup() {
+	var db *pinion.DB
+	var err error
+	var buf bytes.Buffer
+	var n int64
+	db, err = quantityDB("example/backup.db", 1, 100)
+	if err == nil {
+		n, err = db.Backup(&buf)
+		fmt.Println(n == int64(buf.Len()))
+		db.Close()
+	}
+	if err == nil {
+		err = os.WriteFile("example/restored.db", buf.Bytes(), 0600)
+	}
+	if err == nil {
+		var count uint64
+		db, err = pinion.Open("example/restored.db", 0600, pinion.Options{})
+		if err == nil {
+			count, err = db.Count(&quantityType{})
+			fmt.Println("restored", count)
+			db.Close()
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// true
+	// restored 100
+}
+
+// Test periodic backups with rotation
+func TestDB_StartBackups(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var list []string
+	const dir = "example/backups"
+	os.RemoveAll(dir)
+	err = os.MkdirAll(dir, 0700)
+	infos := make(chan pinion.BackupInfo, 16)
+	if err == nil {
+		db, err = quantityDB("example/scheduled.db", 1, 20)
+	}
+	if err == nil {
+		db.Close()
+		db, err = pinion.Open("example/scheduled.db", 0600, pinion.Options{
+			BackupHook: func(info pinion.BackupInfo) {
+				infos <- info
+			},
+		})
+	}
+	if err == nil {
+		br := db.StartBackups(5*time.Millisecond, pinion.BackupFiles(dir, "quantity-", 2))
+		for j := 0; j < 4 && err == nil; j++ {
+			info := <-infos
+			err = info.Err
+			if err == nil && info.Size == 0 {
+				err = errors.New("empty backup")
+			}
+		}
+		br.Stop()
+		db.Close()
+	}
+	if err == nil {
+		list, err = filepath.Glob(dir + "/*")
+	}
+	if err == nil && len(list) != 2 {
+		err = fmt.Errorf("expecting 2 retained backups, found %v", list)
+	}
+	if err == nil {
+		db, err = pinion.Open(list[1], 0600, pinion.Options{})
+		if err == nil {
+			var n uint64
+			n, err = db.Count(&quantityType{})
+			if err == nil && n != 20 {
+				err = fmt.Errorf("backup holds %d records, expected 20", n)
+			}
+			db.Close()
+		}
+	}
+	os.RemoveAll(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
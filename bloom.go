@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	bloomBitsPerKey = 10 // About one percent false positives
+	bloomHashCount  = 7
+	bloomMinKeys    = 1024
+)
+
+// bloomFilter records the primary keys of a record type listed in
+// Options.BloomFilters. A negative answer from mayHave is definitive, since
+// the key of every record that is stored is added before its transaction is
+// committed. Keys are never removed, so deleted records and rolled-back
+// writes only add to the small rate of false positives. The filter is built
+// from the stored keys when the database is opened and is rebuilt, within the
+// writing transaction, once the number of keys added exceeds the capacity for
+// which it was sized. Only writes made through this DB are seen, which is
+// assured because a writeable bbolt database cannot be opened by more than one
+// process.
+type bloomFilter struct {
+	mu       sync.RWMutex
+	bits     []uint64
+	count    int // Number of keys added
+	capacity int // Number of keys for which bits was sized
+}
+
+// bloomHashes returns the two hashes from which the bit positions of key are
+// derived.
+func bloomHashes(key []byte) (h1, h2 uint32) {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+// fill sizes the filter for twice the number of keys in bck, which may be
+// nil, and adds them. The caller must hold the write lock.
+func (f *bloomFilter) fill(bck *bbolt.Bucket) {
+	var keys [][]byte
+	if bck != nil {
+		crs := bck.Cursor()
+		for k, _ := crs.First(); k != nil; k, _ = crs.Next() {
+			keys = append(keys, k)
+		}
+	}
+	f.capacity = 2 * len(keys)
+	if f.capacity < bloomMinKeys {
+		f.capacity = bloomMinKeys
+	}
+	f.bits = make([]uint64, (f.capacity*bloomBitsPerKey+63)/64)
+	f.count = 0
+	for _, k := range keys {
+		f.add(k)
+	}
+}
+
+// add sets the bits of key. The caller must hold the write lock.
+func (f *bloomFilter) add(key []byte) {
+	h1, h2 := bloomHashes(key)
+	m := uint32(len(f.bits) * 64)
+	for j := uint32(0); j < bloomHashCount; j++ {
+		pos := (h1 + j*h2) % m
+		f.bits[pos/64] |= 1 << (pos % 64)
+	}
+	f.count++
+}
+
+// put adds key to the filter. If the filter has become too full to be
+// useful, it is rebuilt from the primary index bck, which must belong to the
+// current writeable transaction.
+func (f *bloomFilter) put(bck *bbolt.Bucket, key []byte) {
+	f.mu.Lock()
+	if f.count < f.capacity {
+		f.add(key)
+	} else {
+		f.fill(bck)
+	}
+	f.mu.Unlock()
+}
+
+// mayHave returns false if key has definitely not been added to the filter.
+// A nil filter may have any key.
+func (f *bloomFilter) mayHave(key []byte) bool {
+	if f == nil {
+		return true
+	}
+	h1, h2 := bloomHashes(key)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	m := uint32(len(f.bits) * 64)
+	for j := uint32(0); j < bloomHashCount; j++ {
+		pos := (h1 + j*h2) % m
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomInit builds the filters of the types listed in Options.BloomFilters
+// from their stored primary keys.
+func (db *DB) bloomInit() error {
+	if len(db.opt.BloomFilters) == 0 || db.opt.BoltOpt.ReadOnly {
+		return nil
+	}
+	db.blooms = make(map[string]*bloomFilter)
+	return db.view(func(tx *bbolt.Tx) error {
+		for _, recPtr := range db.opt.BloomFilters {
+			var idx *bbolt.Bucket
+			if bck := tx.Bucket([]byte(recPtr.Name())); bck != nil {
+				idx = bck.Bucket([]byte{0})
+			}
+			f := new(bloomFilter)
+			f.fill(idx)
+			db.blooms[recPtr.Name()] = f
+		}
+		return nil
+	})
+}
@@ -0,0 +1,58 @@
+package pinion_test
+
+import (
+	"testing"
+
+	"github.com/piniondb/pinion"
+)
+
+// Test that Exists answers correctly for a type with a Bloom filter, both for
+// keys stored before the database was opened and for keys added afterward in
+// numbers that require the filter to be rebuilt.
+func TestDB_BloomFilters(t *testing.T) {
+	const fileStr = "example/bloom.db"
+	opt := pinion.Options{BloomFilters: []pinion.Record{&quantityType{}}}
+	db, err := quantityDB(fileStr, 1, 100)
+	if err == nil {
+		db.Close()
+		db, err = pinion.Open(fileStr, 0600, opt)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	exists := func(id uint32) bool {
+		found, err := db.Exists(&quantityType{id: id}, idxQuantityID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return found
+	}
+	for id := uint32(1); id <= 200; id++ {
+		if exists(id) != (id <= 100) {
+			t.Fatalf("record %d: unexpected result before writing", id)
+		}
+	}
+	id := uint32(100)
+	var q quantityType
+	err = db.Put(&q, func() bool {
+		id++
+		q = quantityRec(id)
+		return id <= 3000
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *pinion.Tx) error {
+		q = quantityRec(5000)
+		return tx.PutRec(&q)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := uint32(1); id <= 5000; id++ {
+		if exists(id) != (id <= 3000 || id == 5000) {
+			t.Fatalf("record %d: unexpected result after writing", id)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// check verifies the invariants that pinion maintains for the record type of
+// recPtr. Each stored record must survive an unmarshal/marshal roundtrip
+// unchanged, must be stored under the primary key it generates, and must have
+// exactly one entry in each secondary index. Each secondary index entry must
+// refer to an existing record that generates that entry. The first violation
+// found is returned. An entry that expires (see IndexExpirer) may be missing.
+func (bck bucketGrpType) check(recPtr Record, count uint8) (err error) {
+	var j uint8
+	var val valType
+	var data []byte
+	nameStr := recPtr.Name()
+	scratch := recPtr.New()
+	err = bck.idxs[0].ForEach(func(k, v []byte) (err error) {
+		v, err = bck.migrate(scratch, k, v)
+		if err == nil {
+			err = scratch.UnmarshalBinary(v)
+		}
+		if err == nil {
+			data, err = scratch.MarshalBinary()
+			if err == nil && !bytes.Equal(data, v) {
+				err = fmt.Errorf("%s record %x does not survive marshal roundtrip", nameStr, k)
+			}
+		}
+		if err == nil {
+			val, err = valGet(scratch, count)
+		}
+		if err == nil && !bytes.Equal(val.keys[0], k) {
+			err = fmt.Errorf("%s record %x is stored under primary key %x", nameStr, val.keys[0], k)
+		}
+		for j = 1; j < count && err == nil; j++ {
+			if val.keys[j] != nil && !bytes.Equal(bck.idxs[j].Get(val.keys[j]), k) && !expires(scratch, j) {
+				err = fmt.Errorf("%s record %x has no entry in index %d", nameStr, k, j)
+			}
+			if val.sets != nil {
+				for _, key := range val.sets[j] {
+					if err == nil && !bytes.Equal(bck.idxs[j].Get(key), k) && !expires(scratch, j) {
+						err = fmt.Errorf("%s record %x has no entry %x in index %d", nameStr, k, key, j)
+					}
+				}
+			}
+		}
+		return
+	})
+	for j = 1; j < count && err == nil; j++ {
+		err = bck.idxs[j].ForEach(func(k, v []byte) (err error) {
+			var cur valType
+			cur, err = bck.currentGet(scratch, count, v)
+			if err == nil {
+				if cur.data == nil {
+					err = fmt.Errorf("%s index %d entry %x: %s", nameStr, j, k, ErrMissingRecord)
+				} else if !bytes.Equal(cur.keys[j], k) && (cur.sets == nil || !setHas(cur.sets[j], k)) {
+					err = fmt.Errorf("%s index %d entry %x is stale", nameStr, j, k)
+				}
+			}
+			return
+		})
+	}
+	return
+}
+
+// expires reports whether the entry of recPtr in index idx expires, in which
+// case it may have been removed by SweepIndexes.
+func expires(recPtr Record, idx uint8) bool {
+	expirer, ok := recPtr.(IndexExpirer)
+	return ok && !expirer.IndexExpiry(idx).IsZero()
+}
+
+// checkType is the transaction-level worker for verifying the record type of
+// recPtr. It is not an error if no records of this type have been stored.
+func checkType(tx *bbolt.Tx, recPtr Record) (err error) {
+	var bck bucketGrpType
+	count := recPtr.IndexCount()
+	if tx.Bucket([]byte(recPtr.Name())) != nil {
+		bck, err = bucketGet(recPtr, count, false, tx)
+		if err == nil {
+			err = bck.check(recPtr, count)
+		}
+	}
+	return
+}
+
+// Check verifies the stored records and indexes of recPtr's record type in a
+// single read transaction. Each stored record must survive an
+// unmarshal/marshal roundtrip unchanged and must have exactly the index
+// entries that its keys call for; each index entry must refer to an existing
+// record. A description of the first violation found is returned. It is not an
+// error if no records of the type have been stored.
+func (db *DB) Check(recPtr Record) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.Check(recPtr)
+	}
+	return db.view(func(tx *bbolt.Tx) error {
+		return checkType(tx, recPtr)
+	})
+}
+
+// IndexReport summarizes the secondary index entries examined by
+// VerifyIndexes.
+type IndexReport struct {
+	Records  int // Stored records examined
+	Entries  int // Secondary index entries examined
+	Orphans  int // Entries that refer to a missing record
+	Stale    int // Entries that their record no longer generates
+	Missing  int // Entries that a record generates but that are absent
+	Repaired int // Entries added or removed by repair
+}
+
+// String implements the fmt.Stringer interface.
+func (r IndexReport) String() string {
+	return fmt.Sprintf("records %d, entries %d, orphans %d, stale %d, missing %d, repaired %d",
+		r.Records, r.Entries, r.Orphans, r.Stale, r.Missing, r.Repaired)
+}
+
+// indexEntries returns the entries of index idx called for by a record
+// retrieved with currentGet.
+func (val valType) indexEntries(idx uint8) [][]byte {
+	if val.sets != nil {
+		return val.sets[idx]
+	}
+	if val.keys[idx] != nil {
+		return [][]byte{val.keys[idx]}
+	}
+	return nil
+}
+
+// VerifyIndexes walks the secondary indexes of recPtr's type and compares
+// them with the stored records. Entries that refer to a missing record,
+// which would otherwise cause queries to fail with ErrMissingRecord, are
+// counted as orphans; entries that their record no longer generates are
+// counted as stale, and entries that a record generates but that are absent
+// are counted as missing. An absent entry that expires (see IndexExpirer) is
+// not counted. If repair is true, orphaned and stale entries are removed and
+// missing entries are added in the same transaction. Unlike Check, which
+// stops at the first problem, VerifyIndexes examines the whole type. An error
+// is returned only if a record cannot be decoded or keyed or the database
+// cannot be accessed. It is not an error if no records of the type have been
+// stored.
+func (db *DB) VerifyIndexes(recPtr Record, repair bool) (report IndexReport, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.VerifyIndexes(recPtr, repair)
+	}
+	verify := func(tx *bbolt.Tx) (err error) {
+		var bck bucketGrpType
+		var puts, dels [][][]byte
+		count := recPtr.IndexCount()
+		if tx.Bucket([]byte(recPtr.Name())) == nil {
+			return
+		}
+		bck, err = bucketGet(recPtr, count, false, tx)
+		if err == nil {
+			puts = make([][][]byte, count)
+			dels = make([][][]byte, count)
+			scratch := recPtr.New()
+			err = bck.idxs[0].ForEach(func(k, v []byte) (err error) {
+				var cur valType
+				report.Records++
+				cur, err = bck.currentGet(scratch, count, k)
+				for j := uint8(1); j < count && err == nil; j++ {
+					for _, entry := range cur.indexEntries(j) {
+						if !bytes.Equal(bck.idxs[j].Get(entry), k) && !expires(scratch, j) {
+							report.Missing++
+							puts[j] = append(puts[j], entry, append([]byte(nil), k...))
+						}
+					}
+				}
+				return
+			})
+			for j := uint8(1); j < count && err == nil; j++ {
+				err = bck.idxs[j].ForEach(func(k, v []byte) (err error) {
+					var cur valType
+					report.Entries++
+					cur, err = bck.currentGet(scratch, count, v)
+					if err == nil {
+						if cur.data == nil {
+							report.Orphans++
+							dels[j] = append(dels[j], append([]byte(nil), k...))
+						} else if !bytes.Equal(cur.keys[j], k) && (cur.sets == nil || !setHas(cur.sets[j], k)) {
+							report.Stale++
+							dels[j] = append(dels[j], append([]byte(nil), k...))
+						}
+					}
+					return
+				})
+			}
+		}
+		// Changes are applied after the walk so that no cursor is disturbed
+		for j := 1; j < len(dels) && repair && err == nil; j++ {
+			for k := 0; k < len(dels[j]) && err == nil; k++ {
+				err = bck.idxs[j].Delete(dels[j][k])
+				report.Repaired++
+			}
+			for k := 0; k+1 < len(puts[j]) && err == nil; k += 2 {
+				err = bck.idxs[j].Put(puts[j][k], puts[j][k+1])
+				report.Repaired++
+			}
+		}
+		return
+	}
+	if repair {
+		err = db.update(verify)
+	} else {
+		err = db.view(verify)
+	}
+	if err != nil {
+		report = IndexReport{}
+	}
+	return
+}
@@ -0,0 +1,126 @@
+package pinion_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+	"go.etcd.io/bbolt"
+)
+
+// Test the detection and repair of damaged index entries
+func TestDB_VerifyIndexes(t *testing.T) {
+	var db *pinion.DB
+	var bdb *bbolt.DB
+	var err error
+	var report pinion.IndexReport
+	var list []string
+	const fileStr = "example/verify.db"
+	pk := func(id uint32) []byte {
+		var kb store.KeyBuffer
+		kb.Uint32(id)
+		data, _ := kb.Data()
+		return data
+	}
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	for id := uint32(1); id <= 5 && err == nil; id++ {
+		q := quantityRec(id)
+		err = db.PutRec(&q)
+	}
+	if err == nil {
+		db.Close()
+		bdb, err = bbolt.Open(fileStr, 0600, nil)
+	}
+	if err == nil {
+		err = bdb.Update(func(tx *bbolt.Tx) (err error) {
+			bck := tx.Bucket([]byte(quantityType{}.Name())).Bucket([]byte{idxQuantityVal})
+			k, _ := bck.Cursor().First()
+			// Remove an entry, refer to a missing record and add an entry that
+			// no record generates
+			err = bck.Delete(k)
+			if err == nil {
+				err = bck.Put(append([]byte("zz"), pk(99)...), pk(99))
+			}
+			if err == nil {
+				err = bck.Put(append([]byte{0}, pk(1)...), pk(1))
+			}
+			return
+		})
+		bdb.Close()
+	}
+	if err == nil {
+		db, err = pinion.Open(fileStr, 0600, pinion.Options{})
+	}
+	for _, repair := range []bool{false, true, false} {
+		if err == nil {
+			report, err = db.VerifyIndexes(&quantityType{}, repair)
+			list = append(list, report.String())
+		}
+	}
+	if err == nil {
+		err = db.Check(&quantityType{})
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j, str := range []string{
+		"records 5, entries 6, orphans 1, stale 1, missing 1, repaired 0",
+		"records 5, entries 6, orphans 1, stale 1, missing 1, repaired 3",
+		"records 5, entries 5, orphans 0, stale 0, missing 0, repaired 0",
+	} {
+		if list[j] != str {
+			t.Fatalf("unexpected report %d: %s", j, list[j])
+		}
+	}
+}
+
+// Test the verification performed by Open according to Options.OpenCheck
+func TestOpen_OpenCheck(t *testing.T) {
+	var db *pinion.DB
+	var bdb *bbolt.DB
+	var err error
+	const fileStr = "example/opencheck.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{OpenCheck: pinion.OpenCheckFull})
+	for id := uint32(1); id <= 5 && err == nil; id++ {
+		q := quantityRec(id)
+		err = db.PutRec(&q)
+	}
+	if err == nil {
+		db.Close()
+		bdb, err = bbolt.Open(fileStr, 0600, nil)
+	}
+	if err == nil {
+		// Remove an index entry; the file itself remains sound
+		err = bdb.Update(func(tx *bbolt.Tx) error {
+			bck := tx.Bucket([]byte(quantityType{}.Name())).Bucket([]byte{idxQuantityVal})
+			k, _ := bck.Cursor().First()
+			return bck.Delete(k)
+		})
+		bdb.Close()
+	}
+	opt := pinion.Options{Records: []pinion.Record{&quantityType{}}}
+	for _, mode := range []pinion.OpenCheckMode{pinion.OpenCheckNone, pinion.OpenCheckQuick} {
+		if err == nil {
+			opt.OpenCheck = mode
+			db, err = pinion.Open(fileStr, 0600, opt)
+			if err == nil {
+				db.Close()
+			}
+		}
+	}
+	if err == nil {
+		opt.OpenCheck = pinion.OpenCheckFull
+		db, err = pinion.Open(fileStr, 0600, opt)
+		if err == nil {
+			db.Close()
+			err = errors.New("damaged index not detected")
+		} else if errors.Is(err, pinion.ErrInconsistent) {
+			err = nil
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// checkpointBucketName is the name of the bucket, within the meta bucket, in
+// which checkpoints are stored
+const checkpointBucketName = "checkpoint"
+
+// Tags of the checkpoint's fields
+const (
+	cpTagOffset = iota + 1
+	cpTagLastKey
+	cpTagSaved
+)
+
+// Checkpoint records the progress of a long-running import so that it can be
+// resumed after an interruption. It is stored in the same transaction as the
+// records it describes, so a checkpoint never claims more or less progress
+// than has actually been committed.
+type Checkpoint struct {
+	// Offset is the position in the source of the next record to be imported,
+	// for example a byte offset or line number. It is maintained by the
+	// application.
+	Offset int64
+	// LastKey is the primary key of the last record stored. It is maintained
+	// by pinion.
+	LastKey []byte
+	// Saved is the time at which the checkpoint was stored. It is maintained by
+	// pinion.
+	Saved time.Time
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (cp Checkpoint) MarshalBinary() ([]byte, error) {
+	var put TagPutBuffer
+	put.Int64(cpTagOffset, cp.Offset)
+	put.Bytes(cpTagLastKey, cp.LastKey)
+	put.Time(cpTagSaved, cp.Saved)
+	return put.Data()
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (cp *Checkpoint) UnmarshalBinary(data []byte) error {
+	get := NewTagGetBuffer(data)
+	get.Int64(cpTagOffset, &cp.Offset)
+	get.Bytes(cpTagLastKey, &cp.LastKey)
+	get.Time(cpTagSaved, &cp.Saved)
+	return get.Done()
+}
+
+// checkpointKey returns the key under which the named checkpoint for the
+// record type of recPtr is stored.
+func checkpointKey(recPtr Record, name string) []byte {
+	return []byte(recPtr.Name() + "\x00" + name)
+}
+
+// PutCheckpointed stores records like Put and, at the end of each
+// transaction, saves a checkpoint under the specified name in the same
+// transaction. f is called with a pointer to the checkpoint; each time it
+// populates recPtr with a record to be stored, it should also advance the
+// checkpoint's Offset past that record in the source. The import begins with
+// the checkpoint most recently saved, so an import that is interrupted can be
+// resumed by calling CheckpointGet, positioning the source at Offset, and
+// calling this method again. Records from the last, uncommitted transaction
+// are simply stored again. The checkpoint is retained after the import
+// completes; call CheckpointClear to remove it.
+func (db *DB) PutCheckpointed(recPtr Record, name string, f func(cp *Checkpoint) bool) (err error) {
+	var cp Checkpoint
+	if odb := db.owner(recPtr); odb != db {
+		return odb.PutCheckpointed(recPtr, name, f)
+	}
+	cp, err = db.CheckpointGet(recPtr, name)
+	if err == nil {
+		var keyErr error
+		err = db.recPut(recPtr, func() bool {
+			if keyErr == nil && f(&cp) {
+				cp.LastKey, keyErr = recPtr.Key(0)
+				return keyErr == nil
+			}
+			return false
+		}, false, func(tx *bbolt.Tx) (err error) {
+			var bck *bbolt.Bucket
+			var data []byte
+			bck, err = bucket(tx, metaBucketName, true)
+			if err == nil {
+				bck, err = bck.CreateBucketIfNotExists([]byte(checkpointBucketName))
+				if err == nil {
+					cp.Saved = db.now().UTC().Round(0)
+					data, err = cp.MarshalBinary()
+					if err == nil {
+						err = bck.Put(checkpointKey(recPtr, name), data)
+					}
+				}
+			}
+			return
+		})
+		if err == nil {
+			err = keyErr
+		}
+	}
+	return
+}
+
+// CheckpointGet returns the checkpoint saved under the specified name by
+// PutCheckpointed for the record type of recPtr. If none has been saved, the
+// zero value is returned so that an import begins at the start of its source.
+func (db *DB) CheckpointGet(recPtr Record, name string) (cp Checkpoint, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.CheckpointGet(recPtr, name)
+	}
+	err = db.view(func(tx *bbolt.Tx) (err error) {
+		bck := tx.Bucket([]byte(metaBucketName))
+		if bck != nil {
+			bck = bck.Bucket([]byte(checkpointBucketName))
+		}
+		if bck != nil {
+			data := bck.Get(checkpointKey(recPtr, name))
+			if data != nil {
+				err = cp.UnmarshalBinary(data)
+			}
+		}
+		return
+	})
+	return
+}
+
+// CheckpointClear removes the checkpoint saved under the specified name for
+// the record type of recPtr. It is not an error if there is no such
+// checkpoint.
+func (db *DB) CheckpointClear(recPtr Record, name string) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.CheckpointClear(recPtr, name)
+	}
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		bck := tx.Bucket([]byte(metaBucketName))
+		if bck != nil {
+			bck = bck.Bucket([]byte(checkpointBucketName))
+		}
+		if bck != nil {
+			err = bck.Delete(checkpointKey(recPtr, name))
+		}
+		return
+	})
+}
@@ -0,0 +1,104 @@
+package pinion_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates an import that is interrupted and then resumed.
+func ExampleDB_PutCheckpointed() {
+	var db *pinion.DB
+	var err error
+	var q quantityType
+	var cp pinion.Checkpoint
+	var count int
+	// The source of the import is a sequence of 100 IDs. The import stops the
+	// first time it reaches ID 35 to simulate an interruption.
+	stop := int64(35)
+	load := func(cp *pinion.Checkpoint) bool {
+		if cp.Offset < 100 && cp.Offset != stop {
+			q = quantityRec(uint32(cp.Offset))
+			cp.Offset++
+			return true
+		}
+		return false
+	}
+	db, err = pinion.Create("example/checkpoint.db", 0600, pinion.Options{BatchSize: 10})
+	if err == nil {
+		err = db.PutCheckpointed(&q, "import", load)
+		if err == nil {
+			cp, err = db.CheckpointGet(&q, "import")
+			fmt.Printf("Interrupted at offset %d\n", cp.Offset)
+		}
+		if err == nil {
+			stop = -1
+			err = db.PutCheckpointed(&q, "import", load)
+		}
+		if err == nil {
+			cp, err = db.CheckpointGet(&q, "import")
+			fmt.Printf("Completed at offset %d, last ID %d\n", cp.Offset, binary.BigEndian.Uint32(cp.LastKey))
+		}
+		if err == nil {
+			count, err = quantityCount(db)
+			fmt.Printf("%d records\n", count)
+		}
+		if err == nil {
+			err = db.CheckpointClear(&q, "import")
+		}
+		if err == nil {
+			cp, err = db.CheckpointGet(&q, "import")
+			fmt.Printf("Cleared offset %d\n", cp.Offset)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Interrupted at offset 35
+	// Completed at offset 100, last ID 99
+	// 100 records
+	// Cleared offset 0
+}
+
+// Test early commits of transactions that exceed the byte limit
+func TestDB_BatchBytes(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/batchbytes.db"
+	for _, opt := range []pinion.Options{{BatchBytes: 200}, {BatchBytes: -1, BatchSize: 1000}} {
+		db, err = pinion.Create(fileStr, 0600, opt)
+		if err == nil {
+			var q quantityType
+			var cp pinion.Checkpoint
+			commits := make(map[int64]bool)
+			// Each committed checkpoint records how far the import had progressed
+			err = db.PutCheckpointed(&q, "bytes", func(p *pinion.Checkpoint) bool {
+				if err == nil {
+					cp, err = db.CheckpointGet(&q, "bytes")
+					commits[cp.Offset] = true
+				}
+				if err == nil && p.Offset < 100 {
+					q = quantityRec(uint32(p.Offset))
+					p.Offset++
+					return true
+				}
+				return false
+			})
+			db.Close()
+			if err == nil {
+				if opt.BatchBytes > 0 && len(commits) < 10 {
+					t.Fatalf("expecting many early commits, got %d", len(commits))
+				} else if opt.BatchBytes < 0 && len(commits) != 1 {
+					t.Fatalf("expecting no early commits, got %d", len(commits))
+				}
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
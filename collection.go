@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+// Collection provides access to the records of one type with callbacks and
+// results that use the record type T directly. P is the pointer type *T,
+// which must implement the Record interface; it is inferred by Of. Because
+// each method supplies its own record variable, iteration closures do not
+// need to share one declared outside them. A Collection is a lightweight
+// value that may be copied freely.
+type Collection[T any, P interface {
+	*T
+	Record
+}] struct {
+	db *DB
+}
+
+// Of returns a Collection for the records of type T in db. For example,
+// Of[contactType](db) gives access to records of type contactType when
+// *contactType implements the Record interface.
+func Of[T any, P interface {
+	*T
+	Record
+}](db *DB) Collection[T, P] {
+	return Collection[T, P]{db: db}
+}
+
+// DB returns the database that holds the collection.
+func (c Collection[T, P]) DB() *DB {
+	return c.db
+}
+
+// Get calls f with successive records in the order of index idx, beginning
+// with the first that matches start. Only the field or fields of start that
+// make up the key associated with index idx need to be assigned. The record
+// passed to f is overwritten by the next one; copy it to retain it. The
+// iteration stops when f returns false.
+func (c Collection[T, P]) Get(start T, idx uint8, f func(rec *T) bool) error {
+	rec := start
+	return c.db.Get(P(&rec), idx, func() bool {
+		return f(&rec)
+	})
+}
+
+// GetAll returns the records that Get would pass to its callback as a slice.
+// If max is greater than zero, no more than max records are returned. See the
+// package-level GetAll for requirements on the record type.
+func (c Collection[T, P]) GetAll(start T, idx uint8, max int) ([]T, error) {
+	return GetAll[T, P](c.db, &start, idx, max)
+}
+
+// GetRec retrieves the first record that matches rec for index idx. See
+// DB.GetRec.
+func (c Collection[T, P]) GetRec(rec *T, idx uint8) error {
+	return c.db.GetRec(P(rec), idx)
+}
+
+// Exists reports whether a record matching rec for index idx is stored. See
+// DB.Exists.
+func (c Collection[T, P]) Exists(rec T, idx uint8) (bool, error) {
+	return c.db.Exists(P(&rec), idx)
+}
+
+// each returns a callback for Put, Add and Delete that zeroes rec before each
+// call of f.
+func each[T any](rec *T, f func(rec *T) bool) func() bool {
+	return func() bool {
+		var zero T
+		*rec = zero
+		return f(rec)
+	}
+}
+
+// Put stores the records that f assigns. f is passed a zeroed record each
+// time it is called and returns false, leaving the record unused, when there
+// are no more. See DB.Put.
+func (c Collection[T, P]) Put(f func(rec *T) bool) error {
+	var rec T
+	return c.db.Put(P(&rec), each(&rec, f))
+}
+
+// Add functions like Put except that each record is passed an autoincremented
+// ID by means of its NextID method. See DB.Add.
+func (c Collection[T, P]) Add(f func(rec *T) bool) error {
+	var rec T
+	return c.db.Add(P(&rec), each(&rec, f))
+}
+
+// Delete removes the records whose primary keys f assigns. f is passed a
+// zeroed record each time it is called and returns false when there are no
+// more. See DB.Delete.
+func (c Collection[T, P]) Delete(f func(rec *T) bool) error {
+	var rec T
+	return c.db.Delete(P(&rec), each(&rec, f))
+}
+
+// PutRec stores one record. See DB.PutRec.
+func (c Collection[T, P]) PutRec(rec *T) error {
+	return c.db.PutRec(P(rec))
+}
+
+// AddRec stores one record with an autoincremented ID. See DB.AddRec.
+func (c Collection[T, P]) AddRec(rec *T) error {
+	return c.db.AddRec(P(rec))
+}
+
+// DeleteRec removes the record whose primary key matches rec. See
+// DB.DeleteRec.
+func (c Collection[T, P]) DeleteRec(rec *T) error {
+	return c.db.DeleteRec(P(rec))
+}
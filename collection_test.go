@@ -0,0 +1,46 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates typed access to the records of one type.
+func ExampleOf() {
+	var db *pinion.DB
+	var err error
+	var list []quantityType
+	db, err = pinion.Create("example/collection.db", 0600, pinion.Options{})
+	if err == nil {
+		quantities := pinion.Of[quantityType](db)
+		id := uint32(0)
+		err = quantities.Put(func(q *quantityType) bool {
+			id++
+			*q = quantityRec(id)
+			return id <= 12
+		})
+		if err == nil {
+			err = quantities.Get(quantityType{id: 10}, idxQuantityID, func(q *quantityType) bool {
+				fmt.Println(q)
+				return true
+			})
+		}
+		if err == nil {
+			err = quantities.DeleteRec(&quantityType{id: 11})
+		}
+		if err == nil {
+			list, err = quantities.GetAll(quantityType{}, idxQuantityVal, 4)
+			fmt.Println(list)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [         10 : ten]
+	// [         11 : eleven]
+	// [         12 : twelve]
+	// [[          8 : eight] [          5 : five] [          4 : four] [          9 : nine]]
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.etcd.io/bbolt"
+)
+
+// compactTxSize is the number of bytes of keys and values copied in each
+// write transaction of a compaction
+const compactTxSize = 64 << 20
+
+// compactTemp writes a compacted copy of src to a temporary file from which it
+// can be renamed to path, and returns the name of that file.
+func compactTemp(src *bbolt.DB, path string) (name string, err error) {
+	var info os.FileInfo
+	var dst *bbolt.DB
+	info, err = os.Stat(src.Path())
+	if err == nil {
+		name = tempName(path)
+		dst, err = bbolt.Open(name, info.Mode().Perm(), &bbolt.Options{PageSize: src.Info().PageSize})
+	}
+	if err == nil {
+		err = bbolt.Compact(dst, src, compactTxSize)
+		closeErr := dst.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(name)
+		}
+	}
+	if err != nil {
+		name = ""
+	}
+	return
+}
+
+// CompactTo writes a compacted copy of the database to a new file at path,
+// replacing any file that is there. bbolt does not return the pages freed by
+// deletions to the file system, so a long-lived database with heavy delete
+// churn can occupy much more space than its content requires; the copy
+// contains only the pages that are in use, densely filled. Records may be
+// written while the copy is made, though the copy reflects the database as it
+// was when the compaction began. The copy is written under a temporary name
+// and renamed to path when it is complete. Only the records of db itself are
+// copied, not those of attached databases.
+func (db *DB) CompactTo(path string) (err error) {
+	var name, abs, dbAbs string
+	bdb, release := db.acquire()
+	defer release()
+	if bdb == nil {
+		return ErrNotOpen
+	}
+	abs, err = filepath.Abs(path)
+	if err == nil {
+		dbAbs, err = filepath.Abs(db.path)
+	}
+	if err == nil && abs == dbAbs {
+		err = fmt.Errorf("cannot compact \"%s\" onto itself; see CompactInPlace", path)
+	}
+	if err == nil {
+		name, err = compactTemp(bdb, path)
+	}
+	if err == nil {
+		err = retry(db.opt, func() error {
+			return os.Rename(name, path)
+		})
+		if err != nil {
+			os.Remove(name)
+		}
+	}
+	return
+}
+
+// CompactInPlace arranges for the database to be compacted, as CompactTo
+// does, when it is closed. Close writes the compacted copy once no more
+// records can be written, closes the database and then replaces the database
+// file with the copy, so an interruption leaves either the original file or
+// the compacted one. Close reports a failure of the compaction, in which case
+// the original file is retained. Compaction needs as much free space as the
+// database content occupies. bbolt.ErrDatabaseReadOnly is returned if the
+// database was opened read-only.
+func (db *DB) CompactInPlace() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.opt.BoltOpt.ReadOnly {
+		return bbolt.ErrDatabaseReadOnly
+	}
+	if db.boltDB == nil {
+		return ErrNotOpen
+	}
+	db.compact = true
+	return nil
+}
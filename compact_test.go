@@ -0,0 +1,103 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"go.etcd.io/bbolt"
+)
+
+// fileSize returns the size of the file at path, or -1 if it cannot be
+// determined.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+// This example reclaims the space freed by deleting most of the records of a
+// database.
+func ExampleDB_CompactTo() {
+	var db *pinion.DB
+	var err error
+	var n uint64
+	const fileStr = "example/churn.db"
+	db, err = quantityDB(fileStr, 1, 5000)
+	if err == nil {
+		// Keep the first ten records
+		id := uint32(10)
+		var q quantityType
+		err = db.Delete(&q, func() bool {
+			id++
+			q = quantityRec(id)
+			return id <= 5000
+		})
+	}
+	if err == nil {
+		err = db.CompactTo("example/compacted.db")
+	}
+	if err == nil {
+		fmt.Println("copy is smaller", fileSize("example/compacted.db") < fileSize(fileStr))
+		// Compact the database itself when it is closed
+		size := fileSize(fileStr)
+		err = db.CompactInPlace()
+		if err == nil {
+			err = db.Close()
+		}
+		fmt.Println("file is smaller", fileSize(fileStr) < size)
+	}
+	if err == nil {
+		db, err = pinion.Open(fileStr, 0600, pinion.Options{})
+		if err == nil {
+			n, err = db.Count(&quantityType{})
+			fmt.Println("records", n)
+			if err == nil {
+				err = db.Check(&quantityType{})
+			}
+			db.Close()
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// copy is smaller true
+	// file is smaller true
+	// records 10
+}
+
+// Test that a database is not compacted onto its own file, however the path
+// is written, and that a read-only database is not compacted in place
+func TestDB_CompactGuards(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/compactguard.db"
+	db, err = quantityDB(fileStr, 1, 10)
+	if err == nil {
+		for _, path := range []string{fileStr, "./" + fileStr} {
+			if db.CompactTo(path) == nil {
+				t.Fatalf("database compacted onto itself through %s", path)
+			}
+		}
+		db.Close()
+	}
+	if err == nil {
+		opt := pinion.Options{}
+		opt.BoltOpt.ReadOnly = true
+		db, err = pinion.Open(fileStr, 0600, opt)
+		if err == nil {
+			if ipErr := db.CompactInPlace(); !errors.Is(ipErr, bbolt.ErrDatabaseReadOnly) {
+				t.Fatalf("expecting ErrDatabaseReadOnly, got %v", ipErr)
+			}
+			err = db.Close()
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrConstraint is wrapped by the *ConstraintError reported when a record
+// fails one or more of its constraints
+var ErrConstraint = errors.New("constraint violated")
+
+// The Constraint type describes a rule that a record must satisfy before it
+// is stored. Constraints are usually built with NonEmpty, Range and OneOf.
+type Constraint struct {
+	// Field names the constrained field in error reports
+	Field string
+	// Check returns an empty string if rec satisfies the constraint, or a
+	// short description of the problem otherwise
+	Check func(rec Record) string
+}
+
+// The Constrainer interface may be implemented by a record type to declare
+// the constraints that are enforced whenever one of its records is written
+// with Put, Add or any other method that stores records.
+type Constrainer interface {
+	Constraints() []Constraint
+}
+
+// NonEmpty returns a constraint that requires the string returned by get to
+// contain something other than white space.
+func NonEmpty(field string, get func(rec Record) string) Constraint {
+	return Constraint{Field: field, Check: func(rec Record) string {
+		if strings.TrimSpace(get(rec)) == "" {
+			return "must not be empty"
+		}
+		return ""
+	}}
+}
+
+// Range returns a constraint that requires the value returned by get to lie
+// between lo and hi inclusive.
+func Range(field string, lo, hi float64, get func(rec Record) float64) Constraint {
+	return Constraint{Field: field, Check: func(rec Record) string {
+		val := get(rec)
+		if val < lo || val > hi {
+			return fmt.Sprintf("%g is not in range [%g, %g]", val, lo, hi)
+		}
+		return ""
+	}}
+}
+
+// OneOf returns a constraint that requires the string returned by get to be
+// one of the specified values.
+func OneOf(field string, values []string, get func(rec Record) string) Constraint {
+	return Constraint{Field: field, Check: func(rec Record) string {
+		val := get(rec)
+		for _, v := range values {
+			if v == val {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not one of %q", val, values)
+	}}
+}
+
+// Violation describes one failed constraint
+type Violation struct {
+	Field, Problem string
+}
+
+// ConstraintError reports every constraint failed by a record
+type ConstraintError struct {
+	Name       string
+	Violations []Violation
+}
+
+func (e *ConstraintError) Error() string {
+	var list []string
+	for _, v := range e.Violations {
+		list = append(list, v.Field+" "+v.Problem)
+	}
+	return fmt.Sprintf("%s: %s: %s", ErrConstraint, e.Name, strings.Join(list, "; "))
+}
+
+// Unwrap permits errors.Is(err, ErrConstraint)
+func (e *ConstraintError) Unwrap() error {
+	return ErrConstraint
+}
+
+// constrain checks recPtr against its constraints, if any.
+func constrain(recPtr Record) (err error) {
+	if c, ok := recPtr.(Constrainer); ok {
+		var violations []Violation
+		for _, con := range c.Constraints() {
+			if problem := con.Check(recPtr); problem != "" {
+				violations = append(violations, Violation{Field: con.Field, Problem: problem})
+			}
+		}
+		if len(violations) > 0 {
+			err = &ConstraintError{Name: recPtr.Name(), Violations: violations}
+		}
+	}
+	return
+}
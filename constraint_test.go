@@ -0,0 +1,98 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// staffType is a person record with data quality rules
+type staffType struct {
+	personType
+}
+
+func (s staffType) Name() string {
+	return "staff"
+}
+
+func (s staffType) New() pinion.Record {
+	return new(staffType)
+}
+
+// Constraints implements the pinion.Constrainer interface
+func (s staffType) Constraints() []pinion.Constraint {
+	return []pinion.Constraint{
+		pinion.NonEmpty("last", func(rec pinion.Record) string {
+			return rec.(*staffType).name.last
+		}),
+		pinion.Range("id", 1, 999, func(rec pinion.Record) float64 {
+			return float64(rec.(*staffType).id)
+		}),
+		pinion.OneOf("middle", []string{"", "A", "J"}, func(rec pinion.Record) string {
+			return rec.(*staffType).name.middle
+		}),
+	}
+}
+
+// This example demonstrates the enforcement of record constraints.
+func ExampleConstrainer() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/constraint.db", 0600, pinion.Options{})
+	if err == nil {
+		s := staffType{personType{id: 1, name: nameType{last: "Smith", first: "Ann"}}}
+		err = db.PutRec(&s)
+		if err == nil {
+			s = staffType{personType{id: 1200, name: nameType{middle: "Q", first: "Bob"}}}
+			err = db.PutRec(&s)
+			fmt.Println(err)
+			fmt.Println(errors.Is(err, pinion.ErrConstraint))
+			err = nil
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// constraint violated: staff: last must not be empty; id 1200 is not in range [1, 999]; middle "Q" is not one of ["" "A" "J"]
+	// true
+}
+
+// This example demonstrates the reporting of every failure in a validation
+// pass.
+func ExampleWrapDB_CollectAll() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/collect.db", 0600, pinion.Options{})
+	if err == nil {
+		wdb := db.Wrap().CollectAll()
+		for _, s := range []staffType{
+			{personType{id: 1, name: nameType{last: "Smith"}}},
+			{personType{id: 2, name: nameType{last: ""}}},
+			{personType{id: 3, name: nameType{last: "Jones"}}},
+			{personType{id: 4000, name: nameType{last: "Taylor"}}},
+		} {
+			wdb.PutRec(&s)
+		}
+		for _, err := range wdb.Errors() {
+			fmt.Println(err)
+		}
+		var s staffType
+		wdb.Get(&s, idxPersonID, func() bool {
+			fmt.Println(s.personType)
+			return true
+		})
+		wdb.ErrorClear()
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// constraint violated: staff: last must not be empty
+	// constraint violated: staff: id 4000 is not in range [1, 999]
+	//   Smith / 1
+	//   Jones / 3
+}
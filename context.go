@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"context"
+)
+
+// ctxCall returns a callback that calls f for as long as ctx is not done,
+// along with a function that reports ctx.Err() if the callback stopped
+// because of it.
+func ctxCall(ctx context.Context, f func() bool) (call func() bool, done func() error) {
+	var ctxErr error
+	call = func() bool {
+		ctxErr = ctx.Err()
+		return ctxErr == nil && f()
+	}
+	done = func() error {
+		return ctxErr
+	}
+	return
+}
+
+// GetCtx functions like Get except that ctx is checked before each call of
+// f. If ctx is done, the iteration stops and ctx.Err() is returned.
+func (db *DB) GetCtx(ctx context.Context, recPtr Record, idx uint8, f func() bool) (err error) {
+	call, done := ctxCall(ctx, f)
+	err = db.Get(recPtr, idx, call)
+	if err == nil {
+		err = done()
+	}
+	return
+}
+
+// PutCtx functions like Put except that ctx is checked before each call of f.
+// If ctx is done, the iteration stops and ctx.Err() is returned. The records
+// assigned by f before that point are stored, so a bulk load that is cancelled
+// can be resumed from where it stopped.
+func (db *DB) PutCtx(ctx context.Context, recPtr Record, f func() bool) (err error) {
+	call, done := ctxCall(ctx, f)
+	err = db.Put(recPtr, call)
+	if err == nil {
+		err = done()
+	}
+	return
+}
+
+// AddCtx functions like Add with the cancellation behavior of PutCtx.
+func (db *DB) AddCtx(ctx context.Context, recPtr Record, f func() bool) (err error) {
+	call, done := ctxCall(ctx, f)
+	err = db.Add(recPtr, call)
+	if err == nil {
+		err = done()
+	}
+	return
+}
+
+// DeleteCtx functions like Delete except that ctx is checked before each call
+// of f. If ctx is done, the iteration stops and ctx.Err() is returned. The
+// records assigned by f before that point are deleted.
+func (db *DB) DeleteCtx(ctx context.Context, recPtr Record, f func() bool) (err error) {
+	call, done := ctxCall(ctx, f)
+	err = db.Delete(recPtr, call)
+	if err == nil {
+		err = done()
+	}
+	return
+}
+
+// GetCtxFunc functions like GetCtx except that ctx is passed to f. The
+// callback thereby has access to the deadline and to the values carried by
+// the context of the request it serves, such as the identity of the caller or
+// a tracing span, without resorting to package-level variables.
+func (db *DB) GetCtxFunc(ctx context.Context, recPtr Record, idx uint8, f func(ctx context.Context) bool) error {
+	return db.GetCtx(ctx, recPtr, idx, func() bool {
+		return f(ctx)
+	})
+}
+
+// PutCtxFunc functions like PutCtx except that ctx is passed to f, as with
+// GetCtxFunc.
+func (db *DB) PutCtxFunc(ctx context.Context, recPtr Record, f func(ctx context.Context) bool) error {
+	return db.PutCtx(ctx, recPtr, func() bool {
+		return f(ctx)
+	})
+}
+
+// AddCtxFunc functions like AddCtx except that ctx is passed to f, as with
+// GetCtxFunc.
+func (db *DB) AddCtxFunc(ctx context.Context, recPtr Record, f func(ctx context.Context) bool) error {
+	return db.AddCtx(ctx, recPtr, func() bool {
+		return f(ctx)
+	})
+}
+
+// DeleteCtxFunc functions like DeleteCtx except that ctx is passed to f, as
+// with GetCtxFunc.
+func (db *DB) DeleteCtxFunc(ctx context.Context, recPtr Record, f func(ctx context.Context) bool) error {
+	return db.DeleteCtx(ctx, recPtr, func() bool {
+		return f(ctx)
+	})
+}
@@ -0,0 +1,131 @@
+package pinion_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/piniondb/pinion"
+)
+
+// Test cancellation of long-running operations
+func TestDB_Ctx(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var count int
+	db, err = pinion.Create("example/ctx.db", 0600, pinion.Options{BatchSize: 100})
+	if err == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		var q quantityType
+		id := uint32(0)
+		err = db.PutCtx(ctx, &q, func() bool {
+			id++
+			q = quantityRec(id)
+			if id == 250 {
+				cancel()
+			}
+			return id < 1000
+		})
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		} else {
+			t.Fatalf("expecting context.Canceled from PutCtx, got %v", err)
+		}
+		if err == nil {
+			q = quantityType{}
+			err = db.Get(&q, idxQuantityID, func() bool {
+				count++
+				return true
+			})
+		}
+		if err == nil && count != 250 {
+			t.Fatalf("expecting 250 records, got %d", count)
+		}
+		if err == nil {
+			ctx, cancel = context.WithCancel(context.Background())
+			count = 0
+			q = quantityType{}
+			err = db.GetCtx(ctx, &q, idxQuantityID, func() bool {
+				count++
+				if count == 10 {
+					cancel()
+				}
+				return true
+			})
+			if errors.Is(err, context.Canceled) && count == 10 {
+				err = nil
+			} else {
+				t.Fatalf("expecting context.Canceled after 10 records, got %v after %d", err, count)
+			}
+		}
+		if err == nil {
+			ctx, cancel = context.WithCancel(context.Background())
+			id = 0
+			err = db.DeleteCtx(ctx, &q, func() bool {
+				id++
+				q.id = id
+				if id == 100 {
+					cancel()
+				}
+				return true
+			})
+			if errors.Is(err, context.Canceled) {
+				var found bool
+				q.id = 100
+				found, err = db.Exists(&q, idxQuantityID)
+				if err == nil && found {
+					t.Fatalf("record not deleted before cancellation")
+				}
+				if err == nil {
+					q.id = 101
+					found, err = db.Exists(&q, idxQuantityID)
+					if err == nil && !found {
+						t.Fatalf("record deleted after cancellation")
+					}
+				}
+			} else {
+				t.Fatalf("expecting context.Canceled from DeleteCtx, got %v", err)
+			}
+		}
+		cancel()
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// requestUserKey is the context key of the user on whose behalf a request is
+// served
+type requestUserKey struct{}
+
+// describeQuantity is a helper, deep within request handling, that needs
+// request state
+func describeQuantity(ctx context.Context, q quantityType) string {
+	user, _ := ctx.Value(requestUserKey{}).(string)
+	return fmt.Sprintf("%s sees %d", user, q.id)
+}
+
+// This example passes request state to a callback through its context.
+func ExampleDB_GetCtxFunc() {
+	var db *pinion.DB
+	var err error
+	db, err = quantityDB("example/ctxfunc.db", 1, 3)
+	if err == nil {
+		ctx := context.WithValue(context.Background(), requestUserKey{}, "carol")
+		q := quantityRec(1)
+		err = db.GetCtxFunc(ctx, &q, idxQuantityID, func(ctx context.Context) bool {
+			fmt.Println(describeQuantity(ctx, q))
+			return true
+		})
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// carol sees 1
+	// carol sees 2
+	// carol sees 3
+}
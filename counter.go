@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding/binary"
+
+	"go.etcd.io/bbolt"
+)
+
+// Name of the bucket, within the meta bucket, that holds the number of stored
+// records of each type. The key is the type name followed by a zero byte and
+// the value is a big-endian 64-bit count.
+const countBucketName = "count"
+
+// countKey returns the key of the record count of the type named nameStr.
+func countKey(nameStr string) []byte {
+	return []byte(nameStr + "\x00")
+}
+
+// countScan counts the records in the primary index bck.
+func countScan(bck *bbolt.Bucket) (n uint64) {
+	bck.ForEach(func(k, v []byte) error {
+		n++
+		return nil
+	})
+	return
+}
+
+// countAdd adjusts the record count of the type by delta. It must be called
+// before the records are stored or deleted, since a count that has not been
+// kept yet, such as that of a type stored by an earlier version of pinion, is
+// first established by counting the records.
+func (bck bucketGrpType) countAdd(nameStr string, delta int) (err error) {
+	var meta, cnt *bbolt.Bucket
+	var n uint64
+	meta, err = bucket(bck.rec.Tx(), metaBucketName, true)
+	if err == nil {
+		cnt, err = meta.CreateBucketIfNotExists([]byte(countBucketName))
+	}
+	if err == nil {
+		key := countKey(nameStr)
+		if data := cnt.Get(key); len(data) == 8 {
+			n = binary.BigEndian.Uint64(data)
+		} else {
+			n = countScan(bck.idxs[0])
+		}
+		n += uint64(delta)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], n)
+		err = cnt.Put(key, buf[:])
+	}
+	return
+}
+
+// Count returns the number of stored records of recPtr's type. The count is
+// maintained as records are written and deleted, so it is returned without
+// visiting the records. The records of a type last written by a version of
+// pinion that did not keep counts are counted, until the next write of the
+// type establishes its count. Only the type of recPtr is used.
+func (db *DB) Count(recPtr Record) (n uint64, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.Count(recPtr)
+	}
+	nameStr := recPtr.Name()
+	err = db.view(func(tx *bbolt.Tx) error {
+		if meta := tx.Bucket([]byte(metaBucketName)); meta != nil {
+			if cnt := meta.Bucket([]byte(countBucketName)); cnt != nil {
+				if data := cnt.Get(countKey(nameStr)); len(data) == 8 {
+					n = binary.BigEndian.Uint64(data)
+					return nil
+				}
+			}
+		}
+		if bck := tx.Bucket([]byte(nameStr)); bck != nil {
+			if idx := bck.Bucket([]byte{0}); idx != nil {
+				n = countScan(idx)
+			}
+		}
+		return nil
+	})
+	return
+}
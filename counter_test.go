@@ -0,0 +1,104 @@
+package pinion_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"go.etcd.io/bbolt"
+)
+
+// This example tracks the number of stored records as they are written and
+// deleted.
+func ExampleDB_Count() {
+	var db *pinion.DB
+	var err error
+	var n uint64
+	db, err = pinion.Create("example/count.db", 0600, pinion.Options{})
+	if err == nil {
+		q := quantityRec(1)
+		show := func(label string) {
+			if err == nil {
+				n, err = db.Count(&q)
+				fmt.Println(label, n)
+			}
+		}
+		show("empty")
+		for id := uint32(1); id <= 5 && err == nil; id++ {
+			q = quantityRec(id)
+			err = db.PutRec(&q)
+		}
+		show("put")
+		if err == nil {
+			// Replacing a record leaves the count unchanged
+			q = quantityRec(3)
+			err = db.PutRec(&q)
+		}
+		show("replaced")
+		if err == nil {
+			err = db.DeleteRec(&q)
+		}
+		show("deleted")
+		if err == nil {
+			err = db.Truncate(&q)
+		}
+		show("truncated")
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// empty 0
+	// put 5
+	// replaced 5
+	// deleted 4
+	// truncated 0
+}
+
+// Test that the count of records stored without a counter is established
+func TestDB_CountLegacy(t *testing.T) {
+	var db *pinion.DB
+	var bdb *bbolt.DB
+	var err error
+	var n uint64
+	const fileStr = "example/countlegacy.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	for id := uint32(1); id <= 5 && err == nil; id++ {
+		q := quantityRec(id)
+		err = db.PutRec(&q)
+	}
+	if err == nil {
+		db.Close()
+		bdb, err = bbolt.Open(fileStr, 0600, nil)
+	}
+	if err == nil {
+		err = bdb.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket([]byte("\x00pinion")).DeleteBucket([]byte("count"))
+		})
+		bdb.Close()
+	}
+	if err == nil {
+		db, err = pinion.Open(fileStr, 0600, pinion.Options{})
+	}
+	if err == nil {
+		q := quantityRec(2)
+		n, err = db.Count(&q)
+		if err == nil && n != 5 {
+			err = fmt.Errorf("counted %d records, expected 5", n)
+		}
+		if err == nil {
+			err = db.DeleteRec(&q)
+		}
+		if err == nil {
+			n, err = db.Count(&q)
+		}
+		if err == nil && n != 4 {
+			err = fmt.Errorf("count is %d after deletion, expected 4", n)
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+// The Defaulter interface may be implemented by a record type whose values
+// have gained fields since records were first stored. Defaults is called each
+// time a record is read on behalf of the application, immediately after
+// UnmarshalBinary, and should assign default values to fields that were not
+// present in the stored data. Stored records are not modified when they are
+// read; a default becomes permanent when the record is next written. This
+// allows a field to be added without rewriting every stored record. If a
+// default is applied to a key field, the index entries of a stored record
+// still reflect its stored value, so a lookup by the default value does not
+// find the record until it is written again; RewriteAll writes every record
+// of a type.
+type Defaulter interface {
+	Defaults()
+}
+
+// decode populates recPtr from stored data and applies its defaults.
+func decode(recPtr Record, data []byte) (err error) {
+	err = recPtr.UnmarshalBinary(data)
+	if err == nil {
+		if d, ok := recPtr.(Defaulter); ok {
+			d.Defaults()
+		}
+	}
+	return
+}
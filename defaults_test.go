@@ -0,0 +1,106 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// contactRecV1 and contactRecV2 store successive versions of a contact as
+// the same record type. The second version supplies a default for the phone
+// number it adds.
+type contactRecV1 struct {
+	contactV1
+}
+
+type contactRecV2 struct {
+	contactV2
+}
+
+func (c contactRecV1) Name() string {
+	return "contact"
+}
+
+func (c contactRecV1) IndexCount() uint8 {
+	return 1
+}
+
+func (c contactRecV1) New() pinion.Record {
+	return new(contactRecV1)
+}
+
+func (c *contactRecV1) NextID(id uint64) {
+	c.id = uint32(id)
+}
+
+func (c contactRecV1) Key(idx uint8) ([]byte, error) {
+	return store.KeyUint32(c.id), nil
+}
+
+func (c contactRecV2) Name() string {
+	return "contact"
+}
+
+func (c contactRecV2) IndexCount() uint8 {
+	return 1
+}
+
+func (c contactRecV2) New() pinion.Record {
+	return new(contactRecV2)
+}
+
+func (c *contactRecV2) NextID(id uint64) {
+	c.id = uint32(id)
+}
+
+func (c contactRecV2) Key(idx uint8) ([]byte, error) {
+	return store.KeyUint32(c.id), nil
+}
+
+// Defaults implements the pinion.Defaulter interface
+func (c *contactRecV2) Defaults() {
+	if c.phone == "" {
+		c.phone = "unlisted"
+	}
+}
+
+// This example demonstrates defaults applied to records stored before a field
+// was added.
+func ExampleDefaulter() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/defaults.db", 0600, pinion.Options{})
+	if err == nil {
+		for _, name := range []string{"Robert", "Carol"} {
+			if err == nil {
+				err = db.AddRec(&contactRecV1{contactV1{name: name}})
+			}
+		}
+		if err == nil {
+			var c contactRecV2
+			c.id = 2
+			err = db.GetRec(&c, 0)
+			if err == nil {
+				fmt.Println(c.name, c.phone)
+				c.phone = "555-0100"
+				err = db.PutRec(&c)
+			}
+			if err == nil {
+				c = contactRecV2{}
+				err = db.Get(&c, 0, func() bool {
+					fmt.Println(c.name, c.phone)
+					return true
+				})
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Carol unlisted
+	// Robert unlisted
+	// Carol 555-0100
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"go.etcd.io/bbolt"
+)
+
+// The Derivation type registers a derived record type, by means of
+// Options.Derived, whose records are computed from those of a source type.
+// Whenever a source record is stored or deleted, the derived record computed
+// from its previous version, if any, is deleted and the one computed from its
+// new version is stored, all in the same transaction. This keeps projections
+// such as lookup tables current without a separate rebuild. Without Fold,
+// each derived primary key must come from exactly one source record, since
+// a derived record is replaced, not combined, when another source record
+// yields the same key.
+//
+// Summary tables, in which many source records contribute to one derived
+// record, are maintained with Fold. Derive then assigns the primary key of
+// the summary to dst, along with the zero value of the summary fields. If a
+// summary with that key is stored, it is retrieved; otherwise dst is used.
+// Fold is called with the summary, the source record and a sign of -1 to
+// remove the previous version of the source record or +1 to add its new
+// version. The summary is stored if Fold returns true and deleted if it
+// returns false, for example when the last source record has been removed.
+type Derivation struct {
+	// Source and Derived are prototypes of the source and derived record
+	// types. Only their types are used.
+	Source, Derived Record
+	// Derive populates dst, a newly allocated Derived record, from src. It
+	// returns false if src has no derived record. Derive must be a pure
+	// function of src: the same source record must always produce the same
+	// derived primary key so that it can be removed when the source changes.
+	Derive func(src, dst Record) bool
+	// Fold, if not nil, combines src into or removes it from sum, a stored
+	// summary record, as described above.
+	Fold func(sum, src Record, sign int) bool
+}
+
+// derivedApply removes the contribution of src to the records of d's derived
+// type, if sign is -1, or adds it, if sign is +1.
+func derivedApply(d Derivation, bck bucketGrpType, count uint8, src Record, sign int) (err error) {
+	var primaryKey []byte
+	dst := d.Derived.New()
+	if !d.Derive(src, dst) {
+		return
+	}
+	primaryKey, err = dst.Key(0)
+	if err != nil {
+		return
+	}
+	if d.Fold == nil {
+		if sign < 0 {
+			err = bck.recDelete(dst, count, primaryKey)
+		} else {
+			put := idxPutType{bck: bck, recPtr: dst, scratch: dst.New(), count: count}
+			err = put.idxPut()
+		}
+		return
+	}
+	sum := d.Derived.New()
+	var cur valType
+	cur, err = bck.currentGet(sum, count, primaryKey)
+	if err == nil {
+		if cur.data == nil {
+			sum = dst
+		}
+		if d.Fold(sum, src, sign) {
+			put := idxPutType{bck: bck, recPtr: sum, scratch: sum.New(), count: count}
+			err = put.idxPut()
+		} else {
+			err = bck.recDelete(sum.New(), count, primaryKey)
+		}
+	}
+	return
+}
+
+// deriver returns the function that maintains the records derived from the
+// type of recPtr within tx, or nil if no derivations are registered for the
+// type. The returned function is called with the previous and new versions of
+// a source record; either may be nil.
+func (db *DB) deriver(tx *bbolt.Tx, recPtr Record) func(old, new Record) error {
+	var list []Derivation
+	name := recPtr.Name()
+	for _, d := range db.opt.Derived {
+		if d.Source.Name() == name {
+			list = append(list, d)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return func(old, new Record) (err error) {
+		for j := 0; j < len(list) && err == nil; j++ {
+			d := list[j]
+			var bck bucketGrpType
+			count := d.Derived.IndexCount()
+			bck, err = bucketGet(d.Derived, count, true, tx)
+			if err == nil {
+				// Derived types may themselves be sources
+				bck.derive = db.deriver(tx, d.Derived)
+				bck.bloom = db.blooms[d.Derived.Name()]
+				bck.sketch = db.sketched(d.Derived)
+				bck.oversize = db.oversize(d.Derived)
+				if old != nil {
+					err = derivedApply(d, bck, count, old, -1)
+				}
+			}
+			if err == nil && new != nil {
+				err = derivedApply(d, bck, count, new, 1)
+			}
+		}
+		return
+	}
+}
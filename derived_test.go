@@ -0,0 +1,198 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// evenQuantityType holds a copy of each quantity record with an even ID
+type evenQuantityType struct {
+	quantityType
+}
+
+func (e evenQuantityType) Name() string {
+	return "even"
+}
+
+func (e evenQuantityType) New() pinion.Record {
+	return new(evenQuantityType)
+}
+
+// This example demonstrates a derived record type that is kept current as
+// its source records are stored and deleted.
+func ExampleDerivation() {
+	var db *pinion.DB
+	var err error
+	var q quantityType
+	var e evenQuantityType
+	show := func() {
+		var list []uint32
+		if err == nil {
+			e = evenQuantityType{}
+			err = db.Get(&e, 0, func() bool {
+				list = append(list, e.id)
+				return true
+			})
+			fmt.Println(list)
+		}
+	}
+	opt := pinion.Options{Derived: []pinion.Derivation{{
+		Source:  &q,
+		Derived: &e,
+		Derive: func(src, dst pinion.Record) bool {
+			q := src.(*quantityType)
+			if q.id%2 == 0 {
+				dst.(*evenQuantityType).quantityType = *q
+				return true
+			}
+			return false
+		},
+	}}}
+	db, err = pinion.Create("example/derived.db", 0600, opt)
+	if err == nil {
+		id := uint32(1)
+		err = db.Put(&q, func() bool {
+			if id <= 10 {
+				q = quantityRec(id)
+				id++
+				return true
+			}
+			return false
+		})
+		show()
+		if err == nil {
+			q.id = 4
+			err = db.DeleteRec(&q)
+		}
+		if err == nil {
+			n, _ := db.DeleteByPrefixKeys(&q, 0, store.KeyUint32(8))
+			fmt.Printf("%d deleted by key\n", n)
+		}
+		show()
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [2 4 6 8 10]
+	// 1 deleted by key
+	// [2 6 10]
+}
+
+// parityType summarizes the quantity records with odd or even IDs.
+type parityType struct {
+	odd   uint8
+	count uint32
+	total uint32
+}
+
+func (p parityType) MarshalBinary() ([]byte, error) {
+	var put store.PutBuffer
+	put.Uint8(p.odd)
+	put.Uint32(p.count)
+	put.Uint32(p.total)
+	return put.Data()
+}
+
+func (p *parityType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint8(&p.odd)
+	get.Uint32(&p.count)
+	get.Uint32(&p.total)
+	return get.Done()
+}
+
+func (p parityType) Name() string {
+	return "parity"
+}
+
+func (p parityType) IndexCount() uint8 {
+	return 1
+}
+
+func (p parityType) New() pinion.Record {
+	return new(parityType)
+}
+
+func (p *parityType) NextID(id uint64) {}
+
+func (p parityType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	kb.Uint8(p.odd)
+	return kb.Data()
+}
+
+// This example demonstrates a summary table to which many source records
+// contribute.
+func ExampleDerivation_fold() {
+	var db *pinion.DB
+	var err error
+	var q quantityType
+	show := func() {
+		if err == nil {
+			var p parityType
+			err = db.Get(&p, 0, func() bool {
+				fmt.Printf("odd %d: count %d, total %d\n", p.odd, p.count, p.total)
+				return true
+			})
+			fmt.Println("---")
+		}
+	}
+	opt := pinion.Options{Derived: []pinion.Derivation{{
+		Source:  &q,
+		Derived: &parityType{},
+		Derive: func(src, dst pinion.Record) bool {
+			dst.(*parityType).odd = uint8(src.(*quantityType).id % 2)
+			return true
+		},
+		Fold: func(sum, src pinion.Record, sign int) bool {
+			p := sum.(*parityType)
+			id := src.(*quantityType).id
+			if sign > 0 {
+				p.count++
+				p.total += id
+			} else {
+				p.count--
+				p.total -= id
+			}
+			return p.count > 0
+		},
+	}}}
+	db, err = pinion.Create("example/fold.db", 0600, opt)
+	if err == nil {
+		id := uint32(1)
+		err = db.Put(&q, func() bool {
+			q = quantityRec(id)
+			id++
+			return id <= 11
+		})
+		show()
+		if err == nil {
+			id = 1
+			err = db.Delete(&q, func() bool {
+				q = quantityRec(id)
+				id += 2
+				return id <= 11
+			})
+		}
+		if err == nil {
+			// Rewriting a record leaves the summary as it was
+			q = quantityRec(4)
+			err = db.PutRec(&q)
+		}
+		show()
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// odd 0: count 5, total 30
+	// odd 1: count 5, total 25
+	// ---
+	// odd 0: count 5, total 30
+	// ---
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// IndexNamer is an optional interface that a record type can implement to
+// give its indexes descriptive names for reports and diagrams.
+type IndexNamer interface {
+	// Return the name of the index specified by idx.
+	IndexName(idx uint8) string
+}
+
+// Relation declares that the keys of a record's index refer to records of
+// another type, much like a foreign key.
+type Relation struct {
+	// Index is the index of the referring record type.
+	Index uint8
+	// Target is the name of the record type that is referred to.
+	Target string
+}
+
+// Relater is an optional interface that a record type can implement to
+// declare its relations to other record types. pinion does not enforce
+// relations; they are used to document the schema.
+type Relater interface {
+	// Return the relations of the record type.
+	Relations() []Relation
+}
+
+// IndexName returns the name of index idx of recPtr's type, as reported by
+// its IndexNamer implementation, or "index idx" if it does not name the index.
+func IndexName(recPtr Record, idx uint8) (name string) {
+	if namer, ok := recPtr.(IndexNamer); ok {
+		name = namer.IndexName(idx)
+	}
+	if name == "" {
+		name = fmt.Sprintf("index %d", idx)
+	}
+	return
+}
+
+// mermaidID returns str with characters that are not permitted in a Mermaid
+// entity or attribute name replaced with underscores.
+func mermaidID(str string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, str)
+}
+
+// SchemaDiagram writes a diagram of the record types registered with
+// Options.Records to wr. Each record type is shown with its indexes, named
+// with the IndexNamer interface if it is implemented. Relations declared with
+// the Relater interface are drawn as connections between record types. format
+// is either "dot", for Graphviz, or "mermaid".
+func (db *DB) SchemaDiagram(wr io.Writer, format string) (err error) {
+	bw := bufio.NewWriter(wr)
+	switch format {
+	case "dot":
+		fmt.Fprintln(bw, "digraph pinion {")
+		fmt.Fprintln(bw, "\tnode [shape=record];")
+		for _, recPtr := range db.opt.Records {
+			var labels []string
+			for idx := uint8(0); idx < recPtr.IndexCount(); idx++ {
+				labels = append(labels, fmt.Sprintf("<i%d> %d: %s", idx, idx, IndexName(recPtr, idx)))
+			}
+			fmt.Fprintf(bw, "\t%q [label=%q];\n", recPtr.Name(), "{"+recPtr.Name()+"|"+strings.Join(labels, "|")+"}")
+		}
+		for _, recPtr := range db.opt.Records {
+			if rel, ok := recPtr.(Relater); ok {
+				for _, r := range rel.Relations() {
+					fmt.Fprintf(bw, "\t%q:i%d -> %q:i0;\n", recPtr.Name(), r.Index, r.Target)
+				}
+			}
+		}
+		fmt.Fprintln(bw, "}")
+	case "mermaid":
+		fmt.Fprintln(bw, "erDiagram")
+		for _, recPtr := range db.opt.Records {
+			fmt.Fprintf(bw, "\t%s {\n", mermaidID(recPtr.Name()))
+			for idx := uint8(0); idx < recPtr.IndexCount(); idx++ {
+				key := ""
+				if idx == 0 {
+					key = " PK"
+				}
+				fmt.Fprintf(bw, "\t\tindex i%d%s %q\n", idx, key, IndexName(recPtr, idx))
+			}
+			fmt.Fprintln(bw, "\t}")
+		}
+		for _, recPtr := range db.opt.Records {
+			if rel, ok := recPtr.(Relater); ok {
+				for _, r := range rel.Relations() {
+					fmt.Fprintf(bw, "\t%s }o--|| %s : %q\n", mermaidID(recPtr.Name()),
+						mermaidID(r.Target), IndexName(recPtr, r.Index))
+				}
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported diagram format \"%s\"", format)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	return
+}
@@ -0,0 +1,111 @@
+package pinion_test
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// petType is a record that refers to its owner, a personType record, by ID.
+type petType struct {
+	id, ownerID uint16
+	name        string
+}
+
+func (p petType) MarshalBinary() ([]byte, error) {
+	var put store.PutBuffer
+	put.Uint16(p.id)
+	put.Uint16(p.ownerID)
+	put.Str(p.name)
+	return put.Data()
+}
+
+func (p *petType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint16(&p.id)
+	get.Uint16(&p.ownerID)
+	get.Str(&p.name)
+	return get.Done()
+}
+
+func (p petType) Name() string {
+	return "pet"
+}
+
+const (
+	idxPetID = iota
+	idxPetOwner
+	idxPetCount
+)
+
+func (p petType) IndexCount() uint8 {
+	return idxPetCount
+}
+
+func (p petType) IndexName(idx uint8) string {
+	return []string{"ID", "Owner"}[idx]
+}
+
+// Relations implements the pinion.Relater interface.
+func (p petType) Relations() []pinion.Relation {
+	return []pinion.Relation{{Index: idxPetOwner, Target: "person"}}
+}
+
+func (p petType) New() pinion.Record {
+	return new(petType)
+}
+
+func (p *petType) NextID(id uint64) {
+	p.id = uint16(id)
+}
+
+func (p petType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	switch idx {
+	case idxPetID:
+		kb.Uint16(p.id)
+	case idxPetOwner:
+		kb.Uint16(p.ownerID)
+	default:
+		kb.SetError(fmt.Errorf("index %d is out of bounds", idx))
+	}
+	return kb.Data()
+}
+
+// This example documents the registered record types and their relations.
+func ExampleDB_SchemaDiagram() {
+	var db *pinion.DB
+	var err error
+	opt := pinion.Options{Records: []pinion.Record{&personType{}, &petType{}}}
+	db, err = pinion.Create("example/diagram.db", 0600, opt)
+	if err == nil {
+		err = db.SchemaDiagram(os.Stdout, "dot")
+		if err == nil {
+			err = db.SchemaDiagram(os.Stdout, "mermaid")
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// digraph pinion {
+	// 	node [shape=record];
+	// 	"person" [label="{person|<i0> 0: ID|<i1> 1: Last name|<i2> 2: First name}"];
+	// 	"pet" [label="{pet|<i0> 0: ID|<i1> 1: Owner}"];
+	// 	"pet":i1 -> "person":i0;
+	// }
+	// erDiagram
+	// 	person {
+	// 		index i0 PK "ID"
+	// 		index i1 "Last name"
+	// 		index i2 "First name"
+	// 	}
+	// 	pet {
+	// 		index i0 PK "ID"
+	// 		index i1 "Owner"
+	// 	}
+	// 	pet }o--|| person : "Owner"
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+
+	"go.etcd.io/bbolt"
+)
+
+// diffGroup returns the primary key bucket and format bucket of the type named
+// nameStr, or an empty group if the type has not been stored.
+func diffGroup(tx *bbolt.Tx, nameStr string) (bck bucketGrpType, err error) {
+	if bck.rec = tx.Bucket([]byte(nameStr)); bck.rec != nil {
+		bck.idxs = []*bbolt.Bucket{bck.rec.Bucket([]byte{0})}
+		if bck.idxs[0] != nil {
+			bck.format, err = formatBucket(tx, nameStr, false)
+		}
+	}
+	return
+}
+
+// cursor returns a cursor over the primary keys of bck, or nil if it has none.
+func (bck bucketGrpType) cursor() *bbolt.Cursor {
+	if len(bck.idxs) > 0 && bck.idxs[0] != nil {
+		return bck.idxs[0].Cursor()
+	}
+	return nil
+}
+
+// Diff compares the records of recPtr's type stored in a with those stored in
+// b, for example to verify a backup or to detect drift between the databases
+// of two environments. It returns, in primary key order, the primary keys of
+// the records that are stored only in b (added), those stored only in a
+// (removed), and those stored in both with different data (changed). Records
+// whose type implements BinaryMigrator are compared in its current format,
+// so a record is not reported as changed merely because it was stored in an
+// earlier format. A type that has not been stored in one of the databases is
+// treated as having no records there. Either database may be a view or a
+// snapshot; each is read in a single transaction, and types stored in
+// attached databases are compared where they are stored.
+func Diff(a, b *DB, recPtr Record) (added, removed, changed [][]byte, err error) {
+	nameStr := recPtr.Name()
+	a, b = a.owner(recPtr), b.owner(recPtr)
+	err = a.view(func(atx *bbolt.Tx) error {
+		return b.view(func(btx *bbolt.Tx) (err error) {
+			var abck, bbck bucketGrpType
+			abck, err = diffGroup(atx, nameStr)
+			if err == nil {
+				bbck, err = diffGroup(btx, nameStr)
+			}
+			if err != nil {
+				return
+			}
+			var ak, av, bk, bv []byte
+			ac, bc := abck.cursor(), bbck.cursor()
+			if ac != nil {
+				ak, av = ac.First()
+			}
+			if bc != nil {
+				bk, bv = bc.First()
+			}
+			for err == nil && (ak != nil || bk != nil) {
+				switch cmp := bytes.Compare(ak, bk); {
+				case bk == nil || (ak != nil && cmp < 0):
+					removed = append(removed, append([]byte{}, ak...))
+					ak, av = ac.Next()
+				case ak == nil || cmp > 0:
+					added = append(added, append([]byte{}, bk...))
+					bk, bv = bc.Next()
+				default:
+					var adata, bdata []byte
+					adata, err = abck.migrate(recPtr, ak, av)
+					if err == nil {
+						bdata, err = bbck.migrate(recPtr, bk, bv)
+					}
+					if err == nil && !bytes.Equal(adata, bdata) {
+						changed = append(changed, append([]byte{}, ak...))
+					}
+					ak, av = ac.Next()
+					bk, bv = bc.Next()
+				}
+			}
+			return
+		})
+	})
+	return
+}
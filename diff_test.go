@@ -0,0 +1,37 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example compares the records of two databases.
+func ExampleDiff() {
+	var a, b *pinion.DB
+	var err error
+	var added, removed, changed [][]byte
+	a, err = quantityDB("example/diffa.db", 1, 5)
+	if err == nil {
+		b, err = quantityDB("example/diffb.db", 3, 7)
+		if err == nil {
+			q := quantityRec(4)
+			q.val = []byte("four")
+			err = b.PutRec(&q)
+			if err == nil {
+				added, removed, changed, err = pinion.Diff(a, b, &quantityType{})
+			}
+			b.Close()
+		}
+		a.Close()
+	}
+	if err == nil {
+		fmt.Printf("added %x\nremoved %x\nchanged %x\n", added, removed, changed)
+	} else {
+		fmt.Println(err)
+	}
+	// Output:
+	// added [00000006 00000007]
+	// removed [00000001 00000002]
+	// changed [00000004]
+}
@@ -103,6 +103,10 @@ underlying database as byte slices. The piniondb/store package provides support
 for fixed-length key segments. Alternatively, you can use fmt.Sprintf() to
 format fixed-length fields.
 
+If an index is added to a record type after records have been stored, register
+the type with Options.Records so that Open can detect the missing index and,
+with Options.Backfill, build it from the stored records.
+
 Best practices
 
 • Implement the pinion.Record interface in the same location at which the
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Name of the bucket, within the meta bucket, that holds a bucket for each
+// record type with expiring index entries. Keys beginning with
+// expiryEntryPrefix map an index number and entry key to its expiry time;
+// keys beginning with expiryOrderPrefix consist of the expiry time, index
+// number and entry key, so that due entries can be found efficiently.
+const (
+	idxExpiryBucketName = "idxexpiry"
+	expiryEntryPrefix   = 'e'
+	expiryOrderPrefix   = 'o'
+)
+
+// The IndexExpirer interface may be implemented by a record type whose
+// secondary index entries are to be removed some time after they are
+// written while the records themselves are kept. For example, a "recently
+// active" index over an enormous table of accounts can be limited to the
+// accounts active within the past 30 days. IndexExpiry is called whenever a
+// record is stored, and returns the time after which the record's entry in
+// index idx expires, or the zero time if it does not expire. The primary index
+// (idx 0) is never expired.
+//
+// Expired entries are removed by SweepIndexes; until then, they are returned
+// by scans of the index like any other entry. An entry that is written again
+// before it is swept takes on its new expiry time, and the expiry time of an
+// entry is discarded when the entry is removed because its record is deleted
+// or its key changes. For a type that also implements MultiKeyer, every entry
+// of a record in index idx expires at the time returned for idx.
+type IndexExpirer interface {
+	IndexExpiry(idx uint8) time.Time
+}
+
+// expiryBucket returns the bucket that holds the index entry expiry times of
+// the record type named nameStr.
+func expiryBucket(tx *bbolt.Tx, nameStr string, createIfNeeded bool) (bck *bbolt.Bucket, err error) {
+	var meta, exp *bbolt.Bucket
+	if createIfNeeded {
+		meta, err = bucket(tx, metaBucketName, true)
+		if err == nil {
+			exp, err = meta.CreateBucketIfNotExists([]byte(idxExpiryBucketName))
+		}
+		if err == nil {
+			bck, err = exp.CreateBucketIfNotExists([]byte(nameStr))
+		}
+	} else if meta = tx.Bucket([]byte(metaBucketName)); meta != nil {
+		if exp = meta.Bucket([]byte(idxExpiryBucketName)); exp != nil {
+			bck = exp.Bucket([]byte(nameStr))
+		}
+	}
+	return
+}
+
+// expiryRemove removes the expiry time, if any, of entry, an entry key
+// prefixed with expiryEntryPrefix and the index number, from exp.
+func expiryRemove(exp *bbolt.Bucket, entry []byte) (err error) {
+	if prev := exp.Get(entry); prev != nil {
+		err = exp.Delete(concat([]byte{expiryOrderPrefix}, prev, entry[1:]))
+		if err == nil {
+			err = exp.Delete(entry)
+		}
+	}
+	return
+}
+
+// expiryNote records the expiry times of the secondary index entries of val
+// that have just been stored for recPtr. These are the entry keys of val or,
+// for the indexes of a MultiKeyer, its entry sets. The expiry time of an
+// entry that no longer expires is removed.
+func (bck bucketGrpType) expiryNote(recPtr Record, val valType) (err error) {
+	if expirer, ok := recPtr.(IndexExpirer); ok {
+		var exp *bbolt.Bucket
+		for k := 1; k < len(val.keys) && err == nil; k++ {
+			entries := val.keys[k : k+1]
+			if val.keys[k] == nil {
+				entries = nil
+				if k < len(val.sets) {
+					entries = val.sets[k]
+				}
+			}
+			if len(entries) == 0 {
+				continue
+			}
+			tm := expirer.IndexExpiry(uint8(k))
+			if exp == nil {
+				exp, err = expiryBucket(bck.rec.Tx(), recPtr.Name(), !tm.IsZero())
+			}
+			for j := 0; j < len(entries) && err == nil && exp != nil; j++ {
+				entry := concat([]byte{expiryEntryPrefix, uint8(k)}, entries[j])
+				err = expiryRemove(exp, entry)
+				if err == nil && !tm.IsZero() {
+					var when [8]byte
+					binary.BigEndian.PutUint64(when[:], uint64(tm.UnixNano()))
+					err = exp.Put(entry, when[:])
+					if err == nil {
+						err = exp.Put(concat([]byte{expiryOrderPrefix}, when[:], entry[1:]), nil)
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// expiryDrop removes the expiry times of the listed entry keys of secondary
+// index idx of recPtr's type, which are being removed from the index.
+func (bck bucketGrpType) expiryDrop(recPtr Record, idx uint8, entries ...[]byte) (err error) {
+	if _, ok := recPtr.(IndexExpirer); ok && len(entries) > 0 {
+		var exp *bbolt.Bucket
+		exp, err = expiryBucket(bck.rec.Tx(), recPtr.Name(), false)
+		for j := 0; j < len(entries) && err == nil && exp != nil; j++ {
+			if entries[j] != nil {
+				err = expiryRemove(exp, concat([]byte{expiryEntryPrefix, idx}, entries[j]))
+			}
+		}
+	}
+	return
+}
+
+// SweepIndexes removes the secondary index entries of the type pointed to by
+// recPtr whose expiry time, as reported by the IndexExpirer interface when
+// they were written, has passed. The records themselves are not affected.
+// Entries are removed in transactions of at most Options.BatchSize entries,
+// and the number of entries removed is returned. SweepIndexes is typically
+// called periodically by the application.
+func (db *DB) SweepIndexes(recPtr Record) (n int, sweepErr error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.SweepIndexes(recPtr)
+	}
+	loop := true
+	batchSize := db.batchSize()
+	count := recPtr.IndexCount()
+	for loop && sweepErr == nil {
+		sweepErr = db.update(func(tx *bbolt.Tx) (err error) {
+			var exp *bbolt.Bucket
+			var due [][]byte
+			var now [8]byte
+			binary.BigEndian.PutUint64(now[:], uint64(db.now().UnixNano()))
+			loop = false
+			exp, err = expiryBucket(tx, recPtr.Name(), false)
+			if err == nil && exp != nil {
+				crs := exp.Cursor()
+				prefix := []byte{expiryOrderPrefix}
+				for k, _ := crs.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) &&
+					bytes.Compare(k[1:9], now[:]) <= 0; k, _ = crs.Next() {
+					if len(due) == batchSize {
+						loop = true
+						break
+					}
+					due = append(due, concat(k))
+				}
+			}
+			var bck bucketGrpType
+			if len(due) > 0 {
+				bck, err = bucketGet(recPtr, count, false, tx)
+			}
+			for j := 0; j < len(due) && err == nil; j++ {
+				// due[j] holds the prefix, expiry time, index number and entry key
+				idx, key := due[j][9], due[j][10:]
+				entry := concat([]byte{expiryEntryPrefix, idx}, key)
+				err = exp.Delete(due[j])
+				if err == nil && bytes.Equal(exp.Get(entry), due[j][1:9]) {
+					err = exp.Delete(entry)
+					if err == nil && idx < count && bck.idxs[idx].Get(key) != nil {
+						err = bck.idxs[idx].Delete(key)
+						if err == nil {
+							n++
+						}
+					}
+				}
+			}
+			return
+		})
+	}
+	return
+}
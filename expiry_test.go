@@ -0,0 +1,206 @@
+package pinion_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+	"go.etcd.io/bbolt"
+)
+
+// accountType is a record with an index of recently active accounts. Entries
+// of that index expire 30 days after the account's last activity.
+type accountType struct {
+	id     uint32
+	name   string
+	active time.Time
+}
+
+func (a accountType) MarshalBinary() ([]byte, error) {
+	var put store.PutBuffer
+	put.Uint32(a.id)
+	put.Str(a.name)
+	put.Time(a.active)
+	return put.Data()
+}
+
+func (a *accountType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint32(&a.id)
+	get.Str(&a.name)
+	get.Time(&a.active)
+	return get.Done()
+}
+
+func (a accountType) Name() string {
+	return "account"
+}
+
+func (a accountType) IndexCount() uint8 {
+	return 2
+}
+
+func (a accountType) New() pinion.Record {
+	return new(accountType)
+}
+
+func (a *accountType) NextID(id uint64) {
+	a.id = uint32(id)
+}
+
+func (a accountType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	switch idx {
+	case 0:
+		kb.Uint32(a.id)
+	case 1:
+		kb.Time(a.active)
+	}
+	return kb.Data()
+}
+
+// IndexExpiry implements the pinion.IndexExpirer interface
+func (a accountType) IndexExpiry(idx uint8) time.Time {
+	return a.active.AddDate(0, 0, 30)
+}
+
+// This example demonstrates an index that retains only recent entries while
+// the records it refers to are kept.
+func ExampleIndexExpirer() {
+	var db *pinion.DB
+	var err error
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	db, err = pinion.Create("example/expiry.db", 0600, pinion.Options{
+		Clock: func() time.Time { return now },
+	})
+	if err == nil {
+		wdb := db.Wrap()
+		for j, name := range []string{"Carol", "Robert", "Alice"} {
+			wdb.AddRec(&accountType{name: name, active: now.AddDate(0, 0, -20+10*j)})
+		}
+		// Carol becomes active again
+		wdb.PutRec(&accountType{id: 1, name: "Carol", active: now})
+		show := func(label string, idx uint8) {
+			var a accountType
+			fmt.Printf("%s:", label)
+			wdb.Get(&a, idx, func() bool {
+				fmt.Printf(" %s", a.name)
+				return true
+			})
+			fmt.Println()
+		}
+		show("recent", 1)
+		now = now.AddDate(0, 0, 25)
+		var n int
+		n, err = db.SweepIndexes(&accountType{})
+		fmt.Println("swept", n)
+		show("recent", 1)
+		show("all", 0)
+		if err == nil {
+			err = wdb.Error()
+		}
+		if err == nil {
+			err = db.Check(&accountType{})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// recent: Robert Carol Alice
+	// swept 1
+	// recent: Carol Alice
+	// all: Carol Robert Alice
+}
+
+// expiringPostType is a post whose tag entries expire at a fixed time.
+type expiringPostType struct {
+	postType
+}
+
+var postExpiry = time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+
+func (p expiringPostType) New() pinion.Record {
+	return new(expiringPostType)
+}
+
+// IndexExpiry implements the pinion.IndexExpirer interface
+func (p expiringPostType) IndexExpiry(idx uint8) time.Time {
+	return postExpiry
+}
+
+// expiryKeyCount returns the number of keys in the expiry bucket of the named
+// type in the database file at fileStr.
+func expiryKeyCount(fileStr, nameStr string) (n int, err error) {
+	var bdb *bbolt.DB
+	bdb, err = bbolt.Open(fileStr, 0600, nil)
+	if err == nil {
+		err = bdb.View(func(tx *bbolt.Tx) error {
+			if meta := tx.Bucket([]byte("\x00pinion")); meta != nil {
+				if exp := meta.Bucket([]byte("idxexpiry")); exp != nil {
+					if bck := exp.Bucket([]byte(nameStr)); bck != nil {
+						n = bck.Stats().KeyN
+					}
+				}
+			}
+			return nil
+		})
+		bdb.Close()
+	}
+	return
+}
+
+// Test that expiry times are discarded along with their index entries, and
+// that the entries of a multi-entry index expire
+func TestIndexExpirer_Entries(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var n int
+	const fileStr = "example/expiryentries.db"
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{
+		Clock: func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wdb := db.Wrap()
+	for _, name := range []string{"Carol", "Robert", "Alice"} {
+		wdb.AddRec(&accountType{name: name, active: now})
+	}
+	// Carol's entry is replaced and Robert's is removed
+	wdb.PutRec(&accountType{id: 1, name: "Carol", active: now.AddDate(0, 0, 1)})
+	wdb.DeleteRec(&accountType{id: 2})
+	wdb.AddRec(&expiringPostType{postType{title: "Generics", tags: []string{"go", "types"}}})
+	err = wdb.Error()
+	db.Close()
+	if err == nil {
+		// Each entry has an expiry time and an ordering key
+		n, err = expiryKeyCount(fileStr, "account")
+		if err == nil && n != 4 {
+			t.Fatalf("expecting 4 account expiry keys, got %d", n)
+		}
+	}
+	if err == nil {
+		db, err = pinion.Open(fileStr, 0600, pinion.Options{
+			Clock: func() time.Time { return now },
+		})
+	}
+	if err == nil {
+		now = postExpiry.Add(time.Hour)
+		n, err = db.SweepIndexes(&expiringPostType{})
+		if err == nil && n != 2 {
+			t.Fatalf("expecting 2 tag entries to be swept, got %d", n)
+		}
+		if err == nil {
+			err = db.Check(&expiringPostType{})
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// The BinaryMigrator interface may be implemented by a record type whose
+// stored format changes over time, for example when a field is added.
+// FormatVersion returns the version of the format written by the type's
+// MarshalBinary method, and pinion records it with each record stored. When a
+// record written in an earlier format is read, MigrateBinary is called with
+// the version of that format, which is zero for records stored before the
+// type implemented BinaryMigrator, and the stored data. It returns the data
+// in the current format, which is then passed to UnmarshalBinary. Old records
+// are thus upgraded as they are read, without a rewrite of the whole type;
+// the stored data is replaced the next time the record is written, for
+// example by RewriteAll.
+type BinaryMigrator interface {
+	FormatVersion() uint16
+	MigrateBinary(version uint16, data []byte) ([]byte, error)
+}
+
+// Name of the bucket, within the meta bucket, that records the format version
+// of the stored records of each type that implements BinaryMigrator. It
+// contains a bucket for each such type, which maps primary keys to big-endian
+// 16-bit versions.
+const formatBucketName = "format"
+
+// formatBucket returns the format bucket of the type named nameStr, or nil if
+// it does not exist and createIfNeeded is false.
+func formatBucket(tx *bbolt.Tx, nameStr string, createIfNeeded bool) (bck *bbolt.Bucket, err error) {
+	var meta, fmts *bbolt.Bucket
+	if createIfNeeded {
+		meta, err = bucket(tx, metaBucketName, true)
+		if err == nil {
+			fmts, err = meta.CreateBucketIfNotExists([]byte(formatBucketName))
+		}
+		if err == nil {
+			bck, err = fmts.CreateBucketIfNotExists([]byte(nameStr))
+		}
+	} else if meta = tx.Bucket([]byte(metaBucketName)); meta != nil {
+		if fmts = meta.Bucket([]byte(formatBucketName)); fmts != nil {
+			bck = fmts.Bucket([]byte(nameStr))
+		}
+	}
+	return
+}
+
+// migrate returns data, the stored data of the record of recPtr's type with
+// the specified primary key, in the current format of the type.
+func (bck bucketGrpType) migrate(recPtr Record, primaryKey, data []byte) ([]byte, error) {
+	var v []byte
+	if bck.format != nil {
+		v = bck.format.Get(primaryKey)
+	}
+	return migrateVersion(recPtr, primaryKey, v, data)
+}
+
+// migrateVersion returns data, the stored data of the record of recPtr's type
+// with the specified primary key, in the current format of the type. v is
+// the big-endian format version recorded for the record, or nil if none was
+// recorded.
+func migrateVersion(recPtr Record, primaryKey, v, data []byte) ([]byte, error) {
+	m, ok := recPtr.(BinaryMigrator)
+	if !ok || data == nil {
+		return data, nil
+	}
+	var version uint16
+	if len(v) == 2 {
+		version = binary.BigEndian.Uint16(v)
+	}
+	current := m.FormatVersion()
+	if version > current {
+		return nil, fmt.Errorf("%s record %x has format version %d, newer than %d",
+			recPtr.Name(), primaryKey, version, current)
+	}
+	if version < current {
+		return m.MigrateBinary(version, data)
+	}
+	return data, nil
+}
+
+// formatNote records the format version of the record of recPtr's type that
+// has just been stored under primaryKey.
+func (bck bucketGrpType) formatNote(recPtr Record, primaryKey []byte) (err error) {
+	if m, ok := recPtr.(BinaryMigrator); ok && bck.format != nil {
+		var v [2]byte
+		binary.BigEndian.PutUint16(v[:], m.FormatVersion())
+		err = bck.format.Put(primaryKey, v[:])
+	}
+	return
+}
+
+// formatDrop removes the format version of a record that has been deleted.
+func (bck bucketGrpType) formatDrop(primaryKey []byte) (err error) {
+	if bck.format != nil {
+		err = bck.format.Delete(primaryKey)
+	}
+	return
+}
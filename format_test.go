@@ -0,0 +1,156 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// readingOldType is the original form of a temperature reading, stored in
+// whole degrees.
+type readingOldType struct {
+	id      uint32
+	degrees uint16
+}
+
+func (r readingOldType) MarshalBinary() (data []byte, err error) {
+	var put store.PutBuffer
+	put.Uint32(r.id)
+	put.Uint16(r.degrees)
+	return put.Data()
+}
+
+func (r *readingOldType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint32(&r.id)
+	get.Uint16(&r.degrees)
+	return get.Done()
+}
+
+func (r readingOldType) Name() string {
+	return "reading"
+}
+
+func (r readingOldType) IndexCount() uint8 {
+	return 1
+}
+
+func (r readingOldType) New() pinion.Record {
+	return new(readingOldType)
+}
+
+func (r *readingOldType) NextID(id uint64) {}
+
+func (r readingOldType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	kb.Uint32(r.id)
+	return kb.Data()
+}
+
+// readingType is the current form of a temperature reading, stored in tenths
+// of a degree. Readings stored in the original form are converted as they are
+// read.
+type readingType struct {
+	id     uint32
+	tenths uint32
+}
+
+func (r readingType) MarshalBinary() (data []byte, err error) {
+	var put store.PutBuffer
+	put.Uint32(r.id)
+	put.Uint32(r.tenths)
+	return put.Data()
+}
+
+func (r *readingType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint32(&r.id)
+	get.Uint32(&r.tenths)
+	return get.Done()
+}
+
+func (r readingType) Name() string {
+	return "reading"
+}
+
+func (r readingType) IndexCount() uint8 {
+	return 1
+}
+
+func (r readingType) New() pinion.Record {
+	return new(readingType)
+}
+
+func (r *readingType) NextID(id uint64) {}
+
+func (r readingType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	kb.Uint32(r.id)
+	return kb.Data()
+}
+
+// FormatVersion implements the pinion.BinaryMigrator interface
+func (r readingType) FormatVersion() uint16 {
+	return 1
+}
+
+// MigrateBinary implements the pinion.BinaryMigrator interface
+func (r readingType) MigrateBinary(version uint16, data []byte) ([]byte, error) {
+	var old readingOldType
+	err := old.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return readingType{id: old.id, tenths: uint32(old.degrees) * 10}.MarshalBinary()
+}
+
+// This example demonstrates the lazy upgrade of records stored in an earlier
+// format.
+func ExampleBinaryMigrator() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/format.db", 0600, pinion.Options{})
+	if err == nil {
+		for id, deg := range []uint16{18, 21} {
+			if err == nil {
+				err = db.PutRec(&readingOldType{id: uint32(id), degrees: deg})
+			}
+		}
+		if err == nil {
+			err = db.PutRec(&readingType{id: 2, tenths: 195})
+		}
+		var r readingType
+		show := func() {
+			if err == nil {
+				r = readingType{}
+				err = db.Get(&r, 0, func() bool {
+					fmt.Printf("%d: %d.%d\n", r.id, r.tenths/10, r.tenths%10)
+					return true
+				})
+			}
+		}
+		show()
+		if err == nil {
+			var n int
+			n, err = db.RewriteAll(&r)
+			fmt.Println("rewritten", n)
+		}
+		show()
+		if err == nil {
+			err = db.Check(&r)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 0: 18.0
+	// 1: 21.0
+	// 2: 19.5
+	// rewritten 2
+	// 0: 18.0
+	// 1: 21.0
+	// 2: 19.5
+}
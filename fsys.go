@@ -0,0 +1,256 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// SnapshotFS is a read-only fs.FS view of a snapshot of a database. Its root
+// directory holds a directory for each record type that has been stored, named
+// after the type. Each of those holds a file for each stored record, named
+// with the primary key of the record in lower-case hexadecimal, whose content
+// is the record data as stored. Since hexadecimal names sort in the order of
+// the keys, directories list records in primary key order. Record data is
+// neither migrated nor decoded, and secondary indexes are not shown. Types
+// whose names are not valid path elements are omitted. Use DB.FS to create a
+// SnapshotFS.
+type SnapshotFS struct {
+	snap *DB
+}
+
+// FS returns a read-only file system view of db as it is when FS is called.
+// The view is intended for generic tooling, such as archivers, text scanners
+// or http.FileServer, that can operate on an fs.FS. It holds a snapshot of db
+// until it is closed, and is subject to the same constraints; see Snapshot.
+func (db *DB) FS() (fsys *SnapshotFS, err error) {
+	var snap *DB
+	snap, err = db.Snapshot()
+	if err == nil {
+		fsys = &SnapshotFS{snap: snap}
+	}
+	return
+}
+
+// Close releases the snapshot held by fsys. Files opened before Close remain
+// readable; subsequent attempts to open files fail with ErrNotOpen.
+func (fsys *SnapshotFS) Close() error {
+	return fsys.snap.Close()
+}
+
+// fsInfo describes a file or directory of a SnapshotFS. It implements both
+// fs.FileInfo and fs.DirEntry.
+type fsInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi fsInfo) Name() string               { return fi.name }
+func (fi fsInfo) Size() int64                { return fi.size }
+func (fi fsInfo) ModTime() time.Time         { return time.Time{} }
+func (fi fsInfo) IsDir() bool                { return fi.dir }
+func (fi fsInfo) Sys() interface{}           { return nil }
+func (fi fsInfo) Type() fs.FileMode          { return fi.Mode().Type() }
+func (fi fsInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+func (fi fsInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// fsTypeName reports whether the bucket name can appear as a directory of the
+// root of a SnapshotFS.
+func fsTypeName(nameStr string) bool {
+	return nameStr != metaBucketName && fs.ValidPath(nameStr) &&
+		nameStr != "." && !strings.Contains(nameStr, "/")
+}
+
+// fsPrimary returns the primary key bucket of the type named nameStr, or nil
+// if the type is not shown.
+func fsPrimary(tx *bbolt.Tx, nameStr string) *bbolt.Bucket {
+	if fsTypeName(nameStr) {
+		if bck := tx.Bucket([]byte(nameStr)); bck != nil {
+			return bck.Bucket([]byte{0})
+		}
+	}
+	return nil
+}
+
+// lookup returns the description of the named file or directory and, for a
+// file, a copy of its content.
+func (fsys *SnapshotFS) lookup(op, name string) (fi fsInfo, data []byte, err error) {
+	if !fs.ValidPath(name) {
+		return fi, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return fsInfo{name: ".", dir: true}, nil, nil
+	}
+	elems := strings.Split(name, "/")
+	found := false
+	err = fsys.snap.view(func(tx *bbolt.Tx) error {
+		pri := fsPrimary(tx, elems[0])
+		switch {
+		case pri == nil:
+		case len(elems) == 1:
+			fi, found = fsInfo{name: elems[0], dir: true}, true
+		case len(elems) == 2:
+			key, hexErr := hex.DecodeString(elems[1])
+			if hexErr == nil && hex.EncodeToString(key) == elems[1] {
+				if val := pri.Get(key); val != nil {
+					data = append([]byte{}, val...)
+					fi, found = fsInfo{name: elems[1], size: int64(len(val))}, true
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil && !found {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		err = &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return
+}
+
+// entries lists the contents of the named directory in order of name.
+func (fsys *SnapshotFS) entries(op, name string) (list []fs.DirEntry, err error) {
+	err = fsys.snap.view(func(tx *bbolt.Tx) error {
+		if name == "." {
+			return tx.ForEach(func(k []byte, _ *bbolt.Bucket) error {
+				if fsTypeName(string(k)) {
+					list = append(list, fsInfo{name: string(k), dir: true})
+				}
+				return nil
+			})
+		}
+		pri := fsPrimary(tx, name)
+		if pri == nil {
+			return fs.ErrNotExist
+		}
+		return pri.ForEach(func(k, v []byte) error {
+			list = append(list, fsInfo{name: hex.EncodeToString(k), size: int64(len(v))})
+			return nil
+		})
+	})
+	if err != nil {
+		err = &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return
+}
+
+// Open implements fs.FS. The content of a file is copied when it is opened.
+func (fsys *SnapshotFS) Open(name string) (fs.File, error) {
+	fi, data, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.dir {
+		return &fsDir{fsys: fsys, path: name, info: fi}, nil
+	}
+	return &fsFile{Reader: bytes.NewReader(data), info: fi}, nil
+}
+
+// Stat implements fs.StatFS.
+func (fsys *SnapshotFS) Stat(name string) (fs.FileInfo, error) {
+	fi, _, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (fsys *SnapshotFS) ReadFile(name string) ([]byte, error) {
+	fi, data, err := fsys.lookup("readfile", name)
+	if err == nil && fi.dir {
+		err = &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	return data, err
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (fsys *SnapshotFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fi, _, err := fsys.lookup("readdir", name)
+	if err == nil && !fi.dir {
+		err = &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fsys.entries("readdir", name)
+}
+
+// fsFile is an open record file of a SnapshotFS. It supports seeking, as
+// required by http.FileServer.
+type fsFile struct {
+	*bytes.Reader
+	info fsInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *fsFile) Close() error               { return nil }
+
+// fsDir is an open directory of a SnapshotFS. Its entries are listed when
+// first read.
+type fsDir struct {
+	fsys   *SnapshotFS
+	path   string
+	info   fsInfo
+	list   []fs.DirEntry
+	loaded bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *fsDir) ReadDir(n int) (list []fs.DirEntry, err error) {
+	if !d.loaded {
+		d.list, err = d.fsys.entries("readdir", d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.loaded = true
+	}
+	if n <= 0 {
+		list, d.list = d.list, nil
+		return list, nil
+	}
+	if len(d.list) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.list) {
+		n = len(d.list)
+	}
+	list, d.list = d.list[:n], d.list[n:]
+	return list, nil
+}
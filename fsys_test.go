@@ -0,0 +1,85 @@
+package pinion_test
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example walks a file system view of a database.
+func ExampleDB_FS() {
+	var db *pinion.DB
+	var fsys *pinion.SnapshotFS
+	var err error
+	db, err = quantityDB("example/fs.db", 1, 3)
+	if err == nil {
+		fsys, err = db.FS()
+		if err == nil {
+			err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+				if err == nil {
+					fmt.Println(path, d.IsDir())
+				}
+				return err
+			})
+			fsys.Close()
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// . true
+	// quantity true
+	// quantity/00000001 false
+	// quantity/00000002 false
+	// quantity/00000003 false
+}
+
+func TestDB_FS(t *testing.T) {
+	const fileStr = "example/fstest.db"
+	db, err := quantityDB(fileStr, 1, 100)
+	if err == nil {
+		db.Close()
+		opt := pinion.Options{}
+		// Avoid remapping, which waits for read transactions to end
+		opt.BoltOpt.InitialMmapSize = 1 << 24
+		db, err = pinion.Open(fileStr, 0600, opt)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fsys, err := db.FS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Records written after the view is created are not visible
+	q := quantityRec(500)
+	err = db.PutRec(&q)
+	if err == nil {
+		err = fstest.TestFS(fsys, "quantity/00000001", "quantity/00000064")
+	}
+	if err == nil {
+		_, err = fs.Stat(fsys, "quantity/000001f4")
+		if err == nil {
+			t.Fatal("record written after the view was created is visible")
+		}
+		err = nil
+	}
+	if err == nil {
+		err = fsys.Close()
+	}
+	if err == nil {
+		if _, err = fsys.Open("quantity"); err == nil {
+			t.Fatal("view is open after Close")
+		}
+		err = nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding/binary"
+
+	"go.etcd.io/bbolt"
+)
+
+// Name of the bucket, within the meta bucket, that maps the name of each
+// gapless counter to its last value.
+const gaplessBucketName = "gapless"
+
+// NextGapless increments the counter identified by name and returns its new
+// value. The first value of a counter is 1. Counters are independent of
+// record types and of the sequences that supply Add with IDs.
+//
+// Called on a DB, NextGapless commits the increment in a transaction of its
+// own. Called on a Tx in DB.Update, the increment is part of that transaction,
+// so a number is consumed only if the records that use it are committed as
+// well; if the transaction is rolled back, the same number is returned by the
+// next call. This yields the unbroken sequences that are required for numbers
+// such as those of invoices. Since writeable transactions are serialized,
+// concurrent callers never receive the same number.
+func (db *DB) NextGapless(name string) (val uint64, err error) {
+	err = db.update(func(tx *bbolt.Tx) (err error) {
+		var meta, bck *bbolt.Bucket
+		meta, err = bucket(tx, metaBucketName, true)
+		if err == nil {
+			bck, err = meta.CreateBucketIfNotExists([]byte(gaplessBucketName))
+		}
+		if err == nil {
+			var buf [8]byte
+			if data := bck.Get([]byte(name)); len(data) == 8 {
+				val = binary.BigEndian.Uint64(data)
+			}
+			val++
+			binary.BigEndian.PutUint64(buf[:], val)
+			err = bck.Put([]byte(name), buf[:])
+		}
+		return
+	})
+	if err != nil {
+		val = 0
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates the numbering of records without gaps, even when
+// a transaction that consumed a number is rolled back.
+func ExampleDB_NextGapless() {
+	var db *pinion.DB
+	var err error
+	errDeclined := errors.New("payment declined")
+	db, err = pinion.Create("example/gapless.db", 0600, pinion.Options{})
+	if err == nil {
+		for _, declined := range []bool{false, true, false} {
+			err = db.Update(func(tx *pinion.Tx) (err error) {
+				var n uint64
+				n, err = tx.NextGapless("invoice")
+				if err == nil {
+					q := quantityRec(uint32(n))
+					err = tx.PutRec(&q)
+				}
+				if err == nil && declined {
+					err = errDeclined
+				}
+				return
+			})
+			if errors.Is(err, errDeclined) {
+				err = nil
+			}
+		}
+		if err == nil {
+			var q quantityType
+			err = db.Get(&q, idxQuantityID, func() bool {
+				fmt.Println(q)
+				return true
+			})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [          1 : one]
+	// [          2 : two]
+}
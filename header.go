@@ -0,0 +1,270 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	// ErrNotPinion is reported when a bbolt database that was not created by
+	// pinion is opened
+	ErrNotPinion = errors.New("not a pinion database")
+	// ErrVersion is reported when a database was created by a version of
+	// pinion that is newer than this one
+	ErrVersion = errors.New("database requires a newer version of pinion")
+	// ErrUnsupportedFeature is reported when a database uses a capability that
+	// this version of pinion does not support
+	ErrUnsupportedFeature = errors.New("unsupported database feature")
+)
+
+// Feature is a bit that identifies an optional capability, such as a storage
+// format, that has been enabled for a database. Once enabled, a feature is
+// recorded in the database header, and a version of pinion that does not
+// support the feature will refuse to open the database rather than risk
+// misinterpreting or damaging its contents.
+type Feature uint64
+
+// featureNames holds the names of the features supported by this version of
+// pinion. None is defined yet, so a database whose header records any
+// feature is refused.
+var featureNames = map[Feature]string{}
+
+// supportedFeatures returns the set of features supported by this version of
+// pinion.
+func supportedFeatures() (set Feature) {
+	for f := range featureNames {
+		set |= f
+	}
+	return
+}
+
+// metaBucketName is the name of the bucket in which pinion stores information
+// about the database itself. The leading zero byte keeps it from colliding
+// with the name of a record type.
+const metaBucketName = "\x00pinion"
+
+// headerKey identifies the header in the meta bucket
+var headerKey = []byte("header")
+
+// Tags of the header's fields
+const (
+	hdrTagID = iota + 1
+	hdrTagCreated
+	hdrTagVersion
+	hdrTagFeatures
+	hdrTagFeatureNames
+	hdrTagPageSize
+)
+
+// Header identifies a pinion database. It is written when the database is
+// created, or when a database created by an earlier version of pinion is first
+// opened for writing.
+type Header struct {
+	// ID is a random UUID that identifies this database instance. It can be
+	// used to correlate backups with their source.
+	ID string
+	// Created is the time the header was written.
+	Created time.Time
+	// Version is the compatibility level of the database.
+	Version uint16
+	// Features is a set of bits that identifies optional capabilities that
+	// have been enabled for the database.
+	Features Feature
+	// names holds the name of each enabled feature, recorded by the version of
+	// pinion that enabled it, so that an older version can report exactly what
+	// it is missing.
+	names map[Feature]string
+	// PageSize is the size in bytes of the pages of the database file. It is
+	// zero if the header was written by a version of pinion that did not
+	// record it.
+	PageSize int
+}
+
+// FeatureNames returns the names of the features enabled for the database.
+func (hdr Header) FeatureNames() (list []string) {
+	for f := Feature(1); f != 0; f <<= 1 {
+		if hdr.Features&f != 0 {
+			list = append(list, hdr.featureName(f))
+		}
+	}
+	return
+}
+
+// featureName returns the name of feature f.
+func (hdr Header) featureName(f Feature) string {
+	name, ok := hdr.names[f]
+	if !ok {
+		name, ok = featureNames[f]
+		if !ok {
+			name = fmt.Sprintf("feature %#x", uint64(f))
+		}
+	}
+	return name
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (hdr Header) MarshalBinary() ([]byte, error) {
+	var put TagPutBuffer
+	put.Str(hdrTagID, hdr.ID)
+	put.Time(hdrTagCreated, hdr.Created)
+	put.Uint64(hdrTagVersion, uint64(hdr.Version))
+	put.Uint64(hdrTagFeatures, uint64(hdr.Features))
+	put.Uint64(hdrTagPageSize, uint64(hdr.PageSize))
+	var names TagPutBuffer
+	for f := Feature(1); f != 0; f <<= 1 {
+		if hdr.Features&f != 0 {
+			names.Str(uint64(f), hdr.featureName(f))
+		}
+	}
+	data, err := names.Data()
+	put.Bytes(hdrTagFeatureNames, data)
+	put.SetError(err)
+	return put.Data()
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (hdr *Header) UnmarshalBinary(data []byte) error {
+	var version, features, pageSize uint64
+	var names []byte
+	get := NewTagGetBuffer(data)
+	get.Str(hdrTagID, &hdr.ID)
+	get.Time(hdrTagCreated, &hdr.Created)
+	get.Uint64(hdrTagVersion, &version)
+	get.Uint64(hdrTagFeatures, &features)
+	get.Bytes(hdrTagFeatureNames, &names)
+	get.Uint64(hdrTagPageSize, &pageSize)
+	hdr.Version = uint16(version)
+	hdr.PageSize = int(pageSize)
+	hdr.Features = Feature(features)
+	hdr.names = make(map[Feature]string)
+	nameGet := NewTagGetBuffer(names)
+	for f := Feature(1); f != 0; f <<= 1 {
+		if nameGet.Has(uint64(f)) {
+			var name string
+			nameGet.Str(uint64(f), &name)
+			hdr.names[f] = name
+		}
+	}
+	get.SetError(nameGet.Done())
+	return get.Done()
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID(rnd io.Reader) (str string, err error) {
+	var id [16]byte
+	_, err = io.ReadFull(rnd, id[:])
+	if err == nil {
+		id[6] = (id[6] & 0x0f) | 0x40
+		id[8] = (id[8] & 0x3f) | 0x80
+		str = fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+	}
+	return
+}
+
+// legacy returns true if every bucket in the database has the layout of a
+// pinion record type. This identifies databases written before pinion stored
+// a header, including empty ones.
+func legacy(tx *bbolt.Tx) bool {
+	return tx.ForEach(func(name []byte, bck *bbolt.Bucket) error {
+		if bck.Bucket([]byte{0}) == nil {
+			return ErrNotPinion
+		}
+		return nil
+	}) == nil
+}
+
+// headerInit reads the database header, writing one first if the database
+// does not have one yet.
+func (db *DB) headerInit() (err error) {
+	var data []byte
+	var isLegacy bool
+	err = db.view(func(tx *bbolt.Tx) error {
+		data = headerGet(tx)
+		if data == nil {
+			isLegacy = legacy(tx)
+		}
+		return nil
+	})
+	if err == nil {
+		if data != nil {
+			err = db.hdr.UnmarshalBinary(data)
+			if err == nil && db.hdr.Version > Version {
+				err = fmt.Errorf("%w: level %d, supported level %d", ErrVersion, db.hdr.Version, Version)
+			}
+			if err == nil {
+				missing := Header{Features: db.hdr.Features &^ supportedFeatures(), names: db.hdr.names}
+				if missing.Features != 0 {
+					err = fmt.Errorf("%w: %s", ErrUnsupportedFeature, strings.Join(missing.FeatureNames(), ", "))
+				}
+			}
+		} else if !isLegacy {
+			err = ErrNotPinion
+		} else if !db.opt.BoltOpt.ReadOnly {
+			db.hdr.Version = Version
+			db.hdr.Created = db.now().UTC().Round(0)
+			db.hdr.PageSize = db.boltDB.Info().PageSize
+			db.hdr.ID, err = newUUID(db.random())
+			if err == nil {
+				err = db.headerWrite(db.hdr)
+			}
+		}
+	}
+	return
+}
+
+// headerGet returns a copy of the database header stored in tx, or nil if
+// there is none.
+func headerGet(tx *bbolt.Tx) (data []byte) {
+	if bck := tx.Bucket([]byte(metaBucketName)); bck != nil {
+		if data = bck.Get(headerKey); data != nil {
+			data = append([]byte{}, data...)
+		}
+	}
+	return
+}
+
+// headerWrite stores hdr as the database header.
+func (db *DB) headerWrite(hdr Header) error {
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		var bck *bbolt.Bucket
+		var data []byte
+		bck, err = bucket(tx, metaBucketName, true)
+		if err == nil {
+			data, err = hdr.MarshalBinary()
+			if err == nil {
+				err = bck.Put(headerKey, data)
+			}
+		}
+		return
+	})
+}
+
+// Header returns the header that identifies the database. A read-only
+// database created by an earlier version of pinion has no header; in this
+// case, the zero value is returned.
+func (db *DB) Header() Header {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.hdr
+}
@@ -0,0 +1,184 @@
+package pinion_test
+
+import (
+	"errors"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piniondb/pinion"
+	"go.etcd.io/bbolt"
+)
+
+// Test writing and identification of the database header
+func TestDB_Header(t *testing.T) {
+	var db *pinion.DB
+	var bdb *bbolt.DB
+	var err error
+	var hdr pinion.Header
+	const fileStr = "example/header.db"
+	db, err = quantityDB(fileStr, 1, 2)
+	if err == nil {
+		hdr = db.Header()
+		db.Close()
+		if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(hdr.ID) {
+			t.Fatalf("unexpected instance ID %s", hdr.ID)
+		}
+		if hdr.Version != pinion.Version || hdr.Created.IsZero() {
+			t.Fatalf("unexpected header %v", hdr)
+		}
+		db, err = pinion.Open(fileStr, 0600, pinion.Options{})
+		if err == nil {
+			reHdr := db.Header()
+			if reHdr.ID != hdr.ID || !reHdr.Created.Equal(hdr.Created) {
+				t.Fatalf("header changed on reopen")
+			}
+			db.Close()
+		}
+	}
+	if err == nil {
+		// A bbolt database that was not written by pinion is rejected
+		const foreignStr = "example/foreign.db"
+		bdb, err = bbolt.Open(foreignStr, 0600, nil)
+		if err == nil {
+			err = bdb.Update(func(tx *bbolt.Tx) error {
+				bck, err := tx.CreateBucketIfNotExists([]byte("settings"))
+				if err == nil {
+					err = bck.Put([]byte("color"), []byte("blue"))
+				}
+				return err
+			})
+			bdb.Close()
+		}
+		if err == nil {
+			_, err = pinion.Open(foreignStr, 0600, pinion.Options{})
+			if !errors.Is(err, pinion.ErrNotPinion) {
+				t.Fatalf("expecting ErrNotPinion, got %v", err)
+			}
+			err = nil
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test refusal to open a database that uses an unknown feature
+func TestDB_UnsupportedFeature(t *testing.T) {
+	var db *pinion.DB
+	var bdb *bbolt.DB
+	var err error
+	const fileStr = "example/feature.db"
+	db, err = quantityDB(fileStr, 1, 2)
+	if err == nil {
+		hdr := db.Header()
+		db.Close()
+		// Simulate a newer version of pinion enabling a feature
+		hdr.Features |= 1 << 40
+		bdb, err = bbolt.Open(fileStr, 0600, nil)
+		if err == nil {
+			err = bdb.Update(func(tx *bbolt.Tx) error {
+				data, err := hdr.MarshalBinary()
+				if err == nil {
+					err = tx.Bucket([]byte("\x00pinion")).Put([]byte("header"), data)
+				}
+				return err
+			})
+			bdb.Close()
+		}
+	}
+	if err == nil {
+		_, err = pinion.Open(fileStr, 0600, pinion.Options{})
+		if !errors.Is(err, pinion.ErrUnsupportedFeature) {
+			t.Fatalf("expecting ErrUnsupportedFeature, got %v", err)
+		}
+		if !strings.HasSuffix(err.Error(), "feature 0x10000000000") {
+			t.Fatalf("missing feature not named: %v", err)
+		}
+		err = nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test selection and recording of the page size
+func TestDB_PageSize(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/pagesize.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{PageSize: 16384})
+	if err == nil {
+		err = db.PutRec(&quantityType{id: 1})
+		if err == nil && db.Header().PageSize != 16384 {
+			t.Fatalf("expecting page size 16384, got %d", db.Header().PageSize)
+		}
+		db.Close()
+	}
+	if err == nil {
+		// The size of an existing file is not changed
+		db, err = pinion.Open(fileStr, 0600, pinion.Options{PageSize: 4096})
+		if err == nil {
+			if db.Header().PageSize != 16384 {
+				t.Fatalf("expecting page size 16384 on reopen, got %d", db.Header().PageSize)
+			}
+			db.Close()
+		}
+	}
+	if err == nil {
+		_, err = pinion.Create(fileStr, 0600, pinion.Options{PageSize: 3000})
+		if err == nil {
+			t.Fatalf("expecting error for invalid page size")
+		}
+		err = nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test a database created with a controlled clock and random source
+func TestDB_Clock(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var hdrs [2]pinion.Header
+	var applied [3]bool
+	now := time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+	for j := 0; j < 2 && err == nil; j++ {
+		opt := pinion.Options{
+			Clock: func() time.Time { return now },
+			Rand:  rand.New(rand.NewSource(1)),
+		}
+		db, err = pinion.Create("example/clock.db", 0600, opt)
+		if err == nil {
+			hdrs[j] = db.Header()
+			db.Close()
+		}
+	}
+	if err == nil && (hdrs[0].ID != hdrs[1].ID || !hdrs[0].Created.Equal(now)) {
+		t.Fatalf("expecting identical headers created at %s, got %v and %v", now, hdrs[0], hdrs[1])
+	}
+	if err == nil {
+		db, err = pinion.Open("example/clock.db", 0600, pinion.Options{Clock: func() time.Time { return now }})
+		if err == nil {
+			q := quantityRec(1)
+			for j := 0; j < 3 && err == nil; j++ {
+				sent := false
+				applied[j], err = db.PutIdempotent(&q, "token", time.Minute, func() bool {
+					sent = !sent
+					return sent
+				})
+				now = now.Add(40 * time.Second)
+			}
+			db.Close()
+		}
+	}
+	if err == nil && applied != [3]bool{true, false, true} {
+		t.Fatalf("expecting token to expire after one minute, got %v", applied)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
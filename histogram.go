@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"go.etcd.io/bbolt"
+)
+
+// KeyBucket describes one range of a key histogram
+type KeyBucket struct {
+	// First and Last are the smallest and largest keys in the range, or nil if
+	// the range is empty
+	First, Last []byte
+	// Count is the number of keys in the range
+	Count int
+}
+
+// keyPos returns the position of key in the key space as a number formed from
+// up to eight bytes following the first skip bytes.
+func keyPos(key []byte, skip int) uint64 {
+	var buf [8]byte
+	if skip < len(key) {
+		copy(buf[:], key[skip:])
+	}
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+// KeyHistogram returns the distribution of the keys of index idx of the
+// record type of recPtr. The key space between the smallest and largest keys
+// is divided into the specified number of ranges of equal width, and the keys
+// in each range are counted. Widths are determined from the eight bytes that
+// follow the prefix shared by the smallest and largest keys, so the
+// distribution is approximate when keys differ only beyond that point. A
+// range with a disproportionate count reveals a hot prefix; cumulative counts
+// suggest split points for dividing the index into parts of similar size.
+// Keys are read without decoding any records. Keys of secondary indexes
+// include the trailing primary key.
+func (db *DB) KeyHistogram(recPtr Record, idx uint8, buckets int) (list []KeyBucket, getErr error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.KeyHistogram(recPtr, idx, buckets)
+	}
+	count := recPtr.IndexCount()
+	if idx >= count {
+		return nil, fmt.Errorf("index %d too large, must be less than %d", idx, count)
+	}
+	if buckets < 1 {
+		return nil, fmt.Errorf("histogram requires at least one bucket, %d specified", buckets)
+	}
+	list = make([]KeyBucket, buckets)
+	getErr = db.view(func(tx *bbolt.Tx) (err error) {
+		var bck bucketGrpType
+		bck, err = bucketGet(recPtr, count, false, tx)
+		if err == nil {
+			crs := bck.idxs[idx].Cursor()
+			first, _ := crs.First()
+			last, _ := crs.Last()
+			if first != nil {
+				skip := 0
+				for skip < len(first) && skip < len(last) && first[skip] == last[skip] {
+					skip++
+				}
+				lo := keyPos(first, skip)
+				width := (keyPos(last, skip) - lo) / uint64(buckets)
+				if width < math.MaxUint64 {
+					width++
+				}
+				for key, _ := crs.First(); key != nil; key, _ = crs.Next() {
+					pos := (keyPos(key, skip) - lo) / width
+					if pos >= uint64(buckets) {
+						pos = uint64(buckets) - 1
+					}
+					kb := &list[pos]
+					if kb.First == nil {
+						kb.First = concat(key)
+					}
+					kb.Last = key
+					kb.Count++
+				}
+				for j := range list {
+					if list[j].Last != nil {
+						list[j].Last = concat(list[j].Last)
+					}
+				}
+			}
+		}
+		return
+	})
+	if getErr != nil {
+		list = nil
+	}
+	return
+}
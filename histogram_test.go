@@ -0,0 +1,40 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates the distribution of the keys of an index.
+func ExampleDB_KeyHistogram() {
+	var db *pinion.DB
+	var err error
+	var list []pinion.KeyBucket
+	var q quantityType
+	// IDs are clustered at the low end of their range
+	db, err = quantityDB("example/histogram.db", 0, 299)
+	if err == nil {
+		q = quantityRec(999)
+		err = db.PutRec(&q)
+		if err == nil {
+			list, err = db.KeyHistogram(&q, idxQuantityID, 4)
+			for _, kb := range list {
+				if kb.Count > 0 {
+					fmt.Printf("%4d %x .. %x\n", kb.Count, kb.First, kb.Last)
+				} else {
+					fmt.Printf("%4d\n", kb.Count)
+				}
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	//  250 00000000 .. 000000f9
+	//   50 000000fa .. 0000012b
+	//    0
+	//    1 000003e7 .. 000003e7
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding/binary"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Names of the buckets, within the meta bucket, that hold idempotency tokens.
+// The first maps each token to its expiry time; the second orders tokens by
+// expiry so that expired ones can be removed efficiently.
+const (
+	tokenBucketName       = "token"
+	tokenExpiryBucketName = "tokenexpiry"
+)
+
+// idempotentPut is the backing method for AddIdempotent and PutIdempotent.
+func (db *DB) idempotentPut(recPtr Record, token string, ttl time.Duration, f func() bool, add bool) (applied bool, putErr error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.idempotentPut(recPtr, token, ttl, f, add)
+	}
+	putErr = db.update(func(tx *bbolt.Tx) (err error) {
+		var meta, tokens, expiries *bbolt.Bucket
+		var expiry [8]byte
+		now := db.now()
+		applied = false
+		meta, err = bucket(tx, metaBucketName, true)
+		if err == nil {
+			tokens, err = meta.CreateBucketIfNotExists([]byte(tokenBucketName))
+		}
+		if err == nil {
+			expiries, err = meta.CreateBucketIfNotExists([]byte(tokenExpiryBucketName))
+		}
+		if err == nil {
+			// Remove expired tokens
+			var keys [][]byte
+			crs := expiries.Cursor()
+			for key, _ := crs.First(); key != nil && int64(binary.BigEndian.Uint64(key)) <= now.UnixNano(); key, _ = crs.Next() {
+				keys = append(keys, concat(key))
+			}
+			for j := 0; j < len(keys) && err == nil; j++ {
+				err = expiries.Delete(keys[j])
+				if err == nil {
+					err = tokens.Delete(keys[j][8:])
+				}
+			}
+		}
+		if err == nil && tokens.Get([]byte(token)) == nil {
+			put := idxPutType{recPtr: recPtr, count: recPtr.IndexCount()}
+			put.bck, err = bucketGet(recPtr, put.count, true, tx)
+			if err == nil {
+				put.bck.derive = db.deriver(tx, recPtr)
+				put.bck.bloom = db.blooms[recPtr.Name()]
+				put.bck.sketch = db.sketched(recPtr)
+				put.bck.oversize = db.oversize(recPtr)
+				put.scratch = recPtr.New()
+				for err == nil && f() {
+					err = put.next(add)
+				}
+			}
+			if err == nil {
+				binary.BigEndian.PutUint64(expiry[:], uint64(now.Add(ttl).UnixNano()))
+				err = tokens.Put([]byte(token), expiry[:])
+				if err == nil {
+					err = expiries.Put(concat(expiry[:], []byte(token)), nil)
+				}
+			}
+			applied = err == nil
+		}
+		return
+	})
+	if putErr != nil {
+		applied = false
+	}
+	return
+}
+
+// AddIdempotent inserts records like Add, provided that no earlier call has
+// used the same token within the past ttl. This allows a request to be retried
+// safely: if the earlier attempt was committed, the records are not added a
+// second time and no further autoincremented IDs are consumed. applied reports
+// whether the records were stored. f is not called if the token has already
+// been used. Unlike Add, all records are stored in a single transaction along
+// with the token, so each call should be limited to a batch of moderate size.
+// Tokens are removed once they expire.
+func (db *DB) AddIdempotent(recPtr Record, token string, ttl time.Duration, f func() bool) (applied bool, err error) {
+	return db.idempotentPut(recPtr, token, ttl, f, true)
+}
+
+// PutIdempotent stores records like Put with the token semantics of
+// AddIdempotent.
+func (db *DB) PutIdempotent(recPtr Record, token string, ttl time.Duration, f func() bool) (applied bool, err error) {
+	return db.idempotentPut(recPtr, token, ttl, f, false)
+}
@@ -0,0 +1,63 @@
+package pinion_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates the safe retry of a request to add records.
+func ExampleDB_AddIdempotent() {
+	var db *pinion.DB
+	var err error
+	var applied bool
+	var p personType
+	request := func() func() bool {
+		list := []nameType{{last: "Smith", first: "Carol"}, {last: "Jones", first: "Robert"}}
+		return func() bool {
+			if len(list) > 0 {
+				p = personType{name: list[0]}
+				list = list[1:]
+				return true
+			}
+			return false
+		}
+	}
+	db, err = pinion.Create("example/idempotent.db", 0600, pinion.Options{})
+	if err == nil {
+		for j := 0; j < 2 && err == nil; j++ {
+			applied, err = db.AddIdempotent(&p, "request-1", time.Hour, request())
+			fmt.Printf("Attempt %d applied: %v\n", j+1, applied)
+		}
+		if err == nil {
+			// A token that has expired no longer prevents the records from being added
+			applied, err = db.AddIdempotent(&p, "request-2", 0, request())
+			if err == nil {
+				applied, err = db.AddIdempotent(&p, "request-2", 0, request())
+				fmt.Printf("Expired token applied: %v\n", applied)
+			}
+		}
+		if err == nil {
+			p = personType{}
+			err = db.Get(&p, idxPersonID, func() bool {
+				fmt.Println(p)
+				return true
+			})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Attempt 1 applied: true
+	// Attempt 2 applied: false
+	// Expired token applied: true
+	// Carol  Smith / 1
+	// Robert  Jones / 2
+	// Carol  Smith / 3
+	// Robert  Jones / 4
+	// Carol  Smith / 5
+	// Robert  Jones / 6
+}
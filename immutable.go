@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+// The Immutable interface may be implemented by a record type whose records,
+// once stored, are never to be changed, such as the events of an
+// event-sourcing table. If Immutable returns true, storing a record whose
+// primary key is already present fails with ErrImmutable, as do Delete,
+// DeleteRec, DeleteByPrefixKeys and moving the record to another type with
+// Move. Records can be added freely, and ForceDelete removes them when that
+// is really intended, for example to enforce a retention period.
+type Immutable interface {
+	Immutable() bool
+}
+
+// immutable reports whether the records of recPtr's type may not be changed.
+func immutable(recPtr Record) bool {
+	im, ok := recPtr.(Immutable)
+	return ok && im.Immutable()
+}
+
+// ForceDelete functions like Delete except that records of a type that
+// implements the Immutable interface are deleted as well.
+func (db *DB) ForceDelete(recPtr Record, f func() bool) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.ForceDelete(recPtr, f)
+	}
+	return db.recsDelete(recPtr, f)
+}
@@ -0,0 +1,70 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// eventQuantityType is a quantity record that is stored once and never
+// changed.
+type eventQuantityType struct {
+	quantityType
+}
+
+func (e eventQuantityType) Name() string {
+	return "event"
+}
+
+func (e eventQuantityType) New() pinion.Record {
+	return new(eventQuantityType)
+}
+
+// Immutable implements the pinion.Immutable interface
+func (e eventQuantityType) Immutable() bool {
+	return true
+}
+
+// This example demonstrates an append-only record type.
+func ExampleImmutable() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/immutable.db", 0600, pinion.Options{})
+	if err == nil {
+		for _, id := range []uint32{1, 2, 1} {
+			e := eventQuantityType{quantityRec(id)}
+			err = db.PutRec(&e)
+			fmt.Println("put", id, errors.Is(err, pinion.ErrImmutable))
+		}
+		e := eventQuantityType{quantityRec(2)}
+		err = db.DeleteRec(&e)
+		fmt.Println("delete", errors.Is(err, pinion.ErrImmutable))
+		// Remove the first event only
+		e = eventQuantityType{quantityRec(1)}
+		first := true
+		err = db.ForceDelete(&e, func() bool {
+			ok := first
+			first = false
+			return ok
+		})
+		if err == nil {
+			var list []uint32
+			err = db.Get(&e, 0, func() bool {
+				list = append(list, e.id)
+				return true
+			})
+			fmt.Println("remaining", list)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// put 1 false
+	// put 2 false
+	// put 1 true
+	// delete true
+	// remaining [2]
+}
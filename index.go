@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// missingIndexes returns the indexes of recPtr's type that have no subbucket
+// even though records of the type have been stored.
+func missingIndexes(tx *bbolt.Tx, recPtr Record) (list []uint8) {
+	bck := tx.Bucket([]byte(recPtr.Name()))
+	if bck != nil && bck.Bucket([]byte{0}) != nil {
+		for j := uint8(1); j < recPtr.IndexCount(); j++ {
+			if bck.Bucket([]byte{j}) == nil {
+				list = append(list, j)
+			}
+		}
+	}
+	return
+}
+
+// indexBuild populates the listed secondary indexes of recPtr's type from the
+// stored records. The indexes are built in a single transaction so that an
+// interrupted build leaves them missing rather than incomplete.
+func (db *DB) indexBuild(recPtr Record, list []uint8) error {
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		var bck bucketGrpType
+		count := recPtr.IndexCount()
+		nameStr := recPtr.Name()
+		bck.rec, err = bucket(tx, nameStr, false)
+		if err == nil {
+			bck.idxs = make([]*bbolt.Bucket, count)
+			for j := uint8(0); j < count && err == nil; j++ {
+				bck.idxs[j], err = subbucket(bck.rec, nameStr, j, true)
+			}
+		}
+		if err == nil {
+			bck.format, err = formatBucket(tx, nameStr, false)
+		}
+		if err == nil {
+			err = bck.indexFill(recPtr, count, list)
+		}
+		return
+	})
+}
+
+// indexFill adds the entries of the stored records to the listed secondary
+// indexes, which are expected to be empty.
+func (bck bucketGrpType) indexFill(recPtr Record, count uint8, list []uint8) error {
+	scratch := recPtr.New()
+	keys := make([][]byte, count)
+	return bck.idxs[0].ForEach(func(k, v []byte) error {
+		return bck.indexRec(scratch, keys, list, k, v)
+	})
+}
+
+// indexRec adds the entries of the record with primary key k and data v to
+// the listed secondary indexes. scratch is used to decode the record and keys
+// to collect its entry keys.
+func (bck bucketGrpType) indexRec(scratch Record, keys [][]byte, list []uint8, k, v []byte) (err error) {
+	var key []byte
+	var set [][]byte
+	val := valType{keys: keys}
+	v, err = bck.migrate(scratch, k, v)
+	if err == nil {
+		err = scratch.UnmarshalBinary(v)
+	}
+	for _, j := range list {
+		set, keys[j] = nil, nil
+		if err == nil && indexed(scratch, j) {
+			if mk, ok := scratch.(MultiKeyer); ok {
+				set, err = entrySet(mk, j, k)
+				if val.sets == nil {
+					val.sets = make([][][]byte, len(keys))
+				}
+				val.sets[j] = set
+			} else {
+				key, err = scratch.Key(j)
+				keys[j] = entryKey(key, k)
+				set = [][]byte{keys[j]}
+			}
+		}
+		for _, entry := range set {
+			if err == nil && entry != nil {
+				err = bck.idxs[j].Put(entry, k)
+			}
+		}
+	}
+	if err == nil {
+		err = bck.expiryNote(scratch, val)
+	}
+	return
+}
+
+// Reindex builds the secondary indexes of recPtr's type that are missing
+// because IndexCount() has grown since records of the type were stored, and
+// returns their numbers. Open does this for the types registered with
+// Options.Records when Options.Backfill is set, and any operation that writes
+// records of the type does it for that type, so Reindex is needed only to
+// query an unregistered type that has not yet been written. The indexes are
+// built in a single transaction. Only the type of recPtr is used.
+func (db *DB) Reindex(recPtr Record) (list []uint8, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.Reindex(recPtr)
+	}
+	err = db.view(func(tx *bbolt.Tx) error {
+		list = missingIndexes(tx, recPtr)
+		return nil
+	})
+	if err == nil && len(list) > 0 {
+		err = db.indexBuild(recPtr, list)
+	}
+	if err != nil {
+		list = nil
+	}
+	return
+}
+
+// RebuildIndexes discards every secondary index of recPtr's type and builds
+// it again from the stored records. This is a recovery path for indexes that
+// have been corrupted or that no longer match the keys produced by the type's
+// Key method after a change to it. The indexes are emptied in one transaction
+// and then filled in primary key order in transactions of at most
+// Options.BatchSize records, so queries by secondary index that run
+// concurrently may see incomplete results. If the rebuild is interrupted,
+// calling RebuildIndexes again completes it. The expiry times noted for
+// IndexExpirer entries are rebuilt as well; sketches (see ApproxDistinct) are
+// kept. Only the type of recPtr is used.
+func (db *DB) RebuildIndexes(recPtr Record) (err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.RebuildIndexes(recPtr)
+	}
+	var list []uint8
+	count := recPtr.IndexCount()
+	nameStr := recPtr.Name()
+	for j := uint8(1); j < count; j++ {
+		list = append(list, j)
+	}
+	if len(list) == 0 {
+		return
+	}
+	err = db.update(func(tx *bbolt.Tx) (err error) {
+		var bck, exp *bbolt.Bucket
+		bck, err = bucket(tx, nameStr, false)
+		for j := 0; j < len(list) && err == nil; j++ {
+			key := []byte{list[j]}
+			if bck.Bucket(key) != nil {
+				err = bck.DeleteBucket(key)
+			}
+			if err == nil {
+				_, err = bck.CreateBucket(key)
+			}
+		}
+		if err == nil {
+			exp, err = expiryBucket(tx, nameStr, false)
+		}
+		if err == nil && exp != nil {
+			meta := tx.Bucket([]byte(metaBucketName))
+			err = meta.Bucket([]byte(idxExpiryBucketName)).DeleteBucket([]byte(nameStr))
+		}
+		return
+	})
+	var after []byte
+	loop := true
+	batchSize := db.batchSize()
+	for loop && err == nil {
+		err = db.update(func(tx *bbolt.Tx) (err error) {
+			var bck bucketGrpType
+			bck, err = bucketGet(recPtr, count, false, tx)
+			if err == nil {
+				var n int
+				scratch := recPtr.New()
+				keys := make([][]byte, count)
+				c := bck.idxs[0].Cursor()
+				k, v := c.First()
+				if after != nil {
+					k, v = c.Seek(after)
+					if k != nil && bytes.Equal(k, after) {
+						k, v = c.Next()
+					}
+				}
+				for ; k != nil && n < batchSize && err == nil; k, v = c.Next() {
+					err = bck.indexRec(scratch, keys, list, k, v)
+					after = append(after[:0], k...)
+					n++
+				}
+				loop = k != nil
+			}
+			return
+		})
+	}
+	return
+}
+
+// backfill checks the registered record types for missing indexes. If
+// permitted by the options, the missing indexes are built; otherwise an error
+// naming them is returned.
+func (db *DB) backfill() (err error) {
+	var names []string
+	missing := make([][]uint8, len(db.opt.Records))
+	err = db.view(func(tx *bbolt.Tx) error {
+		for j, recPtr := range db.opt.Records {
+			missing[j] = missingIndexes(tx, recPtr)
+			for _, idx := range missing[j] {
+				names = append(names, fmt.Sprintf("%s/%d", recPtr.Name(), idx))
+			}
+		}
+		return nil
+	})
+	if err == nil && len(names) > 0 {
+		if db.opt.Backfill {
+			for j := 0; j < len(missing) && err == nil; j++ {
+				if len(missing[j]) > 0 {
+					err = db.indexBuild(db.opt.Records[j], missing[j])
+				}
+			}
+		} else {
+			err = fmt.Errorf("%w: %s", ErrIndexBackfill, strings.Join(names, ", "))
+		}
+	}
+	return
+}
+
+// DropIndex removes the subbucket of secondary index idx of recPtr's type,
+// along with any expiry times and sketch kept for it. The index must no
+// longer be declared, that is, idx must not be less than recPtr.IndexCount();
+// otherwise ErrIndexDeclared is returned. This reclaims the space used by an
+// index that has been removed from the type. Once no index beyond those
+// declared remains, the type registry accepts the smaller index count (see
+// RegisterType). Only the type of recPtr is used.
+func (db *DB) DropIndex(recPtr Record, idx uint8) (err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.DropIndex(recPtr, idx)
+	}
+	nameStr := recPtr.Name()
+	if idx < recPtr.IndexCount() {
+		return fmt.Errorf("%w: %s/%d", ErrIndexDeclared, nameStr, idx)
+	}
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		var bck, exp *bbolt.Bucket
+		bck, err = bucket(tx, nameStr, false)
+		if err == nil {
+			err = bck.DeleteBucket([]byte{idx})
+			if err != nil {
+				err = fmt.Errorf("index %d of %s: %w", idx, nameStr, err)
+			}
+		}
+		if err == nil {
+			err = registryDrop(tx, bck, nameStr, recPtr.IndexCount())
+		}
+		if err == nil {
+			exp, err = expiryBucket(tx, nameStr, false)
+		}
+		if err == nil && exp != nil {
+			var entries [][]byte
+			prefix := []byte{expiryEntryPrefix, idx}
+			c := exp.Cursor()
+			for k, _ := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				entries = append(entries, concat(k))
+			}
+			for j := 0; j < len(entries) && err == nil; j++ {
+				err = exp.Delete(concat([]byte{expiryOrderPrefix}, exp.Get(entries[j]), entries[j][1:]))
+				if err == nil {
+					err = exp.Delete(entries[j])
+				}
+			}
+		}
+		if err == nil {
+			var sk *bbolt.Bucket
+			sk, err = sketchBucket(tx, nameStr, idx, false)
+			if err == nil && sk != nil {
+				// The sketch exists, so its parent buckets do as well
+				meta := tx.Bucket([]byte(metaBucketName))
+				err = meta.Bucket([]byte(sketchBucketName)).Bucket([]byte(nameStr)).DeleteBucket([]byte{idx})
+			}
+		}
+		return
+	})
+}
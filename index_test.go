@@ -0,0 +1,227 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// idQuantityType is an earlier version of quantityType that lacks the English
+// word index.
+type idQuantityType struct {
+	quantityType
+}
+
+func (i idQuantityType) IndexCount() uint8 {
+	return 1
+}
+
+func (i idQuantityType) New() pinion.Record {
+	return new(idQuantityType)
+}
+
+// Test detection and backfill of an index added after records were stored
+func TestDB_Backfill(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var q quantityType
+	var list []string
+	const fileStr = "example/backfill.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	if err == nil {
+		for _, id := range []uint32{3, 1, 2} {
+			i := idQuantityType{quantityRec(id)}
+			if err == nil {
+				err = db.PutRec(&i)
+			}
+		}
+		db.Close()
+	}
+	if err == nil {
+		opt := pinion.Options{Records: []pinion.Record{&q}}
+		_, err = pinion.Open(fileStr, 0600, opt)
+		if !errors.Is(err, pinion.ErrIndexBackfill) {
+			t.Fatalf("expecting backfill error, got %v", err)
+		}
+		opt.Backfill = true
+		db, err = pinion.Open(fileStr, 0600, opt)
+		if err == nil {
+			err = db.Get(&q, idxQuantityVal, func() bool {
+				list = append(list, q.String())
+				return true
+			})
+			db.Close()
+		}
+	}
+	if err == nil {
+		str := fmt.Sprint(list)
+		if str != "[[          1 : one] [          3 : three] [          2 : two]]" {
+			t.Fatalf("unexpected backfilled index %s", str)
+		}
+		// The index is now present; no backfill is needed
+		db, err = pinion.Open(fileStr, 0600, pinion.Options{Records: []pinion.Record{&q}})
+		if err == nil {
+			db.Close()
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test that an index added to an unregistered type is built by Reindex or by
+// the first write of the type
+func TestDB_Reindex(t *testing.T) {
+	const fileStr = "example/reindex.db"
+	show := func(db *pinion.DB) string {
+		var q quantityType
+		var list []uint32
+		err := db.Get(&q, idxQuantityVal, func() bool {
+			list = append(list, q.id)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(list)
+	}
+	for _, write := range []bool{false, true} {
+		db, err := pinion.Create(fileStr, 0600, pinion.Options{})
+		for _, id := range []uint32{3, 1, 2} {
+			if err == nil {
+				i := idQuantityType{quantityRec(id)}
+				err = db.PutRec(&i)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var built []uint8
+		if write {
+			q := quantityRec(8)
+			err = db.PutRec(&q)
+		} else {
+			built, err = db.Reindex(&quantityType{})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str := fmt.Sprintf("%v %s", built, show(db)); str != map[bool]string{
+			false: "[1] [1 3 2]",
+			true:  "[] [8 1 3 2]",
+		}[write] {
+			t.Fatalf("unexpected index %s", str)
+		}
+		if err = db.Check(&quantityType{}); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+	}
+}
+
+// Test removal of an index that is no longer declared by its type
+func TestDB_DropIndex(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var built []uint8
+	const fileStr = "example/dropindex.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	for _, id := range []uint32{3, 1, 2} {
+		if err == nil {
+			q := quantityRec(id)
+			err = db.PutRec(&q)
+		}
+	}
+	if err == nil {
+		err = db.DropIndex(&quantityType{}, idxQuantityVal)
+		if !errors.Is(err, pinion.ErrIndexDeclared) {
+			t.Fatalf("expecting declared index error, got %v", err)
+		}
+		// The stale index is reported until it is dropped
+		err = db.Check(&idQuantityType{})
+		if !errors.Is(err, pinion.ErrSchemaMismatch) {
+			t.Fatalf("expecting schema mismatch, got %v", err)
+		}
+		err = db.DropIndex(&idQuantityType{}, idxQuantityVal)
+	}
+	if err == nil {
+		if db.DropIndex(&idQuantityType{}, idxQuantityVal) == nil {
+			t.Fatalf("expecting error dropping missing index")
+		}
+		err = db.Check(&idQuantityType{})
+	}
+	if err == nil {
+		// Declaring the index again requires it to be rebuilt
+		built, err = db.Reindex(&quantityType{})
+	}
+	if err == nil {
+		if str := fmt.Sprint(built); str != "[1]" {
+			t.Fatalf("unexpected rebuilt indexes %s", str)
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// descQuantityType is a later version of quantityType whose second index
+// orders records by descending ID.
+type descQuantityType struct {
+	quantityType
+}
+
+func (d descQuantityType) Key(idx uint8) ([]byte, error) {
+	if idx == idxQuantityVal {
+		var kb store.KeyBuffer
+		kb.Uint32(^d.id)
+		return kb.Data()
+	}
+	return d.quantityType.Key(idx)
+}
+
+func (d descQuantityType) New() pinion.Record {
+	return new(descQuantityType)
+}
+
+// Test regeneration of an index after a change to the type's Key method
+func TestDB_RebuildIndexes(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var list []uint32
+	const fileStr = "example/rebuild.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{BatchSize: 2})
+	for _, id := range []uint32{3, 1, 4, 2, 5} {
+		if err == nil {
+			q := quantityRec(id)
+			err = db.PutRec(&q)
+		}
+	}
+	if err == nil {
+		if db.Check(&descQuantityType{}) == nil {
+			t.Fatalf("expecting check of changed index to fail")
+		}
+		err = db.RebuildIndexes(&descQuantityType{})
+	}
+	if err == nil {
+		err = db.Check(&descQuantityType{})
+	}
+	if err == nil {
+		// The initial record determines the first key of the scan
+		d := descQuantityType{quantityType{id: ^uint32(0)}}
+		err = db.Get(&d, idxQuantityVal, func() bool {
+			list = append(list, d.id)
+			return true
+		})
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := fmt.Sprint(list); str != "[5 4 3 2 1]" {
+		t.Fatalf("unexpected rebuilt index %s", str)
+	}
+}
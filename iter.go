@@ -0,0 +1,67 @@
+//go:build go1.23
+
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"iter"
+)
+
+// Records returns an iterator over the records that Get would pass to its
+// callback, for use with a range statement:
+//
+//	for rec, err := range db.Records(&q, idx) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// Each record is read into the variable pointed to by recPtr, which is also
+// the Record yielded; its initial value determines the first record, as with
+// Get. If an error occurs, it is yielded with a nil Record and the iteration
+// ends. The loop body runs within a read transaction, so it must not write to
+// the database.
+func (db *DB) Records(recPtr Record, idx uint8) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		stopped := false
+		err := db.Get(recPtr, idx, func() bool {
+			stopped = !yield(recPtr, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
+
+// Records returns an iterator over the records that Get would pass to its
+// callback. The record yielded is overwritten by the next one; copy it to
+// retain it. See DB.Records.
+func (c Collection[T, P]) Records(start T, idx uint8) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		stopped := false
+		err := c.Get(start, idx, func(rec *T) bool {
+			stopped = !yield(rec, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build go1.23
+
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates iteration over records with a range statement.
+func ExampleDB_Records() {
+	var db *pinion.DB
+	var err error
+	db, err = quantityDB("example/all.db", 1, 100)
+	if err == nil {
+		q := quantityType{id: 40}
+		for rec, recErr := range db.Records(&q, idxQuantityID) {
+			if recErr != nil {
+				err = recErr
+				break
+			}
+			fmt.Println(rec)
+			if q.id == 42 {
+				break
+			}
+		}
+		if err == nil {
+			for q, recErr := range pinion.Of[quantityType](db).Records(quantityType{}, idxQuantityVal) {
+				if recErr != nil {
+					err = recErr
+					break
+				}
+				fmt.Println(q)
+				if q.id == 18 {
+					break
+				}
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [         40 : forty]
+	// [         41 : forty one]
+	// [         42 : forty two]
+	// [          8 : eight]
+	// [         18 : eighteen]
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// KeySegmenter is an optional interface that a record type can implement to
+// describe the fields that make up its index keys. It is used by ExportKeys.
+type KeySegmenter interface {
+	// Return a readable rendering of each field packed into key, which
+	// belongs to index idx. A nil return indicates that key cannot be
+	// decoded.
+	KeySegments(idx uint8, key []byte) []string
+}
+
+// ExportKeys writes one line to w for each entry of index idx of the type
+// pointed to by recPtr, in index order. A line consists of the key in
+// hexadecimal, the decoded fields of the key if the record type implements
+// KeySegmenter, and the primary key of the referenced record in hexadecimal,
+// separated by tabs. Records are not read, so the output reveals only what is
+// in the keys themselves. This allows the ordering of a database to be
+// compared with the expected ordering without access to its data. The record
+// pointed to by recPtr is used only to determine the first entry.
+func (db *DB) ExportKeys(recPtr Record, idx uint8, w io.Writer) (err error) {
+	segmenter, _ := recPtr.(KeySegmenter)
+	getErr := db.GetKeys(recPtr, idx, func(key, primaryKey []byte) bool {
+		var segs []string
+		if segmenter != nil {
+			segs = segmenter.KeySegments(idx, key)
+		}
+		_, err = fmt.Fprintf(w, "%x\t%s\t%x\n", key, strings.Join(segs, " "), primaryKey)
+		return err == nil
+	})
+	if err == nil {
+		err = getErr
+	}
+	return
+}
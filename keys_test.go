@@ -0,0 +1,43 @@
+package pinion_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/piniondb/str"
+)
+
+// KeySegments implements the pinion.KeySegmenter interface.
+func (q quantityType) KeySegments(idx uint8, key []byte) []string {
+	switch idx {
+	case idxQuantityID:
+		var id uint32
+		for _, b := range key {
+			id = id<<8 | uint32(b)
+		}
+		return []string{intStr(id)}
+	case idxQuantityVal:
+		return []string{str.QuantityDecode(bytes.TrimRight(key, "\x00"))}
+	}
+	return nil
+}
+
+// This example demonstrates the export of index keys for comparison with an
+// expected ordering.
+func ExampleDB_ExportKeys() {
+	db, err := quantityDB("example/keys.db", 8, 12)
+	if err == nil {
+		err = db.ExportKeys(&quantityType{}, idxQuantityVal, os.Stdout)
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 010000000000000000000000	eight	00000008
+	// 040000000000000000000000	eleven	0000000b
+	// 0d0000000000000000000000	nine	00000009
+	// 180000000000000000000000	ten	0000000a
+	// 1d0000000000000000000000	twelve	0000000c
+}
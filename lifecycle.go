@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"fmt"
+)
+
+// The OpenHook interface may be implemented by a record type registered with
+// Options.Records. OnOpen is called when a database is opened, after its
+// indexes have been checked, so that a subsystem built on the type can
+// prepare itself, for example by warming a cache, verifying stored records or
+// starting a background task. If it returns an error, the database is closed
+// and Open fails with that error.
+type OpenHook interface {
+	OnOpen(db *DB) error
+}
+
+// The CloseHook interface may be implemented by a record type registered with
+// Options.Records. OnClose is called when the database is closed, before its
+// file is released, so that work begun by OnOpen can be stopped.
+type CloseHook interface {
+	OnClose(db *DB)
+}
+
+// lifecycleOpen calls the OnOpen method of each registered record type that
+// implements OpenHook, in order of registration. If one fails, the OnClose
+// methods of the types already opened are called.
+func (db *DB) lifecycleOpen() (err error) {
+	for j, recPtr := range db.opt.Records {
+		if hook, ok := recPtr.(OpenHook); ok {
+			err = hook.OnOpen(db)
+			if err != nil {
+				db.lifecycleClose(j)
+				return fmt.Errorf("opening record type %s: %w", recPtr.Name(), err)
+			}
+		}
+	}
+	return
+}
+
+// lifecycleClose calls the OnClose method of each of the first count
+// registered record types that implements CloseHook, in reverse order of
+// registration.
+func (db *DB) lifecycleClose(count int) {
+	for j := count - 1; j >= 0; j-- {
+		if hook, ok := db.opt.Records[j].(CloseHook); ok {
+			hook.OnClose(db)
+		}
+	}
+}
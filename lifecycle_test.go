@@ -0,0 +1,69 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// trackedQuantityType reports when the databases holding it are opened and
+// closed
+type trackedQuantityType struct {
+	quantityType
+}
+
+func (t trackedQuantityType) Name() string {
+	return "tracked"
+}
+
+func (t trackedQuantityType) New() pinion.Record {
+	return new(trackedQuantityType)
+}
+
+var errTrackedRefused = errors.New("refused")
+
+func (t trackedQuantityType) OnOpen(db *pinion.DB) (err error) {
+	var found bool
+	rec := trackedQuantityType{quantityType{id: 3}}
+	found, err = db.Exists(&rec, idxQuantityID)
+	fmt.Printf("open: record 3 stored: %v\n", found)
+	if err == nil && found {
+		err = errTrackedRefused
+	}
+	return
+}
+
+func (t trackedQuantityType) OnClose(db *pinion.DB) {
+	fmt.Println("close")
+}
+
+// This example demonstrates a record type that is notified when a database
+// is opened and closed.
+func ExampleOpenHook() {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/lifecycle.db"
+	opt := pinion.Options{Records: []pinion.Record{&trackedQuantityType{}}}
+	db, err = pinion.Create(fileStr, 0600, opt)
+	if err == nil {
+		for id := uint32(1); id <= 3 && err == nil; id++ {
+			rec := trackedQuantityType{quantityRec(id)}
+			err = db.PutRec(&rec)
+		}
+		db.Close()
+	}
+	if err == nil {
+		_, err = pinion.Open(fileStr, 0600, opt)
+		fmt.Println(err)
+		err = nil
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// open: record 3 stored: false
+	// close
+	// open: record 3 stored: true
+	// opening record type tracked: refused
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrLocked is reported when a database file cannot be opened because it is
+// in use by another process
+var ErrLocked = errors.New("database is locked by another process")
+
+// inUse returns true if err indicates that the database file is locked or
+// temporarily inaccessible because another process is using it.
+func inUse(err error) bool {
+	return errors.Is(err, ErrLocked) || errors.Is(err, bbolt.ErrTimeout) || sharingViolation(err)
+}
+
+// retry calls fn until it succeeds, it fails for a reason other than the
+// database file being in use, or the number of retries specified in options
+// has been exhausted.
+func retry(options Options, fn func() error) (err error) {
+	delay := options.OpenRetryDelay
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	err = fn()
+	for j := 0; j < options.OpenRetries && err != nil && inUse(err); j++ {
+		time.Sleep(delay)
+		err = fn()
+	}
+	return
+}
+
+// lockAcquire creates the sidecar lock file for the database at path if
+// options.LockFile is set, retrying as specified in options while it is held
+// by another process. It returns the name of the lock file, or an empty string
+// if none was created.
+func lockAcquire(path string, options Options) (lockFl string, err error) {
+	if options.LockFile {
+		err = retry(options, func() (err error) {
+			var fl *os.File
+			name := path + ".lock"
+			fl, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+			if err == nil {
+				_, err = fmt.Fprintf(fl, "%d\n", os.Getpid())
+				fl.Close()
+				if err == nil {
+					lockFl = name
+				} else {
+					os.Remove(name)
+				}
+			} else if os.IsExist(err) {
+				err = fmt.Errorf("%w: \"%s\" exists", ErrLocked, name)
+			}
+			return
+		})
+	}
+	return
+}
+
+// unlock removes the sidecar lock file, if any.
+func (db *DB) unlock() {
+	if db.lockFl != "" {
+		os.Remove(db.lockFl)
+		db.lockFl = ""
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// schemaVersionKey identifies the schema version in the meta bucket
+var schemaVersionKey = []byte("schema")
+
+// Migration is one step in the evolution of an application's stored data,
+// such as rewriting records in a new format (see RewriteAll), moving records
+// to another type (see Move) or rebuilding indexes whose keys have changed
+// (see RebuildIndexes). Migrations are passed to OpenMigrate in ascending
+// order of Version.
+type Migration struct {
+	// Version is the schema version of the database once the step has been
+	// carried out. It must be greater than zero.
+	Version uint64
+	// Desc briefly describes the step in progress reports and errors.
+	Desc string
+	// Run carries out the step on db. It should divide large changes into
+	// batched transactions, as the methods mentioned above do, and may call
+	// report with the number of records processed so far. If the process
+	// is interrupted, Run is called again the next time the database is
+	// opened, so it must be safe to repeat.
+	Run func(db *DB, report func(count int)) error
+}
+
+// SchemaVersion returns the schema version recorded for the database by
+// OpenMigrate or SetSchemaVersion. It is zero if none has been recorded.
+func (db *DB) SchemaVersion() (version uint64, err error) {
+	err = db.view(func(tx *bbolt.Tx) error {
+		if meta := tx.Bucket([]byte(metaBucketName)); meta != nil {
+			if data := meta.Get(schemaVersionKey); len(data) == 8 {
+				version = binary.BigEndian.Uint64(data)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// SetSchemaVersion records version as the schema version of the database.
+// It is typically called just after a database is created, with the version
+// of the last migration, since a new database needs none of them.
+func (db *DB) SetSchemaVersion(version uint64) error {
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		var meta *bbolt.Bucket
+		meta, err = bucket(tx, metaBucketName, true)
+		if err == nil {
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], version)
+			err = meta.Put(schemaVersionKey, buf[:])
+		}
+		return
+	})
+}
+
+// OpenMigrate opens the database at path like Open and brings its schema
+// up to date. Each migration in steps whose Version is greater than the
+// database's schema version is run in turn, and the schema version is
+// recorded after each one completes. If progress is not nil, it is called
+// with a migration and a count of zero before the migration runs, and again
+// with each count that the migration reports. If a migration fails, the
+// database is closed and an error identifying the migration is returned;
+// the schema version reflects the migrations that completed. An error is
+// also returned if the steps are not in ascending order of Version or if the
+// database's schema version is newer than the last of them, which indicates
+// that it has been migrated by a later version of the application.
+func OpenMigrate(path string, mode os.FileMode, options Options, steps []Migration,
+	progress func(m Migration, count int)) (db *DB, err error) {
+	var version uint64
+	for j := range steps {
+		if steps[j].Version == 0 || (j > 0 && steps[j].Version <= steps[j-1].Version) {
+			return nil, fmt.Errorf("migration %d (%s) is out of order", steps[j].Version, steps[j].Desc)
+		}
+	}
+	db, err = Open(path, mode, options)
+	if err != nil {
+		return nil, err
+	}
+	version, err = db.SchemaVersion()
+	if err == nil && len(steps) > 0 && version > steps[len(steps)-1].Version {
+		err = fmt.Errorf("database schema version %d is newer than latest migration %d",
+			version, steps[len(steps)-1].Version)
+	}
+	for j := 0; j < len(steps) && err == nil; j++ {
+		m := steps[j]
+		if m.Version > version {
+			report := func(count int) {
+				if progress != nil {
+					progress(m, count)
+				}
+			}
+			report(0)
+			err = m.Run(db, report)
+			if err == nil {
+				err = db.SetSchemaVersion(m.Version)
+			}
+			if err != nil {
+				err = fmt.Errorf("migration %d (%s): %w", m.Version, m.Desc, err)
+			}
+		}
+	}
+	if err != nil {
+		db.Close()
+		db = nil
+	}
+	return
+}
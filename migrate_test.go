@@ -0,0 +1,57 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates bringing a database up to date with a series of
+// migrations.
+func ExampleOpenMigrate() {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/migrate.db"
+	steps := []pinion.Migration{
+		{Version: 1, Desc: "add quantities", Run: func(db *pinion.DB, report func(int)) (err error) {
+			for id := uint32(1); id <= 3 && err == nil; id++ {
+				q := quantityRec(id)
+				err = db.PutRec(&q)
+				report(int(id))
+			}
+			return
+		}},
+		{Version: 2, Desc: "rebuild word index", Run: func(db *pinion.DB, report func(int)) error {
+			return db.RebuildIndexes(&quantityType{})
+		}},
+	}
+	progress := func(m pinion.Migration, count int) {
+		fmt.Printf("migration %d (%s): %d\n", m.Version, m.Desc, count)
+	}
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	if err == nil {
+		db.Close()
+		db, err = pinion.OpenMigrate(fileStr, 0600, pinion.Options{}, steps[:1], progress)
+	}
+	if err == nil {
+		db.Close()
+		// A later version of the application adds a step
+		db, err = pinion.OpenMigrate(fileStr, 0600, pinion.Options{}, steps, progress)
+	}
+	if err == nil {
+		var version uint64
+		version, err = db.SchemaVersion()
+		fmt.Println("version", version)
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// migration 1 (add quantities): 0
+	// migration 1 (add quantities): 1
+	// migration 1 (add quantities): 2
+	// migration 1 (add quantities): 3
+	// migration 2 (rebuild word index): 0
+	// version 2
+}
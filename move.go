@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// The MoveLinker interface may be implemented by a record type that is the
+// destination of DB.Move. MovedFrom is called with the name and primary key
+// of the source record after the conversion function has run and before the
+// destination record is stored, allowing the record to retain a link to its
+// origin.
+type MoveLinker interface {
+	MovedFrom(name string, primaryKey []byte)
+}
+
+// Move reclassifies a record by removing it from one record type and storing
+// a converted version of it as another type. srcPtr must have at least the
+// field or fields that make up its primary key assigned. The full source
+// record is read into srcPtr and removed from the database, after which
+// convert is called to populate the record pointed to by dstPtr, typically
+// from the contents of srcPtr. The destination record is stored with the
+// semantics of PutRec. All of this takes place in a single transaction; if the
+// source record does not exist, ErrRecNotFound is returned, and if convert or
+// any other step returns an error, the database is left unchanged. If other
+// databases are attached, the destination record is stored in the database
+// that holds the source type. ErrImmutable is returned if the source type
+// implements the Immutable interface.
+func (db *DB) Move(srcPtr, dstPtr Record, convert func() error) error {
+	if odb := db.owner(srcPtr); odb != db {
+		return odb.Move(srcPtr, dstPtr, convert)
+	}
+	if immutable(srcPtr) {
+		return fmt.Errorf("%w: cannot move %s records", ErrImmutable, srcPtr.Name())
+	}
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		var src bucketGrpType
+		var primaryKey, data []byte
+		srcCount := srcPtr.IndexCount()
+		src, err = bucketGet(srcPtr, srcCount, false, tx)
+		if err == nil {
+			src.derive = db.deriver(tx, srcPtr)
+			primaryKey, err = srcPtr.Key(0)
+			if err == nil {
+				data = src.idxs[0].Get(primaryKey)
+				if data == nil {
+					err = ErrRecNotFound
+				}
+			}
+		}
+		if err == nil {
+			data, err = src.migrate(srcPtr, primaryKey, data)
+		}
+		if err == nil {
+			err = decode(srcPtr, data)
+			if err == nil {
+				err = src.recDelete(srcPtr.New(), srcCount, primaryKey)
+			}
+		}
+		if err == nil {
+			err = convert()
+		}
+		if err == nil {
+			if link, ok := dstPtr.(MoveLinker); ok {
+				link.MovedFrom(srcPtr.Name(), primaryKey)
+			}
+			put := idxPutType{recPtr: dstPtr, scratch: dstPtr.New(), count: dstPtr.IndexCount()}
+			put.bck, err = bucketGet(dstPtr, put.count, true, tx)
+			if err == nil {
+				put.bck.derive = db.deriver(tx, dstPtr)
+				put.bck.bloom = db.blooms[dstPtr.Name()]
+				put.bck.sketch = db.sketched(dstPtr)
+				put.bck.oversize = db.oversize(dstPtr)
+				err = put.idxPut()
+			}
+		}
+		return
+	})
+}
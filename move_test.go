@@ -0,0 +1,70 @@
+package pinion_test
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// promotedQuantityType is a quantity that has been moved out of the quantity
+// record type. It remembers the ID it was stored under before the move.
+type promotedQuantityType struct {
+	quantityType
+	fromID uint32
+}
+
+func (p promotedQuantityType) Name() string {
+	return "promoted"
+}
+
+func (p promotedQuantityType) New() pinion.Record {
+	return new(promotedQuantityType)
+}
+
+func (p *promotedQuantityType) MovedFrom(name string, primaryKey []byte) {
+	if name == "quantity" && len(primaryKey) == 4 {
+		p.fromID = binary.BigEndian.Uint32(primaryKey)
+	}
+}
+
+// This example demonstrates the reclassification of a record.
+func ExampleDB_Move() {
+	var db *pinion.DB
+	var err error
+	var q quantityType
+	var p promotedQuantityType
+	var count int
+	db, err = quantityDB("example/move.db", 1, 5)
+	if err == nil {
+		q.id = 3
+		err = db.Move(&q, &p, func() error {
+			p.quantityType = quantityRec(q.id + 100)
+			return nil
+		})
+		if err == nil {
+			fmt.Printf("%s moved from ID %d\n", p.quantityType, p.fromID)
+			q.id = 42
+			fmt.Println(db.Move(&q, &p, func() error { return nil }))
+			count, err = quantityCount(db)
+			if err == nil {
+				fmt.Printf("%d quantities remain\n", count)
+				p = promotedQuantityType{}
+				p.id = 103
+				err = db.GetRec(&p, 0)
+				if err == nil {
+					fmt.Printf("%s stored as promoted\n", p.quantityType)
+				}
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [        103 : one hundred three] moved from ID 3
+	// record not found
+	// 4 quantities remain
+	// [        103 : one hundred three] stored as promoted
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+)
+
+// The MultiKeyer interface may be implemented by a record type that has one
+// or more multi-entry indexes, in which a record has an entry for each of
+// several keys. For example, a record with a list of tags can have an index
+// with one entry per tag, so that the records with a given tag can be
+// retrieved. Keys is called in place of Key whenever the entries of a
+// secondary index (idx > 0) are stored or removed, and returns all of the
+// record's keys for that index; empty keys and an empty list are permitted.
+// For a conventional index it should return the result of Key as the only
+// element. When a record is updated, pinion removes the entries whose keys
+// are no longer returned and adds those that are new.
+//
+// Key is still used to position scans, so for a multi-entry index it should
+// return the single key, such as one tag, that a scan is to begin with. A
+// record that is retrieved by means of a multi-entry index is returned once
+// for each of its keys in the scanned range.
+type MultiKeyer interface {
+	Keys(idx uint8) ([][]byte, error)
+}
+
+// entrySet returns the keys of the entries that recPtr, a MultiKeyer, has in
+// secondary index idx, each followed by primaryKey. Duplicate and empty keys
+// are omitted.
+func entrySet(mk MultiKeyer, idx uint8, primaryKey []byte) (set [][]byte, err error) {
+	var keys [][]byte
+	keys, err = mk.Keys(idx)
+	for _, key := range keys {
+		if key = entryKey(key, primaryKey); key != nil && !setHas(set, key) {
+			set = append(set, key)
+		}
+	}
+	return
+}
+
+// setHas reports whether key is an element of set.
+func setHas(set [][]byte, key []byte) bool {
+	for _, k := range set {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// multiKeys assigns the entry sets of a MultiKeyer to val. The single keys of
+// its secondary indexes are cleared so that only the sets are maintained.
+func (val *valType) multiKeys(recPtr Record, count uint8, primaryKey []byte) (err error) {
+	if mk, ok := recPtr.(MultiKeyer); ok {
+		val.sets = make([][][]byte, count)
+		for j := uint8(1); j < count && err == nil; j++ {
+			val.keys[j] = nil
+			if indexed(recPtr, j) {
+				val.sets[j], err = entrySet(mk, j, primaryKey)
+			}
+		}
+	}
+	return
+}
+
+// setsPut updates the multi-entry index entries of a record from those of
+// its stored version, cur, to those of its new version, rec.
+func (p *idxPutType) setsPut(cur, rec valType, primaryKey []byte) (err error) {
+	for k := 1; k < len(rec.sets) && err == nil; k++ {
+		var old [][]byte
+		if cur.sets != nil {
+			old = cur.sets[k]
+		}
+		for _, key := range old {
+			if err == nil && !setHas(rec.sets[k], key) {
+				err = p.bck.idxs[k].Delete(key)
+				if err == nil {
+					err = p.bck.expiryDrop(p.recPtr, uint8(k), key)
+				}
+			}
+		}
+		for _, key := range rec.sets[k] {
+			if err == nil && !setHas(old, key) {
+				p.written += len(key)
+				err = p.bck.idxs[k].Put(key, primaryKey)
+			}
+		}
+	}
+	return
+}
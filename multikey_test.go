@@ -0,0 +1,178 @@
+package pinion_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// postType is a record with an index that has an entry for each of its tags.
+type postType struct {
+	id    uint32
+	title string
+	tags  []string
+}
+
+const postTagWidth = 10
+
+func (p postType) MarshalBinary() ([]byte, error) {
+	var put store.PutBuffer
+	put.Uint32(p.id)
+	put.Str(p.title)
+	put.Str(strings.Join(p.tags, ","))
+	return put.Data()
+}
+
+func (p *postType) UnmarshalBinary(data []byte) error {
+	var tags string
+	get := store.NewGetBuffer(data)
+	get.Uint32(&p.id)
+	get.Str(&p.title)
+	get.Str(&tags)
+	p.tags = nil
+	if tags != "" {
+		p.tags = strings.Split(tags, ",")
+	}
+	return get.Done()
+}
+
+func (p postType) Name() string {
+	return "post"
+}
+
+func (p postType) IndexCount() uint8 {
+	return 2
+}
+
+func (p postType) New() pinion.Record {
+	return new(postType)
+}
+
+func (p *postType) NextID(id uint64) {
+	p.id = uint32(id)
+}
+
+// Key returns the primary key or, for the tag index, the key of the first tag
+// so that a scan can be positioned at a tag.
+func (p postType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	switch idx {
+	case 0:
+		kb.Uint32(p.id)
+	case 1:
+		if len(p.tags) > 0 {
+			kb.Str(p.tags[0], postTagWidth)
+		}
+	}
+	return kb.Data()
+}
+
+// Keys implements the pinion.MultiKeyer interface
+func (p postType) Keys(idx uint8) (list [][]byte, err error) {
+	if idx == 1 {
+		for _, tag := range p.tags {
+			var kb store.KeyBuffer
+			var key []byte
+			kb.Str(tag, postTagWidth)
+			if key, err = kb.Data(); err != nil {
+				return nil, err
+			}
+			list = append(list, key)
+		}
+		return
+	}
+	key, err := p.Key(idx)
+	return [][]byte{key}, err
+}
+
+// This example demonstrates an index with an entry for each tag of a post.
+func ExampleMultiKeyer() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/multikey.db", 0600, pinion.Options{})
+	if err == nil {
+		wdb := db.Wrap()
+		wdb.AddRec(&postType{title: "Generics", tags: []string{"go", "types"}})
+		wdb.AddRec(&postType{title: "Borrowing", tags: []string{"rust", "types"}})
+		wdb.AddRec(&postType{title: "Channels", tags: []string{"go"}})
+		show := func(tag string) {
+			p := postType{tags: []string{tag}}
+			var list []string
+			wdb.GetPrefix(&p, 1, postTagWidth, func() bool {
+				list = append(list, p.title)
+				return true
+			})
+			fmt.Printf("%s: %s\n", tag, strings.Join(list, ", "))
+		}
+		show("go")
+		show("types")
+		wdb.PutRec(&postType{id: 1, title: "Generics", tags: []string{"go", "generics"}})
+		show("types")
+		show("generics")
+		wdb.DeleteRec(&postType{id: 3})
+		show("go")
+		err = wdb.Error()
+		if err == nil {
+			err = db.Check(&postType{})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// go: Generics, Channels
+	// types: Generics, Borrowing
+	// types: Borrowing
+	// generics: Generics
+	// go: Generics
+}
+
+// Test that deleting by a key of a multi-entry index removes all of the
+// entries of the deleted records
+func TestDB_DeleteByPrefixKeysMultiKey(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var n int
+	db, err = pinion.Create("example/multikeydel.db", 0600, pinion.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	wdb := db.Wrap()
+	wdb.AddRec(&postType{title: "Generics", tags: []string{"types", "go"}})
+	wdb.AddRec(&postType{title: "Borrowing", tags: []string{"rust", "types"}})
+	err = wdb.Error()
+	if err == nil {
+		var kb store.KeyBuffer
+		var prefix []byte
+		kb.Str("go", postTagWidth)
+		prefix, err = kb.Data()
+		if err == nil {
+			n, err = db.DeleteByPrefixKeys(&postType{}, 1, prefix)
+		}
+	}
+	if err == nil && n != 1 {
+		t.Fatalf("expecting 1 record to be deleted, got %d", n)
+	}
+	if err == nil {
+		err = db.Check(&postType{})
+	}
+	if err == nil {
+		p := postType{tags: []string{"types"}}
+		var list []string
+		err = db.GetPrefix(&p, 1, postTagWidth, func() bool {
+			list = append(list, p.title)
+			return true
+		})
+		if err == nil && strings.Join(list, ",") != "Borrowing" {
+			t.Fatalf("unexpected records %v", list)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
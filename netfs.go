@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNetworkFS is reported when a database is to be opened on a network
+// filesystem without Options.AllowNetworkFS being set
+var ErrNetworkFS = errors.New("database is on a network filesystem")
+
+// checkNetworkFS returns an error if the directory of the database at path
+// is on a network filesystem and options do not allow this. If they do, the
+// directory is probed to verify that synchronized writes can be read back.
+func checkNetworkFS(path string, options Options) (err error) {
+	var fsName string
+	dir := filepath.Dir(path)
+	fsName, err = networkFS(dir)
+	if err == nil && fsName != "" {
+		if options.AllowNetworkFS {
+			err = syncProbe(dir)
+		} else {
+			err = fmt.Errorf("%w: \"%s\" is on %s; set Options.AllowNetworkFS to accept the risk",
+				ErrNetworkFS, path, fsName)
+		}
+	}
+	return
+}
+
+// syncProbe writes a file of random content to dir, synchronizes it to
+// storage, and verifies that the content can be read back.
+func syncProbe(dir string) (err error) {
+	var fl *os.File
+	var data []byte
+	sl := make([]byte, 4096)
+	_, err = rand.Read(sl)
+	if err == nil {
+		fl, err = os.CreateTemp(dir, ".pinion-probe-*")
+	}
+	if err == nil {
+		name := fl.Name()
+		_, err = fl.Write(sl)
+		if err == nil {
+			err = fl.Sync()
+		}
+		closeErr := fl.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			data, err = os.ReadFile(name)
+			if err == nil && !bytes.Equal(data, sl) {
+				err = fmt.Errorf("synchronized write to \"%s\" could not be read back", dir)
+			}
+		}
+		os.Remove(name)
+	}
+	return
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// driveRemote is the value returned by GetDriveTypeW for a network drive
+const driveRemote = 4
+
+var procGetDriveType = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDriveTypeW")
+
+// networkFS returns a description of the network share on which dir resides,
+// or an empty string if it is on a local drive.
+func networkFS(dir string) (name string, err error) {
+	var ptr *uint16
+	dir, err = filepath.Abs(dir)
+	if err == nil {
+		vol := filepath.VolumeName(dir)
+		if strings.HasPrefix(vol, `\\`) {
+			name = "network share " + vol
+		} else {
+			ptr, err = syscall.UTF16PtrFromString(vol + `\`)
+			if err == nil {
+				r, _, _ := procGetDriveType.Call(uintptr(unsafe.Pointer(ptr)))
+				if r == driveRemote {
+					name = "network drive " + vol
+				}
+			}
+		}
+	}
+	return
+}
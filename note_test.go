@@ -0,0 +1,47 @@
+package pinion_test
+
+import (
+	"encoding/json"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// noteType is a prototype record type that stores its value as JSON rather
+// than with the piniondb/store package.
+type noteType struct {
+	ID    uint32
+	Title string
+	Tags  []string `json:",omitempty"`
+}
+
+func (n noteType) MarshalBinary() ([]byte, error) {
+	return json.Marshal(n)
+}
+
+func (n *noteType) UnmarshalBinary(data []byte) error {
+	*n = noteType{}
+	return json.Unmarshal(data, n)
+}
+
+func (n noteType) Name() string {
+	return "note"
+}
+
+func (n noteType) IndexCount() uint8 {
+	return 1
+}
+
+func (n noteType) New() pinion.Record {
+	return new(noteType)
+}
+
+func (n *noteType) NextID(id uint64) {
+	n.ID = uint32(id)
+}
+
+func (n noteType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	kb.Uint32(n.ID)
+	return kb.Data()
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrInconsistent is reported by Open when the verification requested by
+// Options.OpenCheck finds a problem
+var ErrInconsistent = errors.New("database is inconsistent")
+
+// OpenCheckMode selects the verification that Open and Create perform before
+// returning a database. See Options.OpenCheck.
+type OpenCheckMode uint8
+
+const (
+	// OpenCheckNone skips verification
+	OpenCheckNone OpenCheckMode = iota
+	// OpenCheckQuick verifies the page structure of the file with bbolt's
+	// consistency check. Every page of the file is read, so the time taken
+	// grows with the size of the file.
+	OpenCheckQuick
+	// OpenCheckFull additionally verifies the records and indexes of each
+	// type listed in Options.Records, as Check does. Every record is decoded,
+	// so this can take considerably longer.
+	OpenCheckFull
+)
+
+// openCheckLimit is the number of problems found by bbolt's consistency check
+// that are reported
+const openCheckLimit = 8
+
+// structureCheck runs bbolt's consistency check if Options.OpenCheck calls
+// for it.
+func (db *DB) structureCheck() (err error) {
+	if db.opt.OpenCheck >= OpenCheckQuick {
+		err = db.view(func(tx *bbolt.Tx) error {
+			var list []string
+			count := 0
+			for e := range tx.Check() {
+				if count < openCheckLimit {
+					list = append(list, e.Error())
+				}
+				count++
+			}
+			if count > openCheckLimit {
+				list = append(list, fmt.Sprintf("%d more", count-openCheckLimit))
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: %s", ErrInconsistent, strings.Join(list, "; "))
+			}
+			return nil
+		})
+	}
+	return
+}
+
+// typesCheck checks each type listed in Options.Records if Options.OpenCheck
+// calls for it.
+func (db *DB) typesCheck() (err error) {
+	if db.opt.OpenCheck >= OpenCheckFull {
+		err = db.view(func(tx *bbolt.Tx) (err error) {
+			for j := 0; j < len(db.opt.Records) && err == nil; j++ {
+				err = checkType(tx, db.opt.Records[j])
+				if err != nil {
+					err = fmt.Errorf("%w: %v", ErrInconsistent, err)
+				}
+			}
+			return
+		})
+	}
+	return
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+)
+
+// ErrToken is reported when a continuation token is malformed or was issued
+// for a different record type or index
+var ErrToken = errors.New("invalid continuation token")
+
+// tokenEncode returns a continuation token that identifies the stored key of
+// index idx of the record type of recPtr.
+func tokenEncode(recPtr Record, idx uint8, key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(concat([]byte(recPtr.Name()), []byte{0, idx}, key))
+}
+
+// tokenDecode returns the stored key identified by token.
+func tokenDecode(recPtr Record, idx uint8, token string) (key []byte, err error) {
+	var data []byte
+	data, err = base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		hdr := concat([]byte(recPtr.Name()), []byte{0, idx})
+		if bytes.HasPrefix(data, hdr) && len(data) > len(hdr) {
+			key = data[len(hdr):]
+		} else {
+			err = ErrToken
+		}
+	} else {
+		err = ErrToken
+	}
+	return
+}
+
+// GetPage functions like Get and additionally supports resumption of the
+// iteration at a later time, for example in a subsequent web request. If token
+// is empty, the iteration begins with the first record that matches the
+// initial value of recPtr. Otherwise, token must have been returned by an
+// earlier call for the same record type and index, and the iteration begins
+// with the record that follows the one last passed to f in that call; recPtr
+// need not be assigned. When f returns false, next is a token with which the
+// iteration can be resumed. next is empty if no records remain. The token is
+// an opaque, URL-safe string; it remains valid as records are added and
+// removed, and resumption begins after its position in the index even if the
+// record it identifies has been deleted.
+func (db *DB) GetPage(recPtr Record, idx uint8, token string, f func() bool) (next string, err error) {
+	sc := scanType{idx: idx}
+	if token != "" {
+		sc.after, err = tokenDecode(recPtr, idx, token)
+	}
+	if err == nil {
+		err = db.scan(recPtr, &sc, f)
+		if err == nil && sc.more {
+			next = tokenEncode(recPtr, idx, sc.last)
+		}
+	}
+	return
+}
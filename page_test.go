@@ -0,0 +1,46 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates pagination across separate calls.
+func ExampleDB_GetPage() {
+	var db *pinion.DB
+	var err error
+	var token string
+	db, err = quantityDB("example/page.db", 1, 7)
+	if err == nil {
+		var q quantityType
+		page := 1
+		for err == nil && (page == 1 || token != "") {
+			count := 3
+			fmt.Printf("Page %d:", page)
+			q = quantityType{}
+			token, err = db.GetPage(&q, idxQuantityVal, token, func() bool {
+				fmt.Printf(" %s", q.ExportText()[1])
+				count--
+				return count > 0
+			})
+			fmt.Println()
+			page++
+		}
+		if err == nil {
+			_, err = db.GetPage(&q, idxQuantityID, "bm90IGEgdG9rZW4", func() bool { return true })
+			fmt.Println(errors.Is(err, pinion.ErrToken))
+			err = nil
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Page 1: five four one
+	// Page 2: seven six three
+	// Page 3: two
+	// true
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+// The PartialIndexer interface may be implemented by a record type with one or
+// more partial indexes, which hold entries only for records that meet a
+// condition. For example, an index of open orders can leave out the much
+// larger number of closed ones. Indexed is called whenever the entries of a
+// secondary index (idx > 0) are stored or removed, and returns false if the
+// record is to have no entry in index idx. When a record is updated and the
+// condition changes, its entry is added or removed accordingly.
+//
+// A record can also be left out of an index by returning an empty key from
+// Key; PartialIndexer is convenient when the condition does not involve the
+// key fields.
+type PartialIndexer interface {
+	Indexed(idx uint8) bool
+}
+
+// indexed reports whether recPtr has entries in secondary index idx.
+func indexed(recPtr Record, idx uint8) bool {
+	if p, ok := recPtr.(PartialIndexer); ok {
+		return p.Indexed(idx)
+	}
+	return true
+}
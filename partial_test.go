@@ -0,0 +1,108 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// taskType is a record whose title index holds only the tasks that are not
+// done.
+type taskType struct {
+	id    uint32
+	title string
+	done  bool
+}
+
+func (t taskType) MarshalBinary() ([]byte, error) {
+	var put store.PutBuffer
+	var done uint8
+	if t.done {
+		done = 1
+	}
+	put.Uint32(t.id)
+	put.Str(t.title)
+	put.Uint8(done)
+	return put.Data()
+}
+
+func (t *taskType) UnmarshalBinary(data []byte) error {
+	var done uint8
+	get := store.NewGetBuffer(data)
+	get.Uint32(&t.id)
+	get.Str(&t.title)
+	get.Uint8(&done)
+	t.done = done != 0
+	return get.Done()
+}
+
+func (t taskType) Name() string {
+	return "task"
+}
+
+func (t taskType) IndexCount() uint8 {
+	return 2
+}
+
+func (t taskType) New() pinion.Record {
+	return new(taskType)
+}
+
+func (t *taskType) NextID(id uint64) {
+	t.id = uint32(id)
+}
+
+func (t taskType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	switch idx {
+	case 0:
+		kb.Uint32(t.id)
+	case 1:
+		kb.Str(t.title, 16)
+	}
+	return kb.Data()
+}
+
+// Indexed implements the pinion.PartialIndexer interface
+func (t taskType) Indexed(idx uint8) bool {
+	return !t.done
+}
+
+// This example demonstrates an index whose entries are added and removed as
+// the condition for including a record changes.
+func ExamplePartialIndexer() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/partial.db", 0600, pinion.Options{})
+	if err == nil {
+		wdb := db.Wrap()
+		wdb.AddRec(&taskType{title: "Write docs"})
+		wdb.AddRec(&taskType{title: "Fix bug", done: true})
+		wdb.AddRec(&taskType{title: "Release"})
+		show := func() {
+			var t taskType
+			fmt.Print("open:")
+			wdb.Get(&t, 1, func() bool {
+				fmt.Printf(" [%s]", t.title)
+				return true
+			})
+			fmt.Println()
+		}
+		show()
+		wdb.PutRec(&taskType{id: 1, title: "Write docs", done: true})
+		wdb.PutRec(&taskType{id: 2, title: "Fix bug"})
+		show()
+		err = wdb.Error()
+		if err == nil {
+			err = db.Check(&taskType{})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// open: [Release] [Write docs]
+	// open: [Fix bug] [Release]
+}
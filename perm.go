@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileOwner identifies the user and group that are to own a database file.
+// An ID of -1 leaves that attribute unchanged.
+type FileOwner struct {
+	UID, GID int
+}
+
+// dirPrepare creates the directory that is to hold the database file at
+// path, and any missing parents, if Options.DirMode is set.
+func dirPrepare(path string, options Options) (err error) {
+	if options.DirMode != 0 {
+		err = os.MkdirAll(filepath.Dir(path), options.DirMode)
+	}
+	return
+}
+
+// filePrepare applies the ownership and access options to the database file
+// at path once it has been opened.
+func filePrepare(path string, options Options) (err error) {
+	if options.Owner != nil {
+		err = os.Chown(path, options.Owner.UID, options.Owner.GID)
+		if err != nil {
+			err = fmt.Errorf("cannot set owner of \"%s\": %w", path, err)
+		}
+	}
+	if err == nil && options.PrivateACL {
+		err = privateACL(path)
+		if err != nil {
+			err = fmt.Errorf("cannot set access control list of \"%s\": %w", path, err)
+		}
+	}
+	return
+}
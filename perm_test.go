@@ -0,0 +1,39 @@
+package pinion_test
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/piniondb/pinion"
+)
+
+func TestCreate_DirMode(t *testing.T) {
+	const path = "example/perm/nested/perm.db"
+	if runtime.GOOS == "windows" {
+		t.Skip("file ownership is not supported on Windows")
+	}
+	os.RemoveAll("example/perm")
+	options := pinion.Options{
+		DirMode: 0700,
+		Owner:   &pinion.FileOwner{UID: os.Getuid(), GID: -1},
+	}
+	db, err := pinion.Create(path, 0600, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	info, err := os.Stat("example/perm/nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || info.Mode().Perm()&^0700 != 0 {
+		t.Fatalf("directory mode is %v, expected at most 0700", info.Mode())
+	}
+	db, err = pinion.Open(path, 0600, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	os.RemoveAll("example/perm")
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// privateSDDL is a security descriptor with a protected DACL, one that does
+// not inherit entries from the parent directory, that grants full access to
+// the owner of the file and to the local system account
+const privateSDDL = "D:P(A;;FA;;;OW)(A;;FA;;;SY)"
+
+// Constants used with SetNamedSecurityInfoW
+const (
+	seFileObject                     = 1
+	daclSecurityInformation          = 0x00000004
+	protectedDaclSecurityInformation = 0x80000000
+	sddlRevision1                    = 1
+)
+
+var (
+	modAdvapi32                   = syscall.NewLazyDLL("advapi32.dll")
+	procConvertStringSDToSD       = modAdvapi32.NewProc("ConvertStringSecurityDescriptorToSecurityDescriptorW")
+	procGetSecurityDescriptorDacl = modAdvapi32.NewProc("GetSecurityDescriptorDacl")
+	procSetNamedSecurityInfo      = modAdvapi32.NewProc("SetNamedSecurityInfoW")
+)
+
+// privateACL replaces the access control list of the file at path, which
+// is normally inherited from its directory, with one that grants access
+// only to the file's owner and the system account.
+func privateACL(path string) (err error) {
+	var sddl, name *uint16
+	var sd, dacl uintptr
+	var present, defaulted int32
+	sddl, err = syscall.UTF16PtrFromString(privateSDDL)
+	if err == nil {
+		name, err = syscall.UTF16PtrFromString(path)
+	}
+	if err == nil {
+		r, _, e := procConvertStringSDToSD.Call(uintptr(unsafe.Pointer(sddl)), sddlRevision1,
+			uintptr(unsafe.Pointer(&sd)), 0)
+		if r == 0 {
+			err = e
+		}
+	}
+	if err == nil {
+		defer syscall.LocalFree(syscall.Handle(sd))
+		r, _, e := procGetSecurityDescriptorDacl.Call(sd, uintptr(unsafe.Pointer(&present)),
+			uintptr(unsafe.Pointer(&dacl)), uintptr(unsafe.Pointer(&defaulted)))
+		if r == 0 {
+			err = e
+		}
+	}
+	if err == nil {
+		r, _, _ := procSetNamedSecurityInfo.Call(uintptr(unsafe.Pointer(name)), seFileObject,
+			daclSecurityInformation|protectedDaclSecurityInformation, 0, 0, dacl, 0)
+		if r != 0 {
+			err = syscall.Errno(r)
+		}
+	}
+	return
+}
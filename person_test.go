@@ -67,6 +67,15 @@ const (
 // by pinion.
 var personIndexNames = []string{"ID", "Last name", "First name"}
 
+// IndexName implements the pinion.IndexNamer interface. This is optional; it
+// is used when pinion reports on the schema.
+func (p personType) IndexName(idx uint8) string {
+	if int(idx) < len(personIndexNames) {
+		return personIndexNames[idx]
+	}
+	return ""
+}
+
 // IndexCount returns the number of indexes pinion should maintain for records
 // of personType.
 func (p personType) IndexCount() uint8 {
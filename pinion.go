@@ -18,11 +18,15 @@ package pinion
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.etcd.io/bbolt"
 )
@@ -39,6 +43,24 @@ var (
 	ErrNotOpen = errors.New("database is not open")
 	// ErrRecNotFound is reported when no match is found for the requested record
 	ErrRecNotFound = errors.New("record not found")
+	// ErrIndexBackfill is reported by Open when a registered record type
+	// declares indexes that have not been built for its stored records
+	ErrIndexBackfill = errors.New("index backfill required")
+	// ErrDuplicateKey is reported by PutRecStrict when a record with the same
+	// primary key is already stored
+	ErrDuplicateKey = errors.New("duplicate primary key")
+	// ErrIndexDeclared is reported by DropIndex when the record type still
+	// declares the index to be dropped
+	ErrIndexDeclared = errors.New("index is declared by record type")
+	// ErrImmutable is reported when a record of a type that implements the
+	// Immutable interface would be replaced or deleted
+	ErrImmutable = errors.New("record is immutable")
+	// ErrTypeExists is reported by RenameType when records are already stored
+	// under the new name
+	ErrTypeExists = errors.New("record type already exists")
+	// ErrScanLimit is reported when an iteration exceeds Options.MaxScanRecords
+	// or Options.MaxScanBytes
+	ErrScanLimit = errors.New("scan limit exceeded")
 )
 
 const (
@@ -59,6 +81,21 @@ const (
 	//   2,500: 3.8 s
 	//   1,000: 8.6 s
 	cnLoopCount = 12500
+	// cnSmallLoopCount is the loop limit used when Options.SmallFootprint is
+	// set. It trades write throughput for a much smaller set of uncommitted
+	// pages.
+	cnSmallLoopCount = 1000
+	// cnSmallAllocSize is the amount by which the database file grows when
+	// Options.SmallFootprint is set. bbolt's default is 16 MB.
+	cnSmallAllocSize = 1 << 20
+	// cnBatchBytes is the number of bytes of record data and keys after which
+	// a writeable transaction is committed early, regardless of the number of
+	// records it holds. Without it, a batch of very large records can leave
+	// hundreds of megabytes of dirty pages uncommitted.
+	cnBatchBytes = 64 << 20
+	// cnSmallBatchBytes is the byte limit used when Options.SmallFootprint is
+	// set.
+	cnSmallBatchBytes = 4 << 20
 )
 
 // The Record interface specifies methods that allow pinion to manage multiply
@@ -82,7 +119,10 @@ type Record interface {
 	IndexCount() uint8
 	// Name of record for database table (invariant).
 	Name() string
-	// Construct a key for the index specified by idx.
+	// Construct a key for the index specified by idx. An empty key for a
+	// secondary index (idx > 0) indicates that the record has no entry in that
+	// index; this allows records with an unassigned optional field to be left
+	// out of the field's index.
 	Key(idx uint8) (key []byte, err error)
 	// Provide a temporary buffer for internal use. The returned record should be
 	// of the same type as the method receiver.
@@ -97,14 +137,211 @@ type Record interface {
 // for concurrent goroutine use. Only one instance of this type should be
 // active at a time.
 type DB struct {
+	mu     sync.RWMutex // Protects boltDB
 	boltDB *bbolt.DB
 	opt    Options
+	path   string // Absolute path of database file
+	lockFl string // Path of sidecar lock file, if any
+	snap   *snapshotType
+	hdr    Header // Protected by mu if db is a snapshot
+	txs    txTrackType
+	// attached holds the databases added with Attach; protected by mu
+	attached []attachType
+	// viewOf is the database whose file is shared by a view opened with
+	// OpenView; protected by mu
+	viewOf *DB
+	// tx, if not nil, is the transaction in which every operation of a
+	// database bound to a Tx or opened with Snapshot runs
+	tx *bbolt.Tx
+	// release, if not nil, is called when a view is closed to end the
+	// transaction it holds
+	release func()
+	// compact is set by CompactInPlace; protected by mu
+	compact bool
+	// blooms holds the Bloom filters of the types listed in
+	// Options.BloomFilters, keyed by record name
+	blooms map[string]*bloomFilter
 }
 
 // The Options type is used to configure the database when it is opened.
 type Options struct {
 	BoltOpt bbolt.Options
 	// Consider flag to control whether primary key is concatenated to other keys
+
+	// Records registers the record types managed by the application. When a
+	// database is opened, each registered type that has stored records is
+	// checked for indexes that have never been built. This happens when the
+	// value returned by IndexCount() is increased after records have been
+	// stored.
+	Records []Record
+	// Backfill permits Open to build missing indexes from the stored records.
+	// If it is false, Open fails with an error wrapping ErrIndexBackfill that
+	// names each missing index.
+	Backfill bool
+	// BatchSize is the maximum number of records that Put, Add and Delete
+	// process in one transaction. If it is zero, a default that has been
+	// determined empirically to perform well is used.
+	BatchSize int
+	// BatchBytes is the approximate number of bytes of record data and keys
+	// after which Put and Add commit a transaction early, even if it holds
+	// fewer than BatchSize records. If it is zero, a default is used; if it is
+	// negative, transactions are limited only by BatchSize.
+	BatchBytes int
+	// SmallFootprint selects settings suited to devices with little memory,
+	// such as single-board computers. The database file grows in smaller
+	// steps and, unless BatchSize is specified, fewer records are processed
+	// in each transaction. Bulk imports are slower but the amount of
+	// uncommitted data held in memory is much smaller.
+	SmallFootprint bool
+	// PageSize, if not zero, is the size in bytes of the pages of a database
+	// file created by Create. It must be a power of two no smaller than 1024.
+	// A size that matches the block size of the underlying storage, such as
+	// 16384 on some filesystems and SSDs, can reduce write amplification. The
+	// default is the operating system's memory page size. The page size of an
+	// existing file cannot be changed, so this is ignored by Open. The size in
+	// use is recorded in the database header.
+	PageSize int
+	// OpenRetries is the number of times Open and Create retry an operation on
+	// the database file that fails because the file is temporarily in use by
+	// another process. On Windows, virus scanners and indexing services
+	// commonly cause such sharing violations shortly after a file is written.
+	OpenRetries int
+	// OpenRetryDelay is the time to wait before each retry. If it is zero, 100
+	// milliseconds is used.
+	OpenRetryDelay time.Duration
+	// LockFile causes a sidecar lock file, the database path followed by
+	// ".lock", to be held while the database is open. This guards against
+	// concurrent use on filesystems, such as some network shares, on which
+	// bbolt's file locking is unreliable. If the lock file is present, Open
+	// and Create fail with ErrLocked. A lock file left behind by a process
+	// that did not close the database must be removed manually.
+	LockFile bool
+	// AllowNetworkFS permits a database to be opened on a network filesystem
+	// such as NFS or SMB. bbolt relies on file locking and memory mapping
+	// semantics that many network filesystems do not honor, and silent
+	// corruption can result. By default, Open and Create fail with
+	// ErrNetworkFS when the database directory is on a network filesystem.
+	// If this is set, a test file is written and synchronized in the
+	// directory to verify at least basic durability before the database is
+	// opened.
+	AllowNetworkFS bool
+	// StaleReaderThreshold, if greater than zero, is the age at which an open
+	// read transaction is reported to StaleReaderHook. A read transaction that
+	// stays open, typically because a Get callback is stuck, prevents bbolt
+	// from reusing freed pages. The goroutine stack is captured at the start
+	// of every read transaction so that the report identifies the code
+	// responsible; this has a modest cost.
+	StaleReaderThreshold time.Duration
+	// StaleReaderHook is called, from its own goroutine, when a read
+	// transaction has been open longer than StaleReaderThreshold. If it is
+	// nil, a report is written with the standard logger.
+	StaleReaderHook func(StaleReader)
+	// CommitHook, if not nil, is called after every write transaction that
+	// pinion commits with a report of how long the commit took. It is called
+	// before the operation returns, so it should not block.
+	CommitHook func(CommitInfo)
+	// SlowCommitThreshold, if greater than zero, is the commit duration at
+	// which a commit is reported to SlowCommitHook. A failing or overloaded
+	// disk usually shows up first as slow commits.
+	SlowCommitThreshold time.Duration
+	// SlowCommitHook is called when a commit takes at least
+	// SlowCommitThreshold. If it is nil, a report is written with the standard
+	// logger.
+	SlowCommitHook func(CommitInfo)
+	// Derived registers record types that are computed from other record
+	// types and kept current as those are modified.
+	Derived []Derivation
+	// Clock, if not nil, is called in place of time.Now to obtain the times
+	// that pinion stores in the database, such as the creation time in the
+	// header, the time a checkpoint was saved and the expiry of idempotency
+	// tokens. Supplying a controllable clock makes these deterministic in
+	// tests and simulations. Durations reported for diagnostic purposes, such
+	// as those of TxInfo, are always measured with the system clock.
+	Clock func() time.Time
+	// BeforeCommit, if not nil, is called when the work of a write
+	// transaction is complete and the transaction is about to be committed.
+	// If it returns an error, the transaction is rolled back and the error is
+	// returned by the operation. It allows tests of an application's recovery
+	// logic to inject failures, for example by failing the nth commit, and to
+	// model slow storage by sleeping.
+	BeforeCommit func() error
+	// Rand, if not nil, is read in place of crypto/rand for the random values
+	// that pinion stores in the database, such as the ID in the header.
+	Rand io.Reader
+	// BloomFilters lists record types whose primary keys are tracked in
+	// memory with a Bloom filter, so that Exists can report that a primary
+	// key is not stored without a database lookup. This speeds up ingestion
+	// that checks for duplicates before writing. See the bloomFilter type for
+	// details. The filters are ignored if the database is opened read-only.
+	BloomFilters []Record
+	// Sketches lists record types for which the number of distinct keys in
+	// each index is estimated as records are written. See ApproxDistinct.
+	Sketches []Record
+	// RecordSizeThreshold, if greater than zero, is the size in bytes of
+	// record data at which a record that is written is reported to
+	// RecordSizeHook. An unexpectedly large record, such as one into which a
+	// large blob has been serialized by mistake, is thereby noticed early.
+	RecordSizeThreshold int
+	// RecordSizeHook is called when a record of at least RecordSizeThreshold
+	// bytes is written. It is called within the write transaction, which may
+	// yet be rolled back, so it should not block. If it is nil, a report is
+	// written with the standard logger.
+	RecordSizeHook func(RecordSize)
+	// MaxScanRecords, if greater than zero, is the largest number of records
+	// or index entries that a single iteration, such as one by Get, GetKeys or
+	// an export, passes to its callback. An iteration that would exceed it
+	// ends with an error wrapping ErrScanLimit. This guards against a callback
+	// that, through a bug, never stops the iteration and would otherwise walk
+	// an entire large index while holding a read transaction open. The limit
+	// must exceed the largest result that the application legitimately
+	// iterates over.
+	MaxScanRecords int
+	// MaxScanBytes, if greater than zero, similarly limits the total size of
+	// the record data, or of the index and primary keys, that a single
+	// iteration passes to its callback.
+	MaxScanBytes int
+	// ScanYieldRecords, if greater than zero, is the number of index entries
+	// after which an iteration such as one by Get ends its read transaction
+	// and continues in a new one, seeking to the entry that follows the last
+	// one visited. A long iteration thus does not prevent bbolt from reusing
+	// freed pages or from remapping the file as it grows. The records passed
+	// to the callback then no longer form a consistent snapshot: records
+	// written in the meantime may or may not be seen. Iterations within a
+	// transaction begun with DB.View or DB.Update never yield, so that is the
+	// way to obtain a consistent view when yielding is configured.
+	ScanYieldRecords int
+	// ScanYieldInterval, if greater than zero, is the time after which an
+	// iteration yields in the same way.
+	ScanYieldInterval time.Duration
+	// BackupHook, if not nil, is called with the outcome of each backup made
+	// by a runner started with StartBackups. It is called from the runner's
+	// goroutine.
+	BackupHook func(BackupInfo)
+	// DirMode, if not zero, causes Create to create the directory that holds
+	// the database file, along with any missing parents, with the specified
+	// permission bits before the file is created.
+	DirMode os.FileMode
+	// Owner, if not nil, is assigned as the owner of the database file by
+	// Open and Create. Changing the owner usually requires privileges, so
+	// this is mainly of use to services that start as root and drop
+	// privileges later. It is not supported on Windows, where Open and Create
+	// fail if it is set.
+	Owner *FileOwner
+	// PrivateACL causes Open and Create to replace the access control list
+	// that a database file inherits from its directory on Windows with one
+	// that grants access only to the file's owner and the system account.
+	// Windows disregards the mode argument of Open and Create, so this is the
+	// means of keeping a database private there. It is ignored on other
+	// platforms.
+	PrivateACL bool
+	// OpenCheck selects the verification that Open and Create perform before
+	// returning the database: none, the default, a check of the file's page
+	// structure, or that check followed by a check of the records and indexes
+	// of each type listed in Records. A problem is reported with an error
+	// wrapping ErrInconsistent. Deployments that cannot tolerate undetected
+	// damage can thus trade startup time for the assurance of a consistent
+	// database.
+	OpenCheck OpenCheckMode
 }
 
 // bucketGrpType holds all buckets that store data and indexes for a record
@@ -112,12 +349,135 @@ type Options struct {
 type bucketGrpType struct {
 	rec  *bbolt.Bucket
 	idxs []*bbolt.Bucket
+	// derive, if not nil, maintains the records derived from this type
+	derive func(old, new Record) error
+	// bloom, if not nil, tracks the primary keys of this type
+	bloom *bloomFilter
+	// sketch is set if the distinct keys of each index of this type are
+	// counted
+	sketch bool
+	// format, if not nil, records the format versions of the records of a
+	// type that implements BinaryMigrator
+	format *bbolt.Bucket
+	// oversize, if not nil, reports records that exceed the size threshold
+	oversize func(key []byte, size int)
 }
 
 // valType holds a record's data and keys
 type valType struct {
 	data []byte
 	keys [][]byte
+	// sets holds the entry keys of each secondary index of a MultiKeyer, in
+	// which case the secondary elements of keys are nil
+	sets [][][]byte
+}
+
+// bolt returns the underlying bbolt database, or nil if the database is
+// closed.
+func (db *DB) bolt() *bbolt.DB {
+	db.mu.RLock()
+	viewOf, bdb := db.viewOf, db.boltDB
+	db.mu.RUnlock()
+	if viewOf != nil {
+		return viewOf.bolt()
+	}
+	return bdb
+}
+
+// acquire is like bolt but also returns a function that must be called when
+// the caller has finished with the bbolt database. Until then, Refresh does
+// not close it.
+func (db *DB) acquire() (bdb *bbolt.DB, release func()) {
+	var users *sync.WaitGroup
+	db.mu.RLock()
+	viewOf := db.viewOf
+	bdb = db.boltDB
+	if db.snap != nil && bdb != nil {
+		users = db.snap.users
+		users.Add(1)
+	}
+	db.mu.RUnlock()
+	if viewOf != nil {
+		return viewOf.acquire()
+	}
+	if users != nil {
+		return bdb, users.Done
+	}
+	return bdb, func() {}
+}
+
+// view runs fn in a read-only transaction.
+func (db *DB) view(fn func(*bbolt.Tx) error) error {
+	if db.tx != nil {
+		return fn(db.tx)
+	}
+	bdb, release := db.acquire()
+	defer release()
+	if bdb == nil {
+		return ErrNotOpen
+	}
+	return bdb.View(db.tracked(false, fn))
+}
+
+// update runs fn in a writeable transaction.
+func (db *DB) update(fn func(*bbolt.Tx) error) error {
+	if db.tx != nil {
+		if !db.tx.Writable() {
+			return bbolt.ErrTxNotWritable
+		}
+		return fn(db.tx)
+	}
+	bdb, release := db.acquire()
+	defer release()
+	if bdb == nil {
+		return ErrNotOpen
+	}
+	if db.opt.BoltOpt.ReadOnly {
+		return bbolt.ErrDatabaseReadOnly
+	}
+	return bdb.Update(db.tracked(true, fn))
+}
+
+// now returns the current time according to the configured clock.
+func (db *DB) now() time.Time {
+	if db.opt.Clock != nil {
+		return db.opt.Clock()
+	}
+	return time.Now()
+}
+
+// random returns the configured source of random bytes.
+func (db *DB) random() io.Reader {
+	if db.opt.Rand != nil {
+		return db.opt.Rand
+	}
+	return rand.Reader
+}
+
+// batchSize returns the maximum number of records to process in one
+// writeable transaction.
+func (db *DB) batchSize() int {
+	if db.opt.BatchSize > 0 {
+		return db.opt.BatchSize
+	}
+	if db.opt.SmallFootprint {
+		return cnSmallLoopCount
+	}
+	return cnLoopCount
+}
+
+// batchBytes returns the number of bytes after which a writeable transaction
+// is committed early, or zero if there is no limit.
+func (db *DB) batchBytes() int {
+	switch {
+	case db.opt.BatchBytes > 0:
+		return db.opt.BatchBytes
+	case db.opt.BatchBytes < 0:
+		return 0
+	case db.opt.SmallFootprint:
+		return cnSmallBatchBytes
+	}
+	return cnBatchBytes
 }
 
 // bucket returns the named bucket. It is valid for the duration of the
@@ -156,17 +516,37 @@ func subbucket(parent *bbolt.Bucket, parentNameStr string, idx uint8, createIfNe
 }
 
 // bucketGet retrieves a record's storage buckets. If createIfNeeded is set,
-// the buckets will be created if they do not already exist. The transaction
-// must allow writing if createIfNeeded is true.
+// the buckets will be created if they do not already exist, and secondary
+// indexes that are missing although records are stored are built. The
+// transaction must allow writing if createIfNeeded is true.
 func bucketGet(recPtr Record, count uint8, createIfNeeded bool, tx *bbolt.Tx) (bck bucketGrpType, err error) {
 	if count > 0 {
 		nameStr := recPtr.Name()
 		bck.rec, err = bucket(tx, nameStr, createIfNeeded)
 		if err == nil {
+			err = registryCheck(tx, recPtr, count, createIfNeeded)
+		}
+		if _, ok := recPtr.(BinaryMigrator); ok && err == nil {
+			bck.format, err = formatBucket(tx, nameStr, createIfNeeded)
+		}
+		if err == nil {
+			var missing []uint8
+			if createIfNeeded && bck.rec.Bucket([]byte{0}) != nil {
+				for j := uint8(1); j < count; j++ {
+					if bck.rec.Bucket([]byte{j}) == nil {
+						missing = append(missing, j)
+					}
+				}
+			}
 			bck.idxs = make([]*bbolt.Bucket, count)
 			for j := uint8(0); j < count && err == nil; j++ {
 				bck.idxs[j], err = subbucket(bck.rec, nameStr, j, createIfNeeded)
 			}
+			if err == nil && len(missing) > 0 {
+				// Indexes added to a type with stored records are built before
+				// records are written so that they are never incomplete
+				err = bck.indexFill(recPtr, count, missing)
+			}
 		}
 	} else {
 		err = ErrMissingIndex
@@ -180,18 +560,77 @@ func (bck bucketGrpType) currentGet(recPtr Record, count uint8, primaryKey []byt
 	var j uint8
 	val.data = bck.idxs[0].Get(primaryKey)
 	if val.data != nil {
-		recPtr.UnmarshalBinary(val.data)
+		var data []byte
+		data, err = bck.migrate(recPtr, primaryKey, val.data)
+		if err != nil {
+			return
+		}
+		recPtr.UnmarshalBinary(data)
 		val.keys = make([][]byte, count)
 		for j = 0; j < count && err == nil; j++ {
 			val.keys[j], err = recPtr.Key(j)
 			if err == nil && j > 0 {
-				val.keys[j] = append(val.keys[j], primaryKey...)
+				val.keys[j] = entryKey(val.keys[j], primaryKey)
+				if !indexed(recPtr, j) {
+					val.keys[j] = nil
+				}
 			}
 		}
+		if err == nil {
+			err = val.multiKeys(recPtr, count, primaryKey)
+		}
+	}
+	return
+}
+
+// recDelete removes the record stored under primaryKey along with all of its
+// index entries. It is not an error if no such record exists.
+func (bck bucketGrpType) recDelete(scratch Record, count uint8, primaryKey []byte) (err error) {
+	var currentVal valType
+	currentVal, err = bck.currentGet(scratch, count, primaryKey)
+	if err == nil && currentVal.data != nil {
+		err = bck.countAdd(scratch.Name(), -1)
+		if err == nil {
+			err = bck.sizeAdd(scratch.Name(), len(currentVal.data), -1)
+		}
+		for k := uint8(0); k < count && err == nil; k++ {
+			if currentVal.keys[k] != nil {
+				err = bck.idxs[k].Delete(currentVal.keys[k])
+				if err == nil && k > 0 {
+					err = bck.expiryDrop(scratch, k, currentVal.keys[k])
+				}
+			}
+		}
+		for k := 1; k < len(currentVal.sets) && err == nil; k++ {
+			for _, key := range currentVal.sets[k] {
+				if err == nil {
+					err = bck.idxs[k].Delete(key)
+				}
+			}
+			if err == nil {
+				err = bck.expiryDrop(scratch, uint8(k), currentVal.sets[k]...)
+			}
+		}
+		if err == nil {
+			err = bck.formatDrop(primaryKey)
+		}
+		if err == nil && bck.derive != nil {
+			err = bck.derive(scratch, nil)
+		}
 	}
 	return
 }
 
+// entryKey returns the key of a secondary index entry, which is the index key
+// followed by the primary key, or nil if key is empty and the record
+// consequently has no entry in the index.
+func entryKey(key, primaryKey []byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	return concat(key, primaryKey)
+}
+
 // concat returns the concatenaton of all specified byte slices
 func concat(sls ...[]byte) (res []byte) {
 	for _, sl := range sls {
@@ -210,66 +649,243 @@ func valGet(recPtr Record, count uint8) (val valType, err error) {
 		for j = 0; j < count && err == nil; j++ {
 			val.keys[j], err = recPtr.Key(j)
 			if err == nil && j > 0 {
-				val.keys[j] = concat(val.keys[j], val.keys[0])
+				val.keys[j] = entryKey(val.keys[j], val.keys[0])
+				if !indexed(recPtr, j) {
+					val.keys[j] = nil
+				}
 			}
 		}
+		if err == nil {
+			err = val.multiKeys(recPtr, count, val.keys[0])
+		}
 	}
 	return
 }
 
-// Get returns zero or more records. It calls f iteratively until f() returns
-// false or no more records are found. For each call of f, the record variable
-// pointed to be recPtr will be populated with a successive value from the
-// database. The record order is determined by the index specified by idx. The
-// first record returned is the first one that matches the initial value of the
-// record pointed to by recPtr. Only the field or fields that make up the key
-// associated with index idx need to be assigned initially.
-func (db *DB) Get(recPtr Record, idx uint8, f func() bool) (getErr error) {
-	if db.boltDB == nil {
-		return ErrNotOpen
+// scanType describes an iteration carried out by scan
+type scanType struct {
+	idx uint8
+	// after, if not nil, is a stored index key; the scan begins with the key
+	// that follows it rather than with the key of the initial record
+	after []byte
+	// from, if not nil, is an index key; the scan begins with the first key
+	// that is not less than it rather than with the key of the initial record
+	from []byte
+	// within, if not nil, ends the scan at the first key for which it returns
+	// false; it is passed the index key without the primary key suffix of
+	// secondary index entries
+	within func(key []byte) bool
+	// filter, if not nil, is called with the index key of each entry; entries
+	// for which it returns false are skipped
+	filter func(key []byte) bool
+	// keys, if not nil, is called with the index key and primary key of each
+	// entry in place of retrieving the record and calling the callback
+	keys func(key, primaryKey []byte) bool
+	// last is set to a copy of the stored index key of the last record passed
+	// to the callback, and more reports whether a further record was
+	// available when the callback stopped the scan
+	last []byte
+	more bool
+}
+
+// scan is the backing method for Get and its variants. Records are returned
+// in the order of index sc.idx beginning with the key of the initial value of
+// recPtr. Unless db is bound to a transaction, the scan may be carried out in
+// a series of read transactions as directed by Options.ScanYieldRecords and
+// Options.ScanYieldInterval.
+func (db *DB) scan(recPtr Record, sc *scanType, f func() bool) (getErr error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.scan(recPtr, sc, f)
 	}
+	idx := sc.idx
 	count := recPtr.IndexCount()
 	if idx < count {
-		getErr = db.boltDB.View(func(tx *bbolt.Tx) (err error) {
-			var bck bucketGrpType
-			bck, err = bucketGet(recPtr, count, false, tx)
-			if err == nil {
-				var crs *bbolt.Cursor
-				var key, val []byte
-				loop := true
-				key, err = recPtr.Key(idx)
+		// resume is the key at which to continue after yielding
+		var resume []byte
+		yielding := db.tx == nil && (db.opt.ScanYieldRecords > 0 || db.opt.ScanYieldInterval > 0)
+		var scanned, scannedBytes int
+		limit := func(size int) (err error) {
+			scanned++
+			scannedBytes += size
+			if db.opt.MaxScanRecords > 0 && scanned > db.opt.MaxScanRecords {
+				err = fmt.Errorf("%w: more than %d %s records", ErrScanLimit,
+					db.opt.MaxScanRecords, recPtr.Name())
+			} else if db.opt.MaxScanBytes > 0 && scannedBytes > db.opt.MaxScanBytes {
+				err = fmt.Errorf("%w: more than %d bytes of %s records", ErrScanLimit,
+					db.opt.MaxScanBytes, recPtr.Name())
+			}
+			return
+		}
+		for pass := true; pass && getErr == nil; {
+			pass = false
+			getErr = db.view(func(tx *bbolt.Tx) (err error) {
+				var bck bucketGrpType
+				bck, err = bucketGet(recPtr, count, false, tx)
 				if err == nil {
+					var crs *bbolt.Cursor
+					var key, val []byte
+					loop := true
+					start, visited := time.Now(), 0
 					crs = bck.idxs[idx].Cursor()
-					key, val = crs.Seek(key)
-					for key != nil && err == nil && loop {
-						if idx > 0 {
-							// We're using a non-primary index. The value is the primary key, so we
-							// need to do another lookup to get the actual record.
-							val = bck.idxs[0].Get(val)
-							if val == nil {
-								err = ErrMissingRecord
-							}
+					if resume != nil {
+						key, val = crs.Seek(resume)
+					} else if sc.after != nil {
+						key, val = crs.Seek(sc.after)
+						if bytes.Equal(key, sc.after) {
+							key, val = crs.Next()
 						}
+					} else if sc.from != nil {
+						key, val = crs.Seek(sc.from)
+					} else {
+						key, err = recPtr.Key(idx)
 						if err == nil {
-							err = recPtr.UnmarshalBinary(val)
-							if err == nil {
-								loop = f()
-								if loop {
-									key, val = crs.Next()
+							key, val = crs.Seek(key)
+						}
+					}
+					inRange := func() bool {
+						if key == nil || sc.within == nil {
+							return key != nil
+						}
+						if idx > 0 {
+							return sc.within(key[:len(key)-len(val)])
+						}
+						return sc.within(key)
+					}
+					for err == nil && loop && inRange() {
+						// ent is the index key without the primary key suffix that makes
+						// entries of secondary indexes unique
+						ent, pk := key, key
+						if idx > 0 {
+							ent, pk = key[:len(key)-len(val)], val
+						}
+						if sc.filter == nil || sc.filter(ent) {
+							sc.last = append(sc.last[:0], key...)
+							if sc.keys != nil {
+								err = limit(len(key))
+								if err == nil {
+									loop = sc.keys(ent, val)
+								}
+							} else {
+								if idx > 0 {
+									// We're using a non-primary index. The value is the primary key, so we
+									// need to do another lookup to get the actual record.
+									val = bck.idxs[0].Get(val)
+									if val == nil {
+										err = ErrMissingRecord
+									}
+								}
+								if err == nil {
+									err = limit(len(val))
+								}
+								if err == nil {
+									val, err = bck.migrate(recPtr, pk, val)
+								}
+								if err == nil {
+									err = decode(recPtr, val)
+									if err == nil {
+										loop = f()
+									}
 								}
 							}
 						}
+						if err == nil {
+							key, val = crs.Next()
+						}
+						visited++
+						if yielding && err == nil && loop && inRange() &&
+							(visited == db.opt.ScanYieldRecords ||
+								db.opt.ScanYieldInterval > 0 && time.Since(start) >= db.opt.ScanYieldInterval) {
+							// Let the transaction end and continue in a new one
+							resume, pass = concat(key), true
+							break
+						}
 					}
+					sc.more = err == nil && !loop && inRange()
 				}
-			}
-			return
-		})
+				return
+			})
+		}
 	} else {
 		getErr = fmt.Errorf("index %d too large, must be less than %d", idx, count)
 	}
 	return
 }
 
+// Get returns zero or more records. It calls f iteratively until f() returns
+// false or no more records are found. For each call of f, the record variable
+// pointed to be recPtr will be populated with a successive value from the
+// database. The record order is determined by the index specified by idx. The
+// first record returned is the first one that matches the initial value of the
+// record pointed to by recPtr. Only the field or fields that make up the key
+// associated with index idx need to be assigned initially.
+func (db *DB) Get(recPtr Record, idx uint8, f func() bool) (getErr error) {
+	return db.scan(recPtr, &scanType{idx: idx}, f)
+}
+
+// GetWhere functions like Get except that entries of index idx are passed to
+// keep before their records are retrieved. Only records whose keys are
+// accepted by keep are unmarshalled and passed to f. For index 0, keep is
+// passed the primary key; for other indexes it is passed the index key without
+// the primary key. The slice is valid only for the duration of the call to
+// keep and must not be modified. Because rejected entries cost little more
+// than a cursor step, this is much faster than Get for selective scans of
+// large tables.
+func (db *DB) GetWhere(recPtr Record, idx uint8, keep func(key []byte) bool, f func() bool) error {
+	return db.scan(recPtr, &scanType{idx: idx, filter: keep}, f)
+}
+
+// GetKeys functions like Get except that f is passed the key of each entry
+// of index idx, and the primary key of the record it refers to, rather than
+// the record itself. Records are neither retrieved nor unmarshalled, so a scan
+// of keys is much faster than a scan of records. For index 0, key and
+// primaryKey are the same. The slices are valid only for the duration of the
+// call to f and must not be modified. The record pointed to by recPtr is used
+// only to determine the first entry; it is not modified.
+func (db *DB) GetKeys(recPtr Record, idx uint8, f func(key, primaryKey []byte) bool) error {
+	return db.scan(recPtr, &scanType{idx: idx, keys: f}, nil)
+}
+
+// GetRange functions like Get except that the iteration also stops once the
+// index passes the key of the record pointed to by hiPtr. That is, records are
+// returned whose key for index idx lies between the keys of loPtr and hiPtr
+// inclusive. Only the field or fields that make up the key associated with
+// index idx need to be assigned in either record. loPtr is populated with
+// each record returned; hiPtr is not modified. Keys are compared byte by byte,
+// so a key that begins with the high key but is longer lies above it. Since
+// the entries of a secondary index are stored with the primary key appended,
+// a range of a secondary index is exact only if its keys have a fixed width,
+// as those packed by store.KeyBuffer do.
+func (db *DB) GetRange(loPtr, hiPtr Record, idx uint8, f func() bool) (getErr error) {
+	var hi []byte
+	hi, getErr = hiPtr.Key(idx)
+	if getErr == nil {
+		getErr = db.scan(loPtr, &scanType{idx: idx, within: func(key []byte) bool {
+			return bytes.Compare(key, hi) <= 0
+		}}, f)
+	}
+	return
+}
+
+// GetPrefix functions like Get except that only records whose key for index
+// idx begins with the first prefixLen bytes of the key of the initial value of
+// recPtr are returned. The iteration stops as soon as the prefix no longer
+// matches. Typically, the leading fields of a multi-field key are assigned and
+// prefixLen is the combined width of those fields. If prefixLen is greater
+// than the length of the key, the entire key is used.
+func (db *DB) GetPrefix(recPtr Record, idx uint8, prefixLen int, f func() bool) (getErr error) {
+	var prefix []byte
+	prefix, getErr = recPtr.Key(idx)
+	if getErr == nil {
+		if prefixLen < len(prefix) {
+			prefix = concat(prefix[:prefixLen])
+		}
+		getErr = db.scan(recPtr, &scanType{idx: idx, within: func(key []byte) bool {
+			return bytes.HasPrefix(key, prefix)
+		}}, f)
+	}
+	return
+}
+
 // GetRec returns zero or one record from the database. The first record that
 // matches the key field or fields associated with index idx will be put in the
 // variable pointed to be recPtr. In this case, an error value of nil is
@@ -286,38 +902,211 @@ func (db *DB) GetRec(recPtr Record, idx uint8) (err error) {
 	return
 }
 
+// position populates recPtr with the record at the position in index idx to
+// which seek moves a cursor. ErrRecNotFound is returned if there is no record
+// at that position.
+func (db *DB) position(recPtr Record, idx uint8, seek func(crs *bbolt.Cursor) (key, val []byte)) (getErr error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.position(recPtr, idx, seek)
+	}
+	count := recPtr.IndexCount()
+	if idx < count {
+		getErr = db.view(func(tx *bbolt.Tx) (err error) {
+			var bck bucketGrpType
+			bck, err = bucketGet(recPtr, count, false, tx)
+			if err == nil {
+				key, val := seek(bck.idxs[idx].Cursor())
+				pk := key
+				if key == nil {
+					err = ErrRecNotFound
+				} else if idx > 0 {
+					pk = val
+					val = bck.idxs[0].Get(pk)
+					if val == nil {
+						err = ErrMissingRecord
+					}
+				}
+				if err == nil {
+					val, err = bck.migrate(recPtr, pk, val)
+				}
+				if err == nil {
+					err = decode(recPtr, val)
+				}
+			}
+			return
+		})
+	} else {
+		getErr = fmt.Errorf("index %d too large, must be less than %d", idx, count)
+	}
+	return
+}
+
+// FirstRec populates the record pointed to by recPtr with the record that
+// has the smallest key in index idx. ErrRecNotFound is returned if no records
+// are stored.
+func (db *DB) FirstRec(recPtr Record, idx uint8) error {
+	return db.position(recPtr, idx, func(crs *bbolt.Cursor) ([]byte, []byte) {
+		return crs.First()
+	})
+}
+
+// LastRec populates the record pointed to by recPtr with the record that has
+// the largest key in index idx, for example the most recently added record
+// when the primary key is an autoincremented ID. ErrRecNotFound is returned if
+// no records are stored.
+func (db *DB) LastRec(recPtr Record, idx uint8) error {
+	return db.position(recPtr, idx, func(crs *bbolt.Cursor) ([]byte, []byte) {
+		return crs.Last()
+	})
+}
+
+// storedKey returns the key under which the record pointed to by recPtr is
+// stored in index idx. The keys of secondary indexes are followed by the
+// primary key.
+func storedKey(recPtr Record, idx uint8) (key []byte, err error) {
+	key, err = recPtr.Key(idx)
+	if err == nil && idx > 0 {
+		var primaryKey []byte
+		primaryKey, err = recPtr.Key(0)
+		key = concat(key, primaryKey)
+	}
+	return
+}
+
+// NextRec replaces the record pointed to by recPtr with the record that
+// immediately follows it in index idx. For a secondary index, the fields that
+// make up the primary key must be assigned as well as those of index idx; a
+// record retrieved from the database satisfies this. The record itself need
+// not be stored. ErrRecNotFound is returned, and recPtr is left unchanged, if
+// there is no following record.
+func (db *DB) NextRec(recPtr Record, idx uint8) (err error) {
+	var key []byte
+	key, err = storedKey(recPtr, idx)
+	if err == nil {
+		err = db.position(recPtr, idx, func(crs *bbolt.Cursor) ([]byte, []byte) {
+			k, v := crs.Seek(key)
+			if bytes.Equal(k, key) {
+				k, v = crs.Next()
+			}
+			return k, v
+		})
+	}
+	return
+}
+
+// PrevRec functions like NextRec but retrieves the record that immediately
+// precedes the record pointed to by recPtr.
+func (db *DB) PrevRec(recPtr Record, idx uint8) (err error) {
+	var key []byte
+	key, err = storedKey(recPtr, idx)
+	if err == nil {
+		err = db.position(recPtr, idx, func(crs *bbolt.Cursor) ([]byte, []byte) {
+			k, _ := crs.Seek(key)
+			if k == nil {
+				return crs.Last()
+			}
+			return crs.Prev()
+		})
+	}
+	return
+}
+
+// GetAll returns the records that Get would pass to its callback, in the
+// order determined by index idx, as a slice. The first record returned is the
+// first one that matches the initial value of the record pointed to by start,
+// which is used as the working buffer. If max is greater than zero, no more
+// than max records are returned. As with any retained record, the
+// UnmarshalBinary method of the record type must not keep references to the
+// data it is passed.
+func GetAll[T any, P interface {
+	*T
+	Record
+}](db *DB, start P, idx uint8, max int) (list []T, err error) {
+	err = db.Get(start, idx, func() bool {
+		list = append(list, *start)
+		return max <= 0 || len(list) < max
+	})
+	return
+}
+
+// Exists reports whether a record is stored whose key for index idx matches
+// that of the record pointed to by recPtr. Only the field or fields that make
+// up the key associated with index idx need to be assigned. The check is made
+// with a single cursor seek; no record is read or unmarshalled, and recPtr is
+// not modified. If no records of the type have been stored, false is returned
+// without error.
+func (db *DB) Exists(recPtr Record, idx uint8) (found bool, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.Exists(recPtr, idx)
+	}
+	count := recPtr.IndexCount()
+	if idx < count {
+		var want []byte
+		want, err = recPtr.Key(idx)
+		// A record with an empty secondary key has no entry in the index, and
+		// a primary key that is absent from the Bloom filter is not stored
+		if err == nil && (idx == 0 || len(want) > 0) && (idx > 0 || db.blooms[recPtr.Name()].mayHave(want)) {
+			err = db.view(func(tx *bbolt.Tx) (err error) {
+				if tx.Bucket([]byte(recPtr.Name())) != nil {
+					var bck bucketGrpType
+					bck, err = bucketGet(recPtr, count, false, tx)
+					if err == nil {
+						key, _ := bck.idxs[idx].Cursor().Seek(want)
+						if idx == 0 {
+							found = bytes.Equal(key, want)
+						} else {
+							// Secondary keys are followed by the primary key
+							found = bytes.HasPrefix(key, want)
+						}
+					}
+				}
+				return
+			})
+		}
+	} else {
+		err = fmt.Errorf("index %d too large, must be less than %d", idx, count)
+	}
+	return
+}
+
 // Delete removes records and their associated keys from the database. recPtr
 // is a pointer to a variable that will, each time f() returns true, be
 // populated with a successive value to be delete. The iteration is stopped
 // when f() returns false. Only the field or fields needed to generate the
-// primary key (index 0) need be assigned.
+// primary key (index 0) need be assigned. ErrImmutable is returned if the
+// type implements the Immutable interface; see ForceDelete.
 func (db *DB) Delete(recPtr Record, f func() bool) (delErr error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.Delete(recPtr, f)
+	}
+	if immutable(recPtr) {
+		return fmt.Errorf("%w: cannot delete %s records", ErrImmutable, recPtr.Name())
+	}
+	return db.recsDelete(recPtr, f)
+}
+
+// recsDelete removes the records with which f populates recPtr.
+func (db *DB) recsDelete(recPtr Record, f func() bool) (delErr error) {
 	loop := true
+	batchSize := db.batchSize()
 	count := recPtr.IndexCount()
 	for loop && delErr == nil {
-		delErr = db.boltDB.Update(func(tx *bbolt.Tx) (err error) {
-			var k uint8
-			var currentVal valType
+		delErr = db.update(func(tx *bbolt.Tx) (err error) {
 			var bck bucketGrpType
 			var primaryKey []byte
 			var scratch Record
 			bck, err = bucketGet(recPtr, count, false, tx)
 			if err == nil {
+				bck.derive = db.deriver(tx, recPtr)
 				scratch = recPtr.New()
-				for j := 0; j < cnLoopCount && loop && err == nil; j++ {
+				for j := 0; j < batchSize && loop && err == nil; j++ {
 					loop = f()
 					if loop {
 						// f() returned true; this indicates that the app has populated the
 						// variable pointed to by recPtr with a record to be deleted.
 						primaryKey, err = recPtr.Key(0)
 						if err == nil {
-							currentVal, err = bck.currentGet(scratch, count, primaryKey)
-							if err == nil {
-								for k = 0; k < count && err == nil; k++ {
-									err = bck.idxs[k].Delete(currentVal.keys[k])
-									// log.Printf("Deleted %v", currentVal.keys[k])
-								}
-							}
+							err = bck.recDelete(scratch, count, primaryKey)
 						}
 					}
 				}
@@ -335,11 +1124,99 @@ func (db *DB) DeleteRec(recPtr Record) (err error) {
 	return db.Delete(recPtr, limit(1))
 }
 
+// DeleteByPrefixKeys removes every record whose key for index idx begins with
+// prefix. The matching primary keys are taken directly from the index. If
+// the type has no secondary index other than idx, and it is neither a
+// MultiKeyer nor the source of derived records (see Options.Derived), the
+// records are removed without being decoded; neither UnmarshalBinary nor Key
+// is called on stored records. Otherwise the entries that the records have in
+// the other indexes can only be found from the records themselves, so each
+// record is decoded and removed as Delete would remove it. Only the type of
+// recPtr is used. The number of deleted records is returned. ErrImmutable is
+// returned if the type implements the Immutable interface.
+func (db *DB) DeleteByPrefixKeys(recPtr Record, idx uint8, prefix []byte) (n int, delErr error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.DeleteByPrefixKeys(recPtr, idx, prefix)
+	}
+	count := recPtr.IndexCount()
+	if idx >= count {
+		return 0, fmt.Errorf("index %d too large, must be less than %d", idx, count)
+	}
+	if immutable(recPtr) {
+		return 0, fmt.Errorf("%w: cannot delete %s records", ErrImmutable, recPtr.Name())
+	}
+	_, multi := recPtr.(MultiKeyer)
+	others := count > 2 || (count == 2 && (idx == 0 || multi))
+	batchSize := db.batchSize()
+	loop := true
+	for loop && delErr == nil {
+		delErr = db.update(func(tx *bbolt.Tx) (err error) {
+			var bck bucketGrpType
+			bck, err = bucketGet(recPtr, count, false, tx)
+			if err == nil {
+				var idxKeys, pkList [][]byte
+				pkSet := make(map[string]bool)
+				crs := bck.idxs[idx].Cursor()
+				key, val := crs.Seek(prefix)
+				for key != nil && bytes.HasPrefix(key, prefix) && len(idxKeys) < batchSize {
+					if idx == 0 {
+						val = key
+					}
+					idxKeys = append(idxKeys, concat(key))
+					if !pkSet[string(val)] {
+						pkSet[string(val)] = true
+						pkList = append(pkList, concat(val))
+					}
+					key, val = crs.Next()
+				}
+				loop = len(idxKeys) == batchSize
+				bck.derive = db.deriver(tx, recPtr)
+				if others || bck.derive != nil {
+					scratch := recPtr.New()
+					for j := 0; j < len(pkList) && err == nil; j++ {
+						err = bck.recDelete(scratch, count, pkList[j])
+					}
+					// Entries that refer to missing records are removed as well
+					for j := 0; j < len(idxKeys) && err == nil; j++ {
+						err = bck.idxs[idx].Delete(idxKeys[j])
+					}
+				} else {
+					err = bck.countAdd(recPtr.Name(), -len(pkList))
+					for j := 0; j < len(pkList) && err == nil; j++ {
+						err = bck.sizeAdd(recPtr.Name(), len(bck.idxs[0].Get(pkList[j])), -1)
+					}
+					for j := 0; j < len(idxKeys) && err == nil; j++ {
+						err = bck.idxs[idx].Delete(idxKeys[j])
+					}
+					if idx > 0 && err == nil {
+						err = bck.expiryDrop(recPtr, idx, idxKeys...)
+					}
+					for j := 0; j < len(pkList) && err == nil; j++ {
+						if idx > 0 {
+							err = bck.idxs[0].Delete(pkList[j])
+						}
+						if err == nil {
+							err = bck.formatDrop(pkList[j])
+						}
+					}
+				}
+				if err == nil {
+					n += len(pkList)
+				}
+			}
+			return
+		})
+	}
+	return
+}
+
 type idxPutType struct {
 	bck             bucketGrpType
 	recPtr, scratch Record
 	f               func() bool
 	count           uint8
+	written         int  // Bytes of data and keys stored
+	rewrite         bool // Record is the stored record re-encoded by RewriteAll
 }
 
 func (p *idxPutType) idxPut() (err error) {
@@ -350,11 +1227,18 @@ func (p *idxPutType) idxPut() (err error) {
 		currentVal, recVal valType
 		primaryKey         []byte
 	)
-	recVal, err = valGet(p.recPtr, p.count)
+	err = constrain(p.recPtr)
 	if err == nil {
+		err = p.bck.revise(p.recPtr, p.scratch)
+	}
+	if err == nil {
+		recVal, err = valGet(p.recPtr, p.count)
 		if err == nil {
 			primaryKey = recVal.keys[0]
 			currentVal, err = p.bck.currentGet(p.scratch, p.count, primaryKey)
+			if err == nil && currentVal.data != nil && immutable(p.recPtr) && !p.rewrite {
+				err = fmt.Errorf("%w: %s record %x is already stored", ErrImmutable, p.recPtr.Name(), primaryKey)
+			}
 			if err == nil {
 				// For now, assume that record's data and keys have at least some
 				// differences with those of the currently stored version
@@ -373,8 +1257,11 @@ func (p *idxPutType) idxPut() (err error) {
 						// log.Printf("Comparing %v : %v", currentVal.keys[k], recVal.keys[k])
 						different = !bytes.Equal(currentVal.keys[k], recVal.keys[k])
 						addList[k] = different
-						if different {
+						if different && currentVal.keys[k] != nil {
 							err = p.bck.idxs[k].Delete(currentVal.keys[k])
+							if err == nil {
+								err = p.bck.expiryDrop(p.recPtr, k, currentVal.keys[k])
+							}
 							// log.Printf("Changed %v : %v", currentVal.keys[k], recVal.keys[k])
 						}
 					}
@@ -386,12 +1273,52 @@ func (p *idxPutType) idxPut() (err error) {
 				// buffer key, delete the stored key and put the buffered key. Equal keys can be
 				// ignored.
 				if err == nil {
-					err = p.bck.idxs[0].Put(recVal.keys[0], recVal.data)
+					p.written += len(recVal.data)
+					for k = 0; k < p.count; k++ {
+						p.written += len(recVal.keys[k])
+					}
+					oldSize := -1
+					if currentVal.data == nil {
+						err = p.bck.countAdd(p.recPtr.Name(), 1)
+					} else {
+						oldSize = len(currentVal.data)
+					}
+					if err == nil {
+						err = p.bck.sizeAdd(p.recPtr.Name(), oldSize, len(recVal.data))
+					}
+					if err == nil {
+						err = p.bck.idxs[0].Put(recVal.keys[0], recVal.data)
+					}
+					if err == nil && p.bck.oversize != nil {
+						p.bck.oversize(recVal.keys[0], len(recVal.data))
+					}
+					if err == nil {
+						err = p.bck.formatNote(p.recPtr, recVal.keys[0])
+					}
 					for k = 1; k < p.count && err == nil; k++ {
-						if addList[k] {
+						if addList[k] && recVal.keys[k] != nil {
 							err = p.bck.idxs[k].Put(recVal.keys[k], primaryKey)
 						}
 					}
+					if err == nil {
+						err = p.setsPut(currentVal, recVal, primaryKey)
+					}
+					if err == nil && p.bck.bloom != nil {
+						p.bck.bloom.put(p.bck.idxs[0], primaryKey)
+					}
+					if err == nil && p.bck.sketch {
+						err = sketchAdd(p.bck.rec.Tx(), p.recPtr.Name(), recVal)
+					}
+					if err == nil {
+						err = p.bck.expiryNote(p.recPtr, recVal)
+					}
+				}
+				if err == nil && p.bck.derive != nil {
+					var old Record
+					if currentVal.data != nil {
+						old = p.scratch
+					}
+					err = p.bck.derive(old, p.recPtr)
 				}
 			}
 		}
@@ -399,42 +1326,59 @@ func (p *idxPutType) idxPut() (err error) {
 	return
 }
 
-// recPut is the backing method for Add and Put.
-func (db *DB) recPut(recPtr Record, f func() bool, add bool) (putErr error) {
-	if db.boltDB == nil {
-		return ErrNotOpen
+// next stores the record that the application has just populated. If the
+// record is being inserted through a call to Add(), an autoincremented ID is
+// passed to the application first.
+func (p *idxPutType) next(add bool) (err error) {
+	if add {
+		var autoID uint64
+		autoID, err = p.bck.idxs[0].NextSequence()
+		if err == nil {
+			p.recPtr.NextID(autoID)
+		}
+	}
+	if err == nil {
+		err = p.idxPut()
+	}
+	return
+}
+
+// recPut is the backing method for Add and Put. If batchEnd is not nil, it is
+// called at the end of each writeable transaction.
+func (db *DB) recPut(recPtr Record, f func() bool, add bool, batchEnd func(*bbolt.Tx) error) (putErr error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.recPut(recPtr, f, add, batchEnd)
 	}
 	var put idxPutType
 	put.recPtr = recPtr
 	put.f = f
 	loop := true
+	batchSize := db.batchSize()
+	batchBytes := db.batchBytes()
 	createIfNeeded := true
 	put.count = recPtr.IndexCount()
 	for loop && putErr == nil {
-		putErr = db.boltDB.Update(func(tx *bbolt.Tx) (err error) {
+		putErr = db.update(func(tx *bbolt.Tx) (err error) {
 			put.bck, err = bucketGet(recPtr, put.count, createIfNeeded, tx)
 			if err == nil {
+				put.bck.derive = db.deriver(tx, recPtr)
+				put.bck.bloom = db.blooms[recPtr.Name()]
+				put.bck.sketch = db.sketched(recPtr)
+				put.bck.oversize = db.oversize(recPtr)
 				put.scratch = recPtr.New()
+				put.written = 0
 				createIfNeeded = false
-				for j := 0; j < cnLoopCount && loop && err == nil; j++ {
+				for j := 0; j < batchSize && loop && err == nil && (batchBytes == 0 || put.written < batchBytes); j++ {
 					loop = f()
 					if loop {
 						// f() returned true; this indicates that the app has populated the
-						// variable pointed to by recPtr with a record to be stored. If the
-						// record is being inserted through a call to Add(), pass an
-						// autoincremented ID to the application now.
-						if add {
-							var autoID uint64
-							autoID, err = put.bck.idxs[0].NextSequence()
-							if err == nil {
-								recPtr.NextID(autoID)
-							}
-						}
-						if err == nil {
-							err = put.idxPut()
-						}
+						// variable pointed to by recPtr with a record to be stored.
+						err = put.next(add)
 					}
 				} // loop
+				if err == nil && batchEnd != nil {
+					err = batchEnd(tx)
+				}
 			}
 			return
 		})
@@ -452,7 +1396,7 @@ func (db *DB) recPut(recPtr Record, f func() bool, add bool) (putErr error) {
 // each record processed by this method be properly assigned. This assures that
 // modified keys are properly replaced.
 func (db *DB) Put(recPtr Record, f func() bool) (putErr error) {
-	return db.recPut(recPtr, f, false)
+	return db.recPut(recPtr, f, false, nil)
 }
 
 // PutRec inserts or replaces one record in the database. recPtr is a pointer
@@ -469,7 +1413,7 @@ func (db *DB) PutRec(recPtr Record) (err error) {
 // keys of each record processed by this method be properly assigned. This
 // assures that modified keys are properly replaced.
 func (db *DB) Add(recPtr Record, f func() bool) (putErr error) {
-	return db.recPut(recPtr, f, true)
+	return db.recPut(recPtr, f, true, nil)
 }
 
 // AddRec inserts one record in the database. recPtr is a pointer to a variable
@@ -508,23 +1452,79 @@ func hexView(wr io.Writer, crs *bbolt.Cursor, indent int) {
 	}
 }
 
+// RecordTypes returns the record types registered with Options.Records when
+// the database was opened.
+func (db *DB) RecordTypes() []Record {
+	return db.opt.Records
+}
+
 // HexDump is a diagnostic routine to help with viewing the records and keys in
 // a database.
 func (db *DB) HexDump(wr io.Writer) {
-	if db.boltDB != nil {
-		db.boltDB.View(func(tx *bbolt.Tx) (err error) {
-			hexView(wr, tx.Cursor(), 0)
-			return
-		})
-	}
+	db.view(func(tx *bbolt.Tx) (err error) {
+		hexView(wr, tx.Cursor(), 0)
+		return
+	})
 }
 
-// Close shuts down the database and releases all associated resources. Any
-// subsequent calls to methods of DB will result in an error.
+// Close shuts down the database and releases all associated resources,
+// including any databases attached with Attach. Any subsequent calls to
+// methods of DB will result in an error.
 func (db *DB) Close() (err error) {
+	var tmpPath string
+	db.mu.Lock()
+	if db.viewOf != nil {
+		// A view shares the file of the database it was opened from
+		release := db.release
+		db.viewOf, db.tx, db.release = nil, nil, nil
+		db.mu.Unlock()
+		if release != nil {
+			release()
+		}
+		return nil
+	}
 	if db.boltDB != nil {
-		err = db.boltDB.Close()
-		db.boltDB = nil
+		// Let the record types finish their work while the database is still
+		// usable
+		db.mu.Unlock()
+		db.lifecycleClose(len(db.opt.Records))
+		db.mu.Lock()
+	}
+	bdb := db.boltDB
+	db.boltDB = nil
+	compact := db.compact && db.snap == nil
+	if db.snap != nil {
+		tmpPath = db.snap.path
+	}
+	list := db.attached
+	db.attached = nil
+	db.mu.Unlock()
+	for _, a := range list {
+		a.db.Close()
+	}
+	if bdb != nil {
+		var compactPath string
+		path := bdb.Path()
+		unregister(db)
+		if compact {
+			compactPath, err = compactTemp(bdb, path)
+		}
+		closeErr := bdb.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if compactPath != "" {
+			if err == nil {
+				err = os.Rename(compactPath, path)
+			}
+			if err != nil {
+				os.Remove(compactPath)
+			}
+		}
+		db.unlock()
+		if tmpPath != "" {
+			os.Remove(tmpPath)
+		}
 	} else {
 		err = ErrNotOpen
 	}
@@ -543,33 +1543,152 @@ func exists(path string) (ok bool) {
 }
 
 func open(path string, mode os.FileMode, options Options) (db *DB, err error) {
-	db = new(DB)
-	db.boltDB, err = bbolt.Open(path, mode, &options.BoltOpt)
+	var lockFl string
+	err = checkNetworkFS(path, options)
+	if err == nil {
+		lockFl, err = lockAcquire(path, options)
+	}
+	if err == nil {
+		db, err = openLocked(path, mode, options, lockFl)
+	}
+	return
+}
+
+// openLocked opens the database at path. lockFl names the sidecar lock file,
+// if any, that the caller has already created; it is removed if the database
+// cannot be opened.
+func openLocked(path string, mode os.FileMode, options Options, lockFl string) (db *DB, err error) {
+	db = &DB{lockFl: lockFl}
+	if options.PageSize != 0 {
+		options.BoltOpt.PageSize = options.PageSize
+	}
+	err = retry(options, func() (err error) {
+		db.boltDB, err = bbolt.Open(path, mode, &options.BoltOpt)
+		return
+	})
 	if err == nil {
 		db.opt = options
-	} else {
+		if options.SmallFootprint {
+			db.boltDB.AllocSize = cnSmallAllocSize
+		}
+		err = filePrepare(path, options)
+		if err == nil {
+			err = db.headerInit()
+		}
+		if err == nil {
+			err = db.structureCheck()
+		}
+		if err == nil {
+			err = db.backfill()
+		}
+		if err == nil {
+			err = db.typesCheck()
+		}
+		if err == nil {
+			err = db.bloomInit()
+		}
+		if err == nil {
+			err = db.sketchInit()
+		}
+		if err == nil {
+			err = db.lifecycleOpen()
+		}
+		if err == nil {
+			register(db, path)
+		} else {
+			db.boltDB.Close()
+		}
+	} else if inUse(err) {
+		err = fmt.Errorf("%w: \"%s\" (%v)", ErrLocked, path, err)
+	}
+	if err != nil {
+		db.unlock()
 		db = nil
 	}
 	return
 }
 
+// errNotExist returns the error reported when the database file at path does
+// not exist.
+func errNotExist(path string) error {
+	return fmt.Errorf("file \"%s\" does not exist", path)
+}
+
 // Open opens an existing Pinion database.
 func Open(path string, mode os.FileMode, options Options) (db *DB, err error) {
 	if exists(path) {
 		db, err = open(path, mode, options)
 	} else {
-		err = fmt.Errorf("file \"%s\" does not exist", path)
+		err = errNotExist(path)
+	}
+	return
+}
+
+// tempSeq distinguishes the temporary files of concurrent operations
+var tempSeq uint64
+
+// tempName returns the name of a temporary file in the directory of path from
+// which a new file is to be renamed to path.
+func tempName(path string) string {
+	return fmt.Sprintf("%s.%d-%d.tmp", path, os.Getpid(), atomic.AddUint64(&tempSeq, 1))
+}
+
+// createTemp creates and initializes a database in a temporary file in the
+// directory of path, then renames the file to path, replacing any existing
+// file. The rename is atomic, so a database file that is only partly
+// initialized is never found at path. If options.LockFile is set, the caller
+// must already hold the sidecar lock of path, so that the rename cannot
+// replace a database in use by another process.
+func createTemp(path string, mode os.FileMode, options Options) (err error) {
+	var tmp *DB
+	name := tempName(path)
+	// Only the options that affect the initial content of the file apply
+	tmp, err = open(name, mode, Options{
+		BoltOpt:        options.BoltOpt,
+		PageSize:       options.PageSize,
+		OpenRetries:    options.OpenRetries,
+		OpenRetryDelay: options.OpenRetryDelay,
+		AllowNetworkFS: options.AllowNetworkFS,
+		Clock:          options.Clock,
+		Rand:           options.Rand,
+	})
+	if err == nil {
+		err = tmp.Close()
+		if err == nil {
+			err = retry(options, func() error {
+				return os.Rename(name, path)
+			})
+		}
+		if err != nil {
+			os.Remove(name)
+		}
 	}
 	return
 }
 
 // Create creates a Pinion database. The file is replaced if it already exists.
+// The new database is initialized in a temporary file, named after path with
+// a ".tmp" suffix, that is renamed to path when it is complete, so a crash
+// during Create leaves either the previous file or a complete new one at path.
+// A temporary file left behind by such a crash can be removed.
 func Create(path string, mode os.FileMode, options Options) (db *DB, err error) {
-	if exists(path) {
-		err = os.Remove(path)
+	if options.PageSize != 0 && (options.PageSize < 1024 || options.PageSize&(options.PageSize-1) != 0) {
+		return nil, fmt.Errorf("invalid page size %d, must be a power of two no smaller than 1024", options.PageSize)
 	}
+	var lockFl string
+	err = dirPrepare(path, options)
 	if err == nil {
-		db, err = open(path, mode, options)
+		// The lock is taken before the file at path is replaced so that a
+		// database in use by another process is left intact
+		lockFl, err = lockAcquire(path, options)
+	}
+	if err == nil {
+		err = createTemp(path, mode, options)
+		if err == nil {
+			db, err = openLocked(path, mode, options, lockFl)
+		} else if lockFl != "" {
+			os.Remove(lockFl)
+		}
 	}
 	return
 }
@@ -17,13 +17,19 @@
 package pinion_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
 	"github.com/piniondb/str"
 	"go.etcd.io/bbolt"
 )
@@ -237,6 +243,57 @@ func BenchmarkStoreRoundtrip(b *testing.B) {
 	}
 }
 
+// benchDelete times the removal, by del, of all of the records of a database
+// holding 5000 words.
+func benchDelete(b *testing.B, del func(db *pinion.DB) error) {
+	var db *pinion.DB
+	var err error
+	for j := 0; j < b.N && err == nil; j++ {
+		b.StopTimer()
+		db, err = pinion.Create("example/benchdel.db", 0600, pinion.Options{})
+		if err == nil {
+			id := 0
+			var w wordType
+			err = db.Put(&w, func() bool {
+				id++
+				w.word = fmt.Sprintf("w%05d", id)
+				return id <= 5000
+			})
+		}
+		if err == nil {
+			b.StartTimer()
+			err = del(db)
+			b.StopTimer()
+			db.Close()
+		}
+	}
+	if err != nil {
+		b.Error(err)
+	}
+}
+
+// BenchmarkDelete times the removal of records, each of which is decoded.
+func BenchmarkDelete(b *testing.B) {
+	benchDelete(b, func(db *pinion.DB) error {
+		id := 0
+		var w wordType
+		return db.Delete(&w, func() bool {
+			id++
+			w.word = fmt.Sprintf("w%05d", id)
+			return id <= 5000
+		})
+	})
+}
+
+// BenchmarkDeleteByPrefixKeys times the removal of records by way of their
+// only secondary index, without decoding them.
+func BenchmarkDeleteByPrefixKeys(b *testing.B) {
+	benchDelete(b, func(db *pinion.DB) error {
+		_, err := db.DeleteByPrefixKeys(&wordType{}, 1, nil)
+		return err
+	})
+}
+
 func notDatabase(t *testing.T) {
 	var err error
 	var fileStr = "README.md"
@@ -542,6 +599,250 @@ func TestDB_ManySmallRecs(t *testing.T) {
 	}
 }
 
+// Test writing with small transactions
+func TestDB_SmallFootprint(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var count int
+	var id uint32
+	const fileStr = "example/small.db"
+	for _, opt := range []pinion.Options{{SmallFootprint: true}, {BatchSize: 7}} {
+		db, err = pinion.Create(fileStr, 0600, opt)
+		if err == nil {
+			var q quantityType
+			id = 0
+			err = db.Put(&q, func() bool {
+				if id < 2500 {
+					q = quantityRec(id)
+					id++
+					return true
+				}
+				return false
+			})
+			if err == nil {
+				count, err = quantityCount(db)
+				if err == nil && count != 2500 {
+					t.Fatalf("expecting 2500 records, got %d", count)
+				}
+			}
+			db.Close()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Test detection of a database in use by another process
+func TestDB_Locked(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/locked.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{LockFile: true})
+	if err == nil {
+		_, err = pinion.Open(fileStr, 0600, pinion.Options{LockFile: true, OpenRetries: 2,
+			OpenRetryDelay: time.Millisecond})
+		if !errors.Is(err, pinion.ErrLocked) {
+			t.Fatalf("expecting lock file to be detected, got %v", err)
+		}
+		// Create must not replace a database that is in use
+		q := quantityRec(1)
+		err = db.PutRec(&q)
+		if err == nil {
+			_, err = pinion.Create(fileStr, 0600, pinion.Options{LockFile: true})
+			if !errors.Is(err, pinion.ErrLocked) {
+				t.Fatalf("expecting Create to detect lock file, got %v", err)
+			}
+			err = nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Without the lock file, bbolt's own lock times out
+		opt := pinion.Options{OpenRetries: 1}
+		opt.BoltOpt.Timeout = 10 * time.Millisecond
+		_, err = pinion.Open(fileStr, 0600, opt)
+		if !errors.Is(err, pinion.ErrLocked) {
+			t.Fatalf("expecting bbolt lock timeout, got %v", err)
+		}
+		err = db.Close()
+		if err == nil {
+			db, err = pinion.Open(fileStr, 0600, pinion.Options{LockFile: true})
+			if err == nil {
+				var n uint64
+				n, err = db.Count(&q)
+				if err == nil && n != 1 {
+					t.Fatalf("expecting database to keep its record, got %d", n)
+				}
+				db.Close()
+			}
+		}
+		if _, statErr := os.Stat(fileStr + ".lock"); !os.IsNotExist(statErr) {
+			t.Fatalf("lock file should have been removed")
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test that Create replaces an existing file, even one that is not a
+// database, without leaving its temporary file behind
+func TestDB_CreateReplace(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var ok bool
+	const fileStr = "example/replace.db"
+	err = os.WriteFile(fileStr, []byte("not a database"), 0600)
+	if err == nil {
+		db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	}
+	if err == nil {
+		q := quantityRec(1)
+		err = db.PutRec(&q)
+		if err == nil {
+			err = db.Close()
+		}
+	}
+	if err == nil {
+		db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	}
+	if err == nil {
+		q := quantityRec(1)
+		ok, err = db.Exists(&q, 0)
+		if err == nil && ok {
+			err = errors.New("record survived Create")
+		}
+		db.Close()
+	}
+	if err == nil {
+		// A Create that fails because the database is locked leaves the file
+		// in place
+		var before, after os.FileInfo
+		db, err = pinion.Create(fileStr, 0600, pinion.Options{LockFile: true})
+		if err == nil {
+			before, err = os.Stat(fileStr)
+			if err == nil {
+				_, err = pinion.Create(fileStr, 0600, pinion.Options{LockFile: true})
+				if errors.Is(err, pinion.ErrLocked) {
+					after, err = os.Stat(fileStr)
+				} else {
+					err = fmt.Errorf("expecting ErrLocked, got %v", err)
+				}
+			}
+			if err == nil && !os.SameFile(before, after) {
+				err = errors.New("locked database was replaced")
+			}
+			db.Close()
+		}
+	}
+	if err == nil {
+		var list []string
+		list, err = filepath.Glob(fileStr + ".*.tmp")
+		if err == nil && len(list) > 0 {
+			err = fmt.Errorf("temporary files left behind: %v", list)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test that iterations are stopped at the limits set in the options
+func TestDB_ScanLimit(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/scanlimit.db"
+	db, err = quantityDB(fileStr, 1, 50)
+	if err == nil {
+		db.Close()
+		for _, opt := range []pinion.Options{{MaxScanRecords: 20}, {MaxScanBytes: 100}} {
+			if err == nil {
+				db, err = pinion.Open(fileStr, 0600, opt)
+			}
+			if err == nil {
+				var n int
+				q := quantityRec(1)
+				// A callback that never stops
+				err = db.Get(&q, idxQuantityVal, func() bool {
+					n++
+					return true
+				})
+				if errors.Is(err, pinion.ErrScanLimit) {
+					err = nil
+				} else {
+					err = fmt.Errorf("expecting scan limit error after %d records, got %v", n, err)
+				}
+				if err == nil {
+					// A limited iteration is unaffected
+					n = 0
+					q = quantityRec(1)
+					err = db.Get(&q, idxQuantityID, func() bool {
+						n++
+						return n < 5
+					})
+				}
+				db.Close()
+			}
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test that a long iteration continues in new transactions, and so sees
+// records written meanwhile, unless it is part of a transaction
+func TestDB_ScanYield(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/scanyield.db"
+	db, err = quantityDB(fileStr, 1, 50)
+	if err == nil {
+		db.Close()
+		opt := pinion.Options{ScanYieldRecords: 10}
+		// Avoid remapping, which waits for read transactions to end
+		opt.BoltOpt.InitialMmapSize = 1 << 24
+		db, err = pinion.Open(fileStr, 0600, opt)
+	}
+	if err == nil {
+		// Each scan adds a record with an ID beyond those stored
+		scan := func(extraID uint32, get func(q *quantityType, f func() bool) error) (n int, err error) {
+			q := quantityRec(1)
+			err = get(&q, func() bool {
+				n++
+				if q.id == 5 {
+					extra := quantityRec(extraID)
+					err = db.PutRec(&extra)
+				}
+				return err == nil
+			})
+			return
+		}
+		var n int
+		n, err = scan(100, func(q *quantityType, f func() bool) error {
+			return db.Get(q, idxQuantityID, f)
+		})
+		if err == nil && n != 51 {
+			err = fmt.Errorf("yielding scan visited %d records, expected 51", n)
+		}
+		if err == nil {
+			n, err = scan(200, func(q *quantityType, f func() bool) error {
+				return db.View(func(tx *pinion.Tx) error {
+					return tx.Get(q, idxQuantityID, f)
+				})
+			})
+		}
+		if err == nil && n != 51 {
+			err = fmt.Errorf("scan in transaction visited %d records, expected 51", n)
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 // Test various errors
 func TestDB_Errors(t *testing.T) {
 	notDatabase(t)
@@ -550,3 +851,503 @@ func TestDB_Errors(t *testing.T) {
 	internalErrors(t)
 	indexError(t)
 }
+
+// undecodableQuantityType fails if a stored record is ever decoded
+type undecodableQuantityType struct {
+	quantityType
+}
+
+func (u *undecodableQuantityType) UnmarshalBinary(data []byte) error {
+	return errors.New("record unexpectedly decoded")
+}
+
+// Test removal of records by key prefix
+func TestDB_DeleteByPrefixKeys(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var count, n int
+	var u undecodableQuantityType
+	const fileStr = "example/prefix.db"
+	db, err = quantityDB(fileStr, 250, 520)
+	if err == nil {
+		// IDs 256 through 511 share the leading three bytes of their primary key
+		n, err = db.DeleteByPrefixKeys(&u, 0, store.KeyUint32(256)[:3])
+		if err == nil && n != 256 {
+			t.Fatalf("expecting 256 primary key deletions, got %d", n)
+		}
+		if err == nil {
+			var q quantityType
+			var key, prefix []byte
+			var want int
+			prefix, _ = quantityRec(512).Key(1)
+			prefix = prefix[:1]
+			err = db.Get(&q, 0, func() bool {
+				key, _ = q.Key(1)
+				if bytes.HasPrefix(key, prefix) {
+					want++
+				}
+				return true
+			})
+			if err == nil && want == 0 {
+				t.Fatalf("expecting at least one record with secondary key prefix %x", prefix)
+			}
+			if err == nil {
+				n, err = db.DeleteByPrefixKeys(&u, 1, prefix)
+				if err == nil && n != want {
+					t.Fatalf("expecting %d secondary key deletions, got %d", want, n)
+				}
+			}
+			if err == nil {
+				count, err = quantityCount(db)
+				if err == nil && count != 15-want {
+					t.Fatalf("expecting %d remaining records, got %d", 15-want, count)
+				}
+			}
+			if err == nil {
+				err = db.Check(&q)
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// This example demonstrates the retrieval of records within a range of keys.
+func ExampleDB_GetRange() {
+	var db *pinion.DB
+	var err error
+	db, err = quantityDB("example/range.db", 0, 256)
+	if err == nil {
+		var lo, hi quantityType
+		lo.id = 40
+		hi.id = 43
+		err = db.GetRange(&lo, &hi, idxQuantityID, func() bool {
+			fmt.Println(lo)
+			return true
+		})
+		if err == nil {
+			fmt.Println("---")
+			lo.val, _ = str.QuantityEncode(70)
+			hi.val, _ = str.QuantityEncode(71)
+			err = db.GetRange(&lo, &hi, idxQuantityVal, func() bool {
+				fmt.Println(lo)
+				return true
+			})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [         40 : forty]
+	// [         41 : forty one]
+	// [         42 : forty two]
+	// [         43 : forty three]
+	// ---
+	// [         70 : seventy]
+	// [         78 : seventy eight]
+	// [         75 : seventy five]
+	// [         74 : seventy four]
+	// [         79 : seventy nine]
+	// [         71 : seventy one]
+}
+
+// wordType is a record whose keys vary in length. Its secondary index is
+// keyed by the word spelled backwards.
+type wordType struct {
+	word string
+}
+
+func (w wordType) MarshalBinary() ([]byte, error) {
+	return []byte(w.word), nil
+}
+
+func (w *wordType) UnmarshalBinary(data []byte) error {
+	w.word = string(data)
+	return nil
+}
+
+func (w wordType) Name() string {
+	return "word"
+}
+
+func (w wordType) IndexCount() uint8 {
+	return 2
+}
+
+func (w wordType) New() pinion.Record {
+	return new(wordType)
+}
+
+func (w *wordType) NextID(id uint64) {}
+
+func (w wordType) Key(idx uint8) ([]byte, error) {
+	key := []byte(w.word)
+	if idx == 1 {
+		for j, k := 0, len(key)-1; j < k; j, k = j+1, k-1 {
+			key[j], key[k] = key[k], key[j]
+		}
+	}
+	return key, nil
+}
+
+// Test that GetRange does not pass a high key that is a prefix of the keys
+// that follow it
+func TestDB_GetRangeVariableKeys(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/rangevar.db", 0600, pinion.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, word := range []string{"a", "ba", "ab", "c"} {
+		if err == nil {
+			err = db.PutRec(&wordType{word: word})
+		}
+	}
+	want := []string{"a,ab", "a,ba"}
+	for idx := uint8(0); idx < 2 && err == nil; idx++ {
+		var list []string
+		lo, hi := wordType{word: "a"}, wordType{word: "b"}
+		err = db.GetRange(&lo, &hi, idx, func() bool {
+			list = append(list, lo.word)
+			return true
+		})
+		if got := strings.Join(list, ","); err == nil && got != want[idx] {
+			t.Fatalf("index %d: unexpected records %s", idx, got)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test accumulation of records by a buffered wrapper
+func TestWrapDB_Buffered(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var count int
+	const fileStr = "example/buffered.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{BatchSize: 7})
+	if err == nil {
+		wdb := db.WrapBuffered()
+		for id := uint32(0); id < 50; id++ {
+			q := quantityRec(id)
+			wdb.PutRec(&q)
+		}
+		// Seven full batches have been written; one record remains
+		count, err = quantityCount(db)
+		if err == nil && count != 49 {
+			t.Fatalf("expecting 49 records before flush, got %d", count)
+		}
+		if err == nil {
+			err = wdb.Error()
+		}
+		if err == nil {
+			count, err = quantityCount(db)
+			if err == nil && count != 50 {
+				t.Fatalf("expecting 50 records after flush, got %d", count)
+			}
+		}
+		if err == nil {
+			wdb.AddRec(&staffType{personType{name: nameType{last: "Jones"}}})
+			wdb.AddRec(&staffType{personType{name: nameType{first: "Nobody"}}})
+			if !errors.Is(wdb.Error(), pinion.ErrConstraint) {
+				t.Fatalf("expecting constraint violation, got %v", wdb.Error())
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// This example demonstrates the retrieval of records that share the leading
+// field of a key.
+func ExampleDB_GetPrefix() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/prefix_get.db", 0600, pinion.Options{})
+	if err == nil {
+		var p personType
+		list := []nameType{
+			{last: "Smith", first: "Carol"},
+			{last: "Jones", first: "Robert"},
+			{last: "Smithers", first: "Wayland"},
+			{last: "Smith", first: "Alan"},
+			{last: "Taylor", first: "Ann"},
+		}
+		err = db.Add(&p, func() bool {
+			if len(list) > 0 {
+				p = personType{name: list[0]}
+				list = list[1:]
+				return true
+			}
+			return false
+		})
+		if err == nil {
+			// The last name occupies the first 12 bytes of the key
+			p = personType{name: nameType{last: "Smith"}}
+			err = db.GetPrefix(&p, idxPersonNameLast, 12, func() bool {
+				fmt.Println(p)
+				return true
+			})
+		}
+		if err == nil {
+			fmt.Println("---")
+			p = personType{name: nameType{last: "Smith"}}
+			err = db.GetPrefix(&p, idxPersonNameLast, 5, func() bool {
+				fmt.Println(p)
+				return true
+			})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Alan  Smith / 4
+	// Carol  Smith / 1
+	// ---
+	// Alan  Smith / 4
+	// Carol  Smith / 1
+	// Wayland  Smithers / 3
+}
+
+// This example demonstrates a check for the presence of a key.
+func ExampleDB_Exists() {
+	var db *pinion.DB
+	var err error
+	var found bool
+	db, err = quantityDB("example/exists.db", 1, 10)
+	if err == nil {
+		for _, id := range []uint32{5, 11} {
+			q := quantityRec(id)
+			if err == nil {
+				found, err = db.Exists(&q, idxQuantityID)
+				fmt.Printf("ID %d: %v\n", id, found)
+			}
+			if err == nil {
+				found, err = db.Exists(&q, idxQuantityVal)
+				fmt.Printf("%s: %v\n", str.QuantityDecode(q.val), found)
+			}
+		}
+		if err == nil {
+			found, err = db.Exists(&personType{id: 1}, idxPersonID)
+			fmt.Printf("Person: %v\n", found)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// ID 5: true
+	// five: true
+	// ID 11: false
+	// eleven: false
+	// Person: false
+}
+
+// This example demonstrates the retrieval of records into a slice.
+func ExampleGetAll() {
+	var db *pinion.DB
+	var err error
+	var list []quantityType
+	db, err = quantityDB("example/getall.db", 1, 20)
+	if err == nil {
+		q := quantityRec(17)
+		list, err = pinion.GetAll(db, &q, idxQuantityID, 0)
+		if err == nil {
+			fmt.Println(list)
+			q = quantityType{}
+			list, err = pinion.GetAll(db, &q, idxQuantityVal, 3)
+			fmt.Println(list)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [[         17 : seventeen] [         18 : eighteen] [         19 : nineteen] [         20 : twenty]]
+	// [[          8 : eight] [         18 : eighteen] [         11 : eleven]]
+}
+
+// Test a wrapper shared by several goroutines
+func TestWrapDB_Shared(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var count int
+	var wg sync.WaitGroup
+	const fileStr = "example/shared.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	if err == nil {
+		wdb := db.WrapShared()
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+			go func(lo uint32) {
+				defer wg.Done()
+				for id := lo; id < lo+25; id++ {
+					q := quantityRec(id)
+					wdb.PutRec(&q)
+				}
+			}(uint32(j * 25))
+		}
+		wg.Wait()
+		err = wdb.Error()
+		if err == nil {
+			count, err = quantityCount(db)
+			if err == nil && count != 200 {
+				t.Fatalf("expecting 200 records, got %d", count)
+			}
+		}
+		if err == nil {
+			for j := 0; j < 8; j++ {
+				wg.Add(1)
+				go func(id uint32) {
+					defer wg.Done()
+					q := quantityType{id: id}
+					wdb.GetRec(&q, idxQuantityID)
+				}(uint32(1000 + j))
+			}
+			wg.Wait()
+			if wdb.ErrorClear() != pinion.ErrRecNotFound {
+				t.Fatalf("expecting record not found")
+			}
+			err = wdb.Error()
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// This example demonstrates the retrieval of the records at either end of an
+// index.
+func ExampleDB_LastRec() {
+	var db *pinion.DB
+	var err error
+	var q quantityType
+	db, err = quantityDB("example/firstlast.db", 10, 30)
+	if err == nil {
+		for idx := uint8(0); idx < idxQuantityCount && err == nil; idx++ {
+			err = db.FirstRec(&q, idx)
+			if err == nil {
+				fmt.Printf("%-8s first %s\n", quantityIndexNames[idx], q)
+				err = db.LastRec(&q, idx)
+				if err == nil {
+					fmt.Printf("%-8s last  %s\n", quantityIndexNames[idx], q)
+				}
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// ID       first [         10 : ten]
+	// ID       last  [         30 : thirty]
+	// English  first [         18 : eighteen]
+	// English  last  [         22 : twenty two]
+}
+
+// This example demonstrates navigation to the neighbors of a record.
+func ExampleDB_NextRec() {
+	var db *pinion.DB
+	var err error
+	db, err = quantityDB("example/nextprev.db", 1, 5)
+	if err == nil {
+		q := quantityRec(3)
+		err = db.NextRec(&q, idxQuantityID)
+		if err == nil {
+			fmt.Println("Next by ID:", q)
+			q = quantityRec(3)
+			err = db.PrevRec(&q, idxQuantityID)
+		}
+		if err == nil {
+			fmt.Println("Previous by ID:", q)
+			q = quantityRec(3)
+			err = db.NextRec(&q, idxQuantityVal)
+		}
+		if err == nil {
+			fmt.Println("Next by word:", q)
+			err = db.NextRec(&q, idxQuantityVal)
+			fmt.Println("After last:", err, q)
+			err = db.PrevRec(&q, idxQuantityVal)
+		}
+		if err == nil {
+			fmt.Println("Previous by word:", q)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Next by ID: [          4 : four]
+	// Previous by ID: [          2 : two]
+	// Next by word: [          2 : two]
+	// After last: record not found [          2 : two]
+	// Previous by word: [          3 : three]
+}
+
+// This example demonstrates the selection of records by index key before
+// they are retrieved.
+func ExampleDB_GetWhere() {
+	var db *pinion.DB
+	var err error
+	db, err = quantityDB("example/where.db", 0, 100)
+	if err == nil {
+		var q quantityType
+		err = db.GetWhere(&q, idxQuantityVal, func(key []byte) bool {
+			return strings.HasSuffix(str.QuantityDecode(key), "teen")
+		}, func() bool {
+			fmt.Println(q)
+			return true
+		})
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [         18 : eighteen]
+	// [         15 : fifteen]
+	// [         14 : fourteen]
+	// [         19 : nineteen]
+	// [         17 : seventeen]
+	// [         16 : sixteen]
+	// [         13 : thirteen]
+}
+
+// This example demonstrates a scan of index keys without record retrieval.
+func ExampleDB_GetKeys() {
+	var db *pinion.DB
+	var err error
+	db, err = quantityDB("example/keys.db", 1, 4)
+	if err == nil {
+		var q quantityType
+		err = db.GetKeys(&q, idxQuantityVal, func(key, primaryKey []byte) bool {
+			fmt.Printf("%-12s %x\n", str.QuantityDecode(key), primaryKey)
+			return true
+		})
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// four         00000004
+	// one          00000001
+	// three        00000003
+	// two          00000002
+}
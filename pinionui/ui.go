@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+/*
+Package pinionui provides a browser interface for inspecting a pinion
+database. It lists the record types registered with pinion.Options.Records,
+pages through their indexes showing decoded records, runs the integrity check
+for a record type, and shows a hex dump of the whole database.
+
+The handler does not modify the database. Because it exposes stored data, it
+should be protected with an authorization function and mounted on a path that
+is not publicly reachable, for example:
+
+	http.Handle("/pinion/", http.StripPrefix("/pinion", pinionui.Handler(db, auth)))
+*/
+package pinionui
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/piniondb/pinion"
+)
+
+// PageSize is the number of records shown on each page of an index listing.
+var PageSize = 50
+
+var tmpl = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>pinion{{with .Rec}} - {{.Name}}{{end}}</title>
+<style>body{font-family:sans-serif}td,th{padding:2px 8px;text-align:left}pre{font-size:small}</style>
+</head><body>
+<p><a href="?">Record types</a> | <a href="?view=dump">Hex dump</a></p>
+{{if eq .View "types"}}
+<h1>Record types</h1>
+<table><tr><th>Name</th><th>Indexes</th><th></th></tr>
+{{range $t := .Types}}<tr><td>{{.Name}}</td><td>{{range $j, $name := .Indexes}}<a href="?view=list&type={{$.Enc $t.Name}}&idx={{$j}}">{{$name}}</a> {{end}}</td>
+<td><a href="?view=check&type={{$.Enc .Name}}">check</a></td></tr>
+{{else}}<tr><td colspan="3">No record types are registered with pinion.Options.Records</td></tr>{{end}}
+</table>
+{{else if eq .View "list"}}
+<h1>{{.Rec.Name}} by {{.IndexName}}</h1>
+<table><tr><th>#</th><th>Record</th></tr>
+{{range $j, $str := .List}}<tr><td>{{$.Num $j}}</td><td>{{$str}}</td></tr>{{end}}
+</table>
+<p>{{if gt .Page 0}}<a href="?view=list&type={{.Enc .Rec.Name}}&idx={{.Idx}}">first</a>{{end}}
+{{if .After}}<a href="?view=list&type={{.Enc .Rec.Name}}&idx={{.Idx}}&page={{.Next}}&after={{.After}}">next</a>{{end}}</p>
+{{else if eq .View "check"}}
+<h1>Check {{.Rec.Name}}</h1>
+<p>{{if .Err}}Failed: {{.Err}}{{else}}No problems found{{end}}</p>
+{{else if eq .View "dump"}}
+<h1>Hex dump</h1>
+<pre>{{.Dump}}</pre>
+{{end}}
+{{if .Err}}{{if ne .View "check"}}<p>Error: {{.Err}}</p>{{end}}{{end}}
+</body></html>
+`))
+
+type typeInfo struct {
+	Name    string
+	Indexes []string
+}
+
+// pageType holds the data used to render a page
+type pageType struct {
+	View  string
+	Types []typeInfo
+	Rec   pinion.Record
+	Idx   uint8
+	Page  int
+	After string // Token of the next page, if any
+	List  []string
+	Dump  string
+	Err   error
+}
+
+func (p pageType) Enc(str string) string {
+	return template.URLQueryEscaper(str)
+}
+
+func (p pageType) Num(j int) int {
+	return p.Page*PageSize + j + 1
+}
+
+func (p pageType) Next() int {
+	return p.Page + 1
+}
+
+func (p pageType) IndexName() string {
+	return pinion.IndexName(p.Rec, p.Idx)
+}
+
+// handler serves the browser interface for a database
+type handler struct {
+	db   *pinion.DB
+	auth func(*http.Request) bool
+}
+
+// Handler returns an http.Handler that serves a browser interface for db. If
+// auth is not nil, it is called for each request; requests for which it
+// returns false are refused with status 403 (Forbidden).
+func Handler(db *pinion.DB, auth func(r *http.Request) bool) http.Handler {
+	return handler{db: db, auth: auth}
+}
+
+// record returns the registered record type with the specified name.
+func (h handler) record(name string) pinion.Record {
+	for _, recPtr := range h.db.RecordTypes() {
+		if recPtr.Name() == name {
+			return recPtr
+		}
+	}
+	return nil
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var page pageType
+	var buf bytes.Buffer
+	if h.auth != nil && !h.auth(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	q := r.URL.Query()
+	page.View = q.Get("view")
+	if page.View == "list" || page.View == "check" {
+		page.Rec = h.record(q.Get("type"))
+		if page.Rec == nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	switch page.View {
+	case "list":
+		idx, _ := strconv.Atoi(q.Get("idx"))
+		page.Page, _ = strconv.Atoi(q.Get("page"))
+		if idx < 0 || idx >= int(page.Rec.IndexCount()) || page.Page < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		page.Idx = uint8(idx)
+		// Each page resumes after the last record of the previous one, so
+		// that the records of earlier pages are not read again
+		rec := page.Rec.New()
+		page.After, page.Err = h.db.GetPage(rec, page.Idx, q.Get("after"), func() bool {
+			page.List = append(page.List, fmt.Sprint(rec))
+			return len(page.List) < PageSize
+		})
+	case "check":
+		page.Err = h.db.Check(page.Rec)
+	case "dump":
+		h.db.HexDump(&buf)
+		page.Dump = buf.String()
+	default:
+		page.View = "types"
+		for _, recPtr := range h.db.RecordTypes() {
+			info := typeInfo{Name: recPtr.Name()}
+			for idx := uint8(0); idx < recPtr.IndexCount(); idx++ {
+				info.Indexes = append(info.Indexes, pinion.IndexName(recPtr, idx))
+			}
+			page.Types = append(page.Types, info)
+		}
+	}
+	buf.Reset()
+	err := tmpl.Execute(&buf, page)
+	if err == nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(buf.Bytes())
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,142 @@
+package pinionui_test
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/pinion/pinionui"
+	"github.com/piniondb/store"
+)
+
+type itemType struct {
+	id    uint32
+	label string
+}
+
+func (i itemType) MarshalBinary() ([]byte, error) {
+	var put store.PutBuffer
+	put.Uint32(i.id)
+	put.Str(i.label)
+	return put.Data()
+}
+
+func (i *itemType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint32(&i.id)
+	get.Str(&i.label)
+	return get.Done()
+}
+
+func (i itemType) String() string {
+	return fmt.Sprintf("%d: %s", i.id, i.label)
+}
+
+func (i itemType) Name() string {
+	return "item"
+}
+
+func (i itemType) IndexCount() uint8 {
+	return 2
+}
+
+func (i itemType) New() pinion.Record {
+	return new(itemType)
+}
+
+func (i *itemType) NextID(id uint64) {
+	i.id = uint32(id)
+}
+
+func (i itemType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	if idx == 0 {
+		kb.Uint32(i.id)
+	} else {
+		kb.Str(i.label, 16)
+	}
+	return kb.Data()
+}
+
+func get(t *testing.T, srv *httptest.Server, query string) (status int, body string) {
+	resp, err := http.Get(srv.URL + "/?" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+// Test pages of the browser interface
+func TestHandler(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pinionui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opt := pinion.Options{Records: []pinion.Record{&itemType{}}}
+	db, err := pinion.Create(filepath.Join(dir, "ui.db"), 0600, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var item itemType
+	labels := []string{"wrench", "hammer", "<b>saw</b>"}
+	err = db.Add(&item, func() bool {
+		if len(labels) > 0 {
+			item = itemType{label: labels[0]}
+			labels = labels[1:]
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinionui.PageSize = 2
+	srv := httptest.NewServer(pinionui.Handler(db, func(r *http.Request) bool {
+		return r.URL.Query().Get("view") != "dump"
+	}))
+	defer srv.Close()
+	for _, c := range []struct {
+		query  string
+		status int
+		want   string
+	}{
+		{"", http.StatusOK, `href="?view=list&type=item&idx=1">index 1</a>`},
+		{"view=list&type=item&idx=0", http.StatusOK, "2: hammer</td>"},
+		{"view=list&type=item&idx=1", http.StatusOK, "3: &lt;b&gt;saw&lt;/b&gt;"},
+		{"view=list&type=item&idx=2", http.StatusNotFound, ""},
+		{"view=list&type=tool&idx=0", http.StatusNotFound, ""},
+		{"view=check&type=item", http.StatusOK, "No problems found"},
+		{"view=dump", http.StatusForbidden, ""},
+	} {
+		status, body := get(t, srv, c.query)
+		if status != c.status || !strings.Contains(body, c.want) {
+			t.Fatalf("query %q: status %d, body:\n%s", c.query, status, body)
+		}
+	}
+	// Follow the next link of the first page
+	_, body := get(t, srv, "view=list&type=item&idx=0")
+	pos := strings.Index(body, `">next</a>`)
+	if pos < 0 {
+		t.Fatalf("no next link in body:\n%s", body)
+	}
+	link := html.UnescapeString(body[strings.LastIndex(body[:pos], `href="?`)+7 : pos])
+	_, body = get(t, srv, link)
+	if !strings.Contains(body, "3: &lt;b&gt;saw&lt;/b&gt;") || strings.Contains(body, "wrench") ||
+		strings.Contains(body, `">next</a>`) {
+		t.Fatalf("query %q: body:\n%s", link, body)
+	}
+}
@@ -1,10 +1,12 @@
 package pinion_test
 
 import (
+	"errors"
 	"fmt"
 	"github.com/piniondb/pinion"
 	"github.com/piniondb/store"
 	"github.com/piniondb/str"
+	"strconv"
 )
 
 // quantityType stores an unsigned integer along with its English word
@@ -73,3 +75,23 @@ func (q quantityType) Key(idx uint8) (key []byte, err error) {
 	}
 	return kb.Data()
 }
+
+// ExportText implements the pinion.TextExporter interface.
+func (q quantityType) ExportText() []string {
+	return []string{strconv.FormatUint(uint64(q.id), 10), str.QuantityDecode(q.val)}
+}
+
+// ImportText implements the pinion.TextImporter interface. Only the ID field
+// is read; the English word field is derived from it.
+func (q *quantityType) ImportText(fields []string) (err error) {
+	var id uint64
+	if len(fields) > 0 {
+		id, err = strconv.ParseUint(fields[0], 10, 32)
+		if err == nil {
+			*q = quantityRec(uint32(id))
+		}
+	} else {
+		err = errors.New("missing quantity ID")
+	}
+	return
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrRecLocked is reported when an advisory record lock is held by another
+// holder
+var ErrRecLocked = errors.New("record is locked")
+
+// Name of the bucket, within the meta bucket, that holds advisory record
+// locks. Each key is the record type name, a zero byte and the primary key;
+// each value is the expiry time followed by the name of the holder.
+const recLockBucketName = "reclock"
+
+// recLockKey returns the key of the lock on the record pointed to by recPtr.
+func recLockKey(recPtr Record) (key []byte, err error) {
+	var primaryKey []byte
+	primaryKey, err = recPtr.Key(0)
+	if err == nil {
+		key = concat([]byte(recPtr.Name()), []byte{0}, primaryKey)
+	}
+	return
+}
+
+// recLockGet returns the holder and expiry of an unexpired lock stored in bck
+// under key. holder is empty if there is no such lock.
+func recLockGet(bck *bbolt.Bucket, key []byte, now time.Time) (holder string, expires time.Time) {
+	if bck != nil {
+		if val := bck.Get(key); len(val) >= 8 {
+			expires = time.Unix(0, int64(binary.BigEndian.Uint64(val)))
+			if expires.After(now) {
+				holder = string(val[8:])
+			} else {
+				expires = time.Time{}
+			}
+		}
+	}
+	return
+}
+
+// recLockUpdate runs fn with the lock bucket and the key of the lock on the
+// record pointed to by recPtr.
+func (db *DB) recLockUpdate(recPtr Record, fn func(bck *bbolt.Bucket, key []byte, now time.Time) error) error {
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		var meta, bck *bbolt.Bucket
+		var key []byte
+		key, err = recLockKey(recPtr)
+		if err == nil {
+			meta, err = bucket(tx, metaBucketName, true)
+		}
+		if err == nil {
+			bck, err = meta.CreateBucketIfNotExists([]byte(recLockBucketName))
+		}
+		if err == nil {
+			err = fn(bck, key, db.now())
+		}
+		return
+	})
+}
+
+// LockRec acquires an advisory lock on the record identified by the primary
+// key of the record pointed to by recPtr on behalf of holder, which names the
+// user or session that intends to edit the record. The lock expires after
+// ttl unless it is renewed by calling LockRec again with the same holder. If
+// the lock is held by a different holder and has not expired, an error
+// wrapping ErrRecLocked is returned. Only the field or fields that make up the
+// primary key need to be assigned, and the record need not be stored.
+//
+// Locks are advisory: they do not prevent any method of db from reading or
+// writing the record. They let cooperating editors avoid conflicting changes
+// to a record that a user is working on, and are stored in the database so
+// that they are shared by all of the processes that use it in turn.
+func (db *DB) LockRec(recPtr Record, holder string, ttl time.Duration) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.LockRec(recPtr, holder, ttl)
+	}
+	return db.recLockUpdate(recPtr, func(bck *bbolt.Bucket, key []byte, now time.Time) (err error) {
+		current, expires := recLockGet(bck, key, now)
+		if current == "" || current == holder {
+			var val [8]byte
+			binary.BigEndian.PutUint64(val[:], uint64(now.Add(ttl).UnixNano()))
+			err = bck.Put(key, concat(val[:], []byte(holder)))
+		} else {
+			err = fmt.Errorf("%s record held by %s until %s: %w",
+				recPtr.Name(), current, expires.UTC().Format(time.RFC3339), ErrRecLocked)
+		}
+		return
+	})
+}
+
+// UnlockRec releases the advisory lock held by holder on the record
+// identified by the primary key of the record pointed to by recPtr. It is not
+// an error if the record is not locked or its lock has expired. If the lock is
+// held by a different holder, an error wrapping ErrRecLocked is returned.
+func (db *DB) UnlockRec(recPtr Record, holder string) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.UnlockRec(recPtr, holder)
+	}
+	return db.recLockUpdate(recPtr, func(bck *bbolt.Bucket, key []byte, now time.Time) (err error) {
+		current, _ := recLockGet(bck, key, now)
+		if current == "" || current == holder {
+			err = bck.Delete(key)
+		} else {
+			err = fmt.Errorf("%s record held by %s: %w", recPtr.Name(), current, ErrRecLocked)
+		}
+		return
+	})
+}
+
+// RecLock reports the holder and expiry time of the advisory lock on the
+// record identified by the primary key of the record pointed to by recPtr.
+// holder is empty if the record is not locked.
+func (db *DB) RecLock(recPtr Record) (holder string, expires time.Time, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.RecLock(recPtr)
+	}
+	var key []byte
+	key, err = recLockKey(recPtr)
+	if err == nil {
+		err = db.view(func(tx *bbolt.Tx) error {
+			var bck *bbolt.Bucket
+			if meta := tx.Bucket([]byte(metaBucketName)); meta != nil {
+				bck = meta.Bucket([]byte(recLockBucketName))
+			}
+			holder, expires = recLockGet(bck, key, db.now())
+			return nil
+		})
+	}
+	return
+}
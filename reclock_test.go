@@ -0,0 +1,53 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates advisory record locks taken by two editors.
+func ExampleDB_LockRec() {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	db, err := pinion.Create("example/reclock.db", 0600, pinion.Options{
+		Clock: func() time.Time { return now },
+	})
+	if err == nil {
+		q := quantityType{id: 42}
+		err = db.LockRec(&q, "alice", time.Minute)
+		if err == nil {
+			err = db.LockRec(&q, "bob", time.Minute)
+			fmt.Println(errors.Is(err, pinion.ErrRecLocked), err)
+			var holder string
+			var expires time.Time
+			holder, expires, err = db.RecLock(&q)
+			fmt.Println(holder, expires.UTC().Format(time.Kitchen))
+		}
+		if err == nil {
+			// Alice's lock lapses without being renewed
+			now = now.Add(2 * time.Minute)
+			err = db.LockRec(&q, "bob", time.Minute)
+		}
+		if err == nil {
+			err = db.UnlockRec(&q, "alice")
+			fmt.Println(err)
+			err = db.UnlockRec(&q, "bob")
+		}
+		if err == nil {
+			var holder string
+			holder, _, err = db.RecLock(&q)
+			fmt.Printf("%q\n", holder)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// true quantity record held by alice until 2024-05-01T09:01:00Z: record is locked
+	// alice 9:01AM
+	// quantity record held by bob: record is locked
+	// ""
+}
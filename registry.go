@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"errors"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrSchemaMismatch is reported when a record type does not match the entry
+// recorded for its name in the type registry
+var ErrSchemaMismatch = errors.New("record type does not match stored layout")
+
+// Name of the bucket, within the meta bucket, that serves as the type
+// registry. It maps the name of each record type that has been stored to its
+// index count and format fingerprint, encoded with TagPutBuffer.
+const registryBucketName = "types"
+
+// Tags of the fields of a registry entry
+const (
+	regTagIndexCount = iota + 1
+	regTagFingerprint
+)
+
+// The Fingerprinter interface may be implemented by a record type to identify
+// the format of its stored values. Fingerprint typically returns a version
+// string or a hash of the type's field layout, and changes whenever the
+// format changes in a way that earlier records can no longer be read. The
+// fingerprint is kept in the type registry along with the type's index count;
+// see RegisterType.
+type Fingerprinter interface {
+	Fingerprint() string
+}
+
+// fingerprint returns the format fingerprint of recPtr's type, or an empty
+// string if it does not implement Fingerprinter.
+func fingerprint(recPtr Record) (str string) {
+	if f, ok := recPtr.(Fingerprinter); ok {
+		str = f.Fingerprint()
+	}
+	return
+}
+
+// registryGet returns the registry entry of the type named nameStr. ok is
+// false if there is no entry.
+func registryGet(tx *bbolt.Tx, nameStr string) (count uint8, print string, ok bool, err error) {
+	var data []byte
+	if meta := tx.Bucket([]byte(metaBucketName)); meta != nil {
+		if reg := meta.Bucket([]byte(registryBucketName)); reg != nil {
+			data = reg.Get([]byte(nameStr))
+		}
+	}
+	if data != nil {
+		var val uint64
+		get := NewTagGetBuffer(data)
+		get.Uint64(regTagIndexCount, &val)
+		get.Str(regTagFingerprint, &print)
+		count, ok, err = uint8(val), true, get.Done()
+	}
+	return
+}
+
+// registryPut records the index count and fingerprint of the type named
+// nameStr, replacing any earlier entry.
+func registryPut(tx *bbolt.Tx, nameStr string, count uint8, print string) (err error) {
+	var meta, reg *bbolt.Bucket
+	var data []byte
+	var put TagPutBuffer
+	put.Uint64(regTagIndexCount, uint64(count))
+	put.Str(regTagFingerprint, print)
+	data, err = put.Data()
+	if err == nil {
+		meta, err = bucket(tx, metaBucketName, true)
+	}
+	if err == nil {
+		reg, err = meta.CreateBucketIfNotExists([]byte(registryBucketName))
+	}
+	if err == nil {
+		err = reg.Put([]byte(nameStr), data)
+	}
+	return
+}
+
+// registryCheck validates recPtr's type, which has count indexes, against its
+// registry entry. The type must have at least as many indexes as recorded,
+// and the same fingerprint. If write is true, an absent entry is written and
+// an entry is updated when indexes have been added to the type.
+func registryCheck(tx *bbolt.Tx, recPtr Record, count uint8, write bool) (err error) {
+	var regCount uint8
+	var regPrint string
+	var ok bool
+	nameStr := recPtr.Name()
+	print := fingerprint(recPtr)
+	regCount, regPrint, ok, err = registryGet(tx, nameStr)
+	if err == nil && ok {
+		if print != regPrint {
+			err = fmt.Errorf("%w: %s has fingerprint %q, stored records have %q",
+				ErrSchemaMismatch, nameStr, print, regPrint)
+		} else if count < regCount {
+			err = fmt.Errorf("%w: %s declares %d indexes, %d are stored (see DropIndex)",
+				ErrSchemaMismatch, nameStr, count, regCount)
+		}
+	}
+	if err == nil && write && (!ok || count > regCount) {
+		err = registryPut(tx, nameStr, count, print)
+	}
+	return
+}
+
+// registryDrop lowers the index count recorded for the type named nameStr,
+// whose record type declares count indexes, once the subbuckets of the
+// indexes beyond them have been removed from its bucket bck.
+func registryDrop(tx *bbolt.Tx, bck *bbolt.Bucket, nameStr string, count uint8) (err error) {
+	var regCount uint8
+	var regPrint string
+	var ok bool
+	regCount, regPrint, ok, err = registryGet(tx, nameStr)
+	if err == nil && ok && regCount > count {
+		newCount := count
+		for j := count; j < regCount; j++ {
+			if bck.Bucket([]byte{j}) != nil {
+				newCount = j + 1
+			}
+		}
+		if newCount < regCount {
+			err = registryPut(tx, nameStr, newCount, regPrint)
+		}
+	}
+	return
+}
+
+// RegisterType records the index count and fingerprint (see Fingerprinter)
+// of recPtr's type in the type registry, replacing the entry made when
+// records of the type were first stored. Thereafter, every operation on
+// records of the type verifies that the record type has the same fingerprint
+// and at least as many indexes as recorded, and fails with ErrSchemaMismatch
+// otherwise. This exposes a compiled record type that does not match the
+// stored records before it can misread or damage them. An entry is made
+// automatically when records of a type are first written, and its index count
+// is raised when indexes are added; RegisterType is needed only to accept a
+// deliberate change of fingerprint, typically once the stored records have
+// been converted. Only the type of recPtr is used.
+func (db *DB) RegisterType(recPtr Record) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.RegisterType(recPtr)
+	}
+	return db.update(func(tx *bbolt.Tx) error {
+		return registryPut(tx, recPtr.Name(), recPtr.IndexCount(), fingerprint(recPtr))
+	})
+}
@@ -0,0 +1,57 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// printQuantityType is a quantity record that declares the format of its
+// stored values.
+type printQuantityType struct {
+	quantityType
+	print string
+}
+
+func (p printQuantityType) New() pinion.Record {
+	return &printQuantityType{print: p.print}
+}
+
+// Fingerprint implements the pinion.Fingerprinter interface
+func (p printQuantityType) Fingerprint() string {
+	return p.print
+}
+
+// This example demonstrates the detection of a record type whose format does
+// not match that of the stored records.
+func ExampleFingerprinter() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/registry.db", 0600, pinion.Options{})
+	if err == nil {
+		p := printQuantityType{quantityRec(1), "v1"}
+		err = db.PutRec(&p)
+		if err == nil {
+			// A later build of the application changes the format
+			p = printQuantityType{quantityRec(1), "v2"}
+			err = db.GetRec(&p, 0)
+			fmt.Println(errors.Is(err, pinion.ErrSchemaMismatch))
+			fmt.Println(err)
+			// Once the records have been converted, the new format is accepted
+			err = db.RegisterType(&p)
+		}
+		if err == nil {
+			err = db.GetRec(&p, 0)
+			fmt.Println(p.String(), err)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// true
+	// record type does not match stored layout: quantity has fingerprint "v2", stored records have "v1"
+	// [          1 : one] <nil>
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// bucketCopy copies the keys, nested buckets and sequence of src to dst.
+func bucketCopy(dst, src *bbolt.Bucket) (err error) {
+	err = dst.SetSequence(src.Sequence())
+	if err == nil {
+		err = src.ForEach(func(k, v []byte) (err error) {
+			if v != nil {
+				err = dst.Put(k, v)
+			} else {
+				var sub *bbolt.Bucket
+				sub, err = dst.CreateBucket(k)
+				if err == nil {
+					err = bucketCopy(sub, src.Bucket(k))
+				}
+			}
+			return
+		})
+	}
+	return
+}
+
+// bucketMove moves the bucket named oldName within parent to newName.
+// Nothing is done if the bucket does not exist.
+func bucketMove(parent *bbolt.Bucket, oldName, newName []byte) (err error) {
+	if src := parent.Bucket(oldName); src != nil {
+		var dst *bbolt.Bucket
+		dst, err = parent.CreateBucket(newName)
+		if err == nil {
+			err = bucketCopy(dst, src)
+		}
+		if err == nil {
+			err = parent.DeleteBucket(oldName)
+		}
+	}
+	return
+}
+
+// RenameType moves the records of the type named oldName, along with their
+// indexes, sequence and the information pinion keeps about the type, to the
+// name newName. It is called when the Name method of a record type is changed
+// so that the stored records remain accessible; otherwise they would be
+// ignored under the new name. ErrTypeExists is returned if records are
+// already stored under newName. The records are copied within a single
+// transaction, which for a large type may take a while and hold a
+// correspondingly large amount of memory.
+func (db *DB) RenameType(oldName, newName string) error {
+	if odb := db.ownerName(oldName); odb != db {
+		return odb.RenameType(oldName, newName)
+	}
+	if oldName == metaBucketName || newName == metaBucketName {
+		return fmt.Errorf("cannot rename \"%s\" to \"%s\"", oldName, newName)
+	}
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		var src, dst *bbolt.Bucket
+		oldKey, newKey := []byte(oldName), []byte(newName)
+		src, err = bucket(tx, oldName, false)
+		if err == nil && tx.Bucket(newKey) != nil {
+			err = fmt.Errorf("%w: %s", ErrTypeExists, newName)
+		}
+		if err == nil {
+			dst, err = tx.CreateBucket(newKey)
+		}
+		if err == nil {
+			err = bucketCopy(dst, src)
+		}
+		if err == nil {
+			err = tx.DeleteBucket(oldKey)
+		}
+		meta := tx.Bucket([]byte(metaBucketName))
+		if err != nil || meta == nil {
+			return
+		}
+		for _, str := range typeMetaBuckets {
+			if bck := meta.Bucket([]byte(str)); bck != nil && err == nil {
+				if bck.Bucket(newKey) != nil {
+					err = bck.DeleteBucket(newKey)
+				}
+				if err == nil {
+					err = bucketMove(bck, oldKey, newKey)
+				}
+			}
+		}
+		oldPrefix, newPrefix := concat(oldKey, []byte{0}), concat(newKey, []byte{0})
+		for _, str := range typeMetaKeyed {
+			if bck := meta.Bucket([]byte(str)); bck != nil && err == nil {
+				var keys, vals [][]byte
+				c := bck.Cursor()
+				for k, v := c.Seek(oldPrefix); bytes.HasPrefix(k, oldPrefix); k, v = c.Next() {
+					keys = append(keys, concat(k))
+					vals = append(vals, concat(v))
+				}
+				for j := 0; j < len(keys) && err == nil; j++ {
+					err = bck.Delete(keys[j])
+					if err == nil {
+						err = bck.Put(concat(newPrefix, keys[j][len(oldPrefix):]), vals[j])
+					}
+				}
+			}
+		}
+		if reg := meta.Bucket([]byte(registryBucketName)); reg != nil && err == nil {
+			if data := reg.Get(oldKey); data != nil {
+				data = concat(data)
+				err = reg.Delete(oldKey)
+				if err == nil {
+					err = reg.Put(newKey, data)
+				}
+			}
+		}
+		if f := db.blooms[newName]; f != nil && err == nil {
+			// The filter of the new name has seen none of the moved keys
+			f.mu.Lock()
+			f.fill(dst.Bucket([]byte{0}))
+			f.mu.Unlock()
+		}
+		return
+	})
+}
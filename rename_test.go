@@ -0,0 +1,93 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/piniondb/pinion"
+)
+
+// amountQuantityType is quantityType after its Name method has been changed.
+type amountQuantityType struct {
+	quantityType
+}
+
+func (a amountQuantityType) Name() string {
+	return "amount"
+}
+
+func (a amountQuantityType) New() pinion.Record {
+	return new(amountQuantityType)
+}
+
+// This example renames a record type without losing its stored records.
+func ExampleDB_RenameType() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/rename.db", 0600, pinion.Options{})
+	if err == nil {
+		for _, id := range []uint32{3, 1, 2} {
+			if err == nil {
+				q := quantityRec(id)
+				err = db.PutRec(&q)
+			}
+		}
+		if err == nil {
+			err = db.RenameType("quantity", "amount")
+		}
+		if err == nil {
+			var list []uint32
+			var a amountQuantityType
+			err = db.Get(&a, idxQuantityVal, func() bool {
+				list = append(list, a.id)
+				return true
+			})
+			fmt.Println("amount", list)
+		}
+		if err == nil {
+			q := quantityRec(4)
+			err = db.PutRec(&q)
+		}
+		if err == nil {
+			err = db.RenameType("quantity", "amount")
+			fmt.Println(errors.Is(err, pinion.ErrTypeExists))
+			err = db.Check(&amountQuantityType{})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// amount [1 3 2]
+	// true
+}
+
+// Test that the Bloom filter of the new name of a type includes the moved
+// records
+func TestDB_RenameTypeBloom(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var ok bool
+	opt := pinion.Options{BloomFilters: []pinion.Record{&amountQuantityType{}}}
+	db, err = pinion.Create("example/renamebloom.db", 0600, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	q := quantityRec(5)
+	err = db.PutRec(&q)
+	if err == nil {
+		err = db.RenameType("quantity", "amount")
+	}
+	if err == nil {
+		ok, err = db.Exists(&amountQuantityType{quantityRec(5)}, 0)
+		if err == nil && !ok {
+			t.Fatalf("renamed record not found")
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// The Compacter interface may be implemented by a record type whose stored
+// values can be made smaller, for example by clearing fields that are no
+// longer used or by replacing values with a more compact layout. Compact is
+// called by RewriteAll on each stored record after it has been decoded and
+// its defaults applied. It must not change the record's primary key.
+type Compacter interface {
+	Compact()
+}
+
+// RewriteAll is a maintenance pass that reads and stores again every record
+// of the type pointed to by recPtr. Each record is decoded, including the
+// application of its defaults (see Defaulter), and is passed to its Compact
+// method if it implements Compacter. It is then encoded with MarshalBinary
+// and, if the result differs from the stored data, written back along with
+// any changed index entries. This makes defaults permanent, strips obsolete
+// fields and re-encodes records that were stored with an earlier layout. The
+// records are processed in primary key order in transactions of at most
+// Options.BatchSize records, so other writers are not blocked for the
+// duration of the pass. The number of records that were rewritten is
+// returned.
+//
+// Records of a type that implements Immutable are rewritten as well, since
+// the record read back is the one that was stored; only its encoding
+// changes. Compact is not called for such records because it would change
+// their content.
+func (db *DB) RewriteAll(recPtr Record) (n int, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.RewriteAll(recPtr)
+	}
+	var after []byte
+	loop := true
+	batchSize := db.batchSize()
+	compacter, _ := recPtr.(Compacter)
+	if immutable(recPtr) {
+		compacter = nil
+	}
+	for loop && err == nil {
+		err = db.update(func(tx *bbolt.Tx) (err error) {
+			var keys, list [][]byte
+			put := idxPutType{recPtr: recPtr, scratch: recPtr.New(), count: recPtr.IndexCount(), rewrite: true}
+			put.bck, err = bucketGet(recPtr, put.count, false, tx)
+			if _, ok := recPtr.(BinaryMigrator); ok && err == nil && put.bck.format == nil {
+				// No record has been stored in the current format yet; the
+				// rewritten records must have their version recorded
+				put.bck.format, err = formatBucket(tx, recPtr.Name(), true)
+			}
+			if err == nil {
+				put.bck.derive = db.deriver(tx, recPtr)
+				put.bck.bloom = db.blooms[recPtr.Name()]
+				put.bck.sketch = db.sketched(recPtr)
+				put.bck.oversize = db.oversize(recPtr)
+				// Collect the batch before writing so that the cursor is not
+				// disturbed by changes to the bucket it traverses
+				c := put.bck.idxs[0].Cursor()
+				k, v := c.First()
+				if after != nil {
+					k, v = c.Seek(after)
+					if k != nil && bytes.Equal(k, after) {
+						k, v = c.Next()
+					}
+				}
+				for ; k != nil && len(keys) < batchSize; k, v = c.Next() {
+					keys = append(keys, append([]byte(nil), k...))
+					list = append(list, append([]byte(nil), v...))
+				}
+				loop = len(keys) == batchSize
+			}
+			for j := 0; j < len(keys) && err == nil; j++ {
+				var data, primaryKey []byte
+				data, err = put.bck.migrate(recPtr, keys[j], list[j])
+				if err == nil {
+					err = decode(recPtr, data)
+				}
+				if err == nil {
+					if compacter != nil {
+						compacter.Compact()
+					}
+					data, err = recPtr.MarshalBinary()
+				}
+				if err == nil && !bytes.Equal(data, list[j]) {
+					primaryKey, err = recPtr.Key(0)
+					if err == nil {
+						if bytes.Equal(primaryKey, keys[j]) {
+							err = put.idxPut()
+							if err == nil {
+								n++
+							}
+						} else {
+							err = fmt.Errorf("primary key of %s record changed during rewrite", recPtr.Name())
+						}
+					}
+				}
+			}
+			if err == nil && len(keys) > 0 {
+				after = keys[len(keys)-1]
+			}
+			return
+		})
+	}
+	return
+}
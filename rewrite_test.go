@@ -0,0 +1,138 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// contactRecV3 is a later version of the contact record that no longer stores
+// the placeholder phone number supplied by contactRecV2.
+type contactRecV3 struct {
+	contactV2
+}
+
+func (c contactRecV3) Name() string {
+	return "contact"
+}
+
+func (c contactRecV3) IndexCount() uint8 {
+	return 1
+}
+
+func (c contactRecV3) New() pinion.Record {
+	return new(contactRecV3)
+}
+
+func (c *contactRecV3) NextID(id uint64) {
+	c.id = uint32(id)
+}
+
+func (c contactRecV3) Key(idx uint8) ([]byte, error) {
+	return store.KeyUint32(c.id), nil
+}
+
+// Compact implements the pinion.Compacter interface
+func (c *contactRecV3) Compact() {
+	if c.phone == "unlisted" {
+		c.phone = ""
+	}
+}
+
+// This example demonstrates maintenance passes that first make defaults
+// permanent and then remove them again from stored records.
+func ExampleDB_RewriteAll() {
+	var db *pinion.DB
+	var err error
+	var n int
+	db, err = pinion.Create("example/rewrite.db", 0600, pinion.Options{BatchSize: 2})
+	if err == nil {
+		for _, name := range []string{"Robert", "Carol", "Ted"} {
+			if err == nil {
+				err = db.AddRec(&contactRecV1{contactV1{name: name}})
+			}
+		}
+		if err == nil {
+			err = db.PutRec(&contactRecV2{contactV2{id: 2, name: "Carol", phone: "555-0100"}})
+		}
+		if err == nil {
+			n, err = db.RewriteAll(&contactRecV2{})
+			fmt.Println("defaults stored:", n)
+		}
+		if err == nil {
+			n, err = db.RewriteAll(&contactRecV3{})
+			fmt.Println("compacted:", n)
+		}
+		if err == nil {
+			var c contactRecV3
+			err = db.Get(&c, 0, func() bool {
+				fmt.Printf("%s [%s]\n", c.name, c.phone)
+				return true
+			})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// defaults stored: 2
+	// compacted: 2
+	// Robert []
+	// Carol [555-0100]
+	// Ted []
+}
+
+// eventReadingType is a reading that is never changed once stored.
+type eventReadingType struct {
+	readingType
+}
+
+func (e eventReadingType) New() pinion.Record {
+	return new(eventReadingType)
+}
+
+// Immutable implements the pinion.Immutable interface
+func (e eventReadingType) Immutable() bool {
+	return true
+}
+
+// Test that RewriteAll re-encodes records of an immutable type
+func TestDB_RewriteAllImmutable(t *testing.T) {
+	db, err := pinion.Create("example/rewrite_immutable.db", 0600, pinion.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for id, deg := range []uint16{18, 21} {
+		err = db.PutRec(&readingOldType{id: uint32(id), degrees: deg})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := db.RewriteAll(&eventReadingType{})
+	if err != nil || n != 2 {
+		t.Fatalf("rewrite: %d, %v", n, err)
+	}
+	n, err = db.RewriteAll(&eventReadingType{})
+	if err != nil || n != 0 {
+		t.Fatalf("second rewrite: %d, %v", n, err)
+	}
+	e := eventReadingType{readingType{id: 1, tenths: 220}}
+	err = db.PutRec(&e)
+	if !errors.Is(err, pinion.ErrImmutable) {
+		t.Fatalf("put: %v", err)
+	}
+	var list []uint32
+	e = eventReadingType{}
+	err = db.Get(&e, 0, func() bool {
+		list = append(list, e.tenths)
+		return true
+	})
+	if err != nil || fmt.Sprint(list) != "[180 210]" {
+		t.Fatalf("readings %v: %v", list, err)
+	}
+}
@@ -0,0 +1,492 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrDamaged is wrapped by the errors that describe parts of a database file
+// that cannot be read.
+var ErrDamaged = errors.New("database file is damaged")
+
+// SalvageGap identifies a range of primary keys within which records were
+// lost. After is the primary key of the last record recovered before the
+// damage and Before is that of the first record recovered after it. Either is
+// nil if no record was recovered on that side.
+type SalvageGap struct {
+	After, Before []byte
+}
+
+// SalvageType reports what Salvage recovered for one record type.
+type SalvageType struct {
+	// Name is the name of the record type.
+	Name string
+	// Recovered is the number of records copied to the new database.
+	Recovered int
+	// Undecodable is the number of records of a type registered with
+	// Options.Records that could be read but not unmarshalled. These records
+	// are not copied.
+	Undecodable int
+	// Lost lists the ranges of primary keys in which records could not be
+	// read, in key order.
+	Lost []SalvageGap
+	// Err, if not nil, wraps ErrDamaged and describes the first damage found
+	// in the records of the type.
+	Err error
+}
+
+// Layout of a bbolt file. Salvage reads the file directly rather than with
+// bbolt, which trusts the page structure and can crash or loop indefinitely
+// when it is damaged. Values are stored in the byte order of the machine that
+// wrote the file; like bbolt itself, Salvage assumes it is little-endian.
+const (
+	cnBoltMagic        = 0xED0CDAED
+	cnBoltVersion      = 2
+	cnBoltPageHdrSize  = 16
+	cnBoltElementSize  = 16
+	cnBoltBranchPage   = 0x01
+	cnBoltLeafPage     = 0x02
+	cnBoltBucketLeaf   = 0x01
+	cnBoltBucketHdr    = 16
+	cnBoltMetaSumSize  = 56
+	cnBoltMaxDepth     = 64
+	cnSalvageBatchSize = 4096
+)
+
+// salvageReader reads the pages of a bbolt file without relying on their
+// integrity.
+type salvageReader struct {
+	fl       *os.File
+	size     int64
+	pageSize int64
+	root     []byte          // root bucket header
+	seen     map[uint64]bool // pages already read, to guard against cycles
+}
+
+// meta returns the root bucket header and transaction ID recorded in the
+// meta page that begins at pos, assuming the specified page size.
+func (sr *salvageReader) meta(pos, pageSize int64) (root []byte, txid uint64, err error) {
+	buf := make([]byte, cnBoltPageHdrSize+cnBoltMetaSumSize+8)
+	_, err = sr.fl.ReadAt(buf, pos)
+	if err == nil {
+		m := buf[cnBoltPageHdrSize:]
+		h := fnv.New64a()
+		h.Write(m[:cnBoltMetaSumSize])
+		switch {
+		case binary.LittleEndian.Uint32(m) != cnBoltMagic,
+			binary.LittleEndian.Uint32(m[4:]) != cnBoltVersion,
+			int64(binary.LittleEndian.Uint32(m[8:])) != pageSize,
+			binary.LittleEndian.Uint64(m[cnBoltMetaSumSize:]) != h.Sum64():
+			err = fmt.Errorf("%w: invalid meta page at offset %d", ErrDamaged, pos)
+		default:
+			root = m[16 : 16+cnBoltBucketHdr]
+			txid = binary.LittleEndian.Uint64(m[48:])
+		}
+	}
+	return
+}
+
+// open prepares sr to read the bbolt file at path using the more recent of
+// its two valid meta pages.
+func (sr *salvageReader) open(path string) (err error) {
+	var info os.FileInfo
+	sr.fl, err = os.Open(path)
+	if err == nil {
+		info, err = sr.fl.Stat()
+		if err == nil {
+			sr.size = info.Size()
+			sr.seen = make(map[uint64]bool)
+			// The page size is recorded in the first meta page. If that page
+			// is damaged, the size is assumed to be the usual one.
+			sr.pageSize = 4096
+			buf := make([]byte, cnBoltPageHdrSize+12)
+			if _, rdErr := sr.fl.ReadAt(buf, 0); rdErr == nil {
+				if size := int64(binary.LittleEndian.Uint32(buf[cnBoltPageHdrSize+8:])); size >= 512 && size&(size-1) == 0 {
+					sr.pageSize = size
+				}
+			}
+			var best uint64
+			for j := int64(0); j < 2; j++ {
+				root, txid, metaErr := sr.meta(j*sr.pageSize, sr.pageSize)
+				if metaErr == nil && (sr.root == nil || txid > best) {
+					sr.root, best = root, txid
+				} else if err == nil {
+					err = metaErr
+				}
+			}
+			if sr.root != nil {
+				err = nil
+			}
+		}
+		if err != nil {
+			sr.fl.Close()
+		}
+	}
+	return
+}
+
+// page reads page id along with any overflow pages that follow it.
+func (sr *salvageReader) page(id uint64) (pg []byte, err error) {
+	pos := int64(id) * sr.pageSize
+	switch {
+	case id < 2 || pos < 0 || pos+sr.pageSize > sr.size:
+		err = fmt.Errorf("%w: page %d is out of range", ErrDamaged, id)
+	case sr.seen[id]:
+		err = fmt.Errorf("%w: page %d is referenced more than once", ErrDamaged, id)
+	default:
+		sr.seen[id] = true
+		pg = make([]byte, sr.pageSize)
+		_, err = sr.fl.ReadAt(pg, pos)
+		if err == nil {
+			overflow := int64(binary.LittleEndian.Uint32(pg[12:]))
+			switch {
+			case binary.LittleEndian.Uint64(pg) != id:
+				err = fmt.Errorf("%w: page %d has an invalid header", ErrDamaged, id)
+			case pos+(overflow+1)*sr.pageSize > sr.size:
+				err = fmt.Errorf("%w: page %d overflows the file", ErrDamaged, id)
+			case overflow > 0:
+				pg = append(pg, make([]byte, overflow*sr.pageSize)...)
+				_, err = sr.fl.ReadAt(pg[sr.pageSize:], pos+sr.pageSize)
+			}
+		}
+	}
+	return
+}
+
+// salvageVisitor receives the contents of a bucket as it is read. leaf is
+// called with each key and value in key order, and damaged is called where
+// part of the bucket cannot be read.
+type salvageVisitor struct {
+	leaf    func(flags uint32, key, val []byte)
+	damaged func(err error)
+}
+
+// elements visits the elements of a page, descending into the children of a
+// branch page.
+func (sr *salvageReader) elements(pg []byte, depth int, vis salvageVisitor) {
+	flags := binary.LittleEndian.Uint16(pg[8:])
+	count := int(binary.LittleEndian.Uint16(pg[10:]))
+	field := func(elem, off int) uint32 {
+		return binary.LittleEndian.Uint32(pg[elem+off:])
+	}
+	if flags != cnBoltBranchPage && flags != cnBoltLeafPage {
+		vis.damaged(fmt.Errorf("%w: page %d has invalid type %#x",
+			ErrDamaged, binary.LittleEndian.Uint64(pg), flags))
+		return
+	}
+	for j := 0; j < count; j++ {
+		elem := cnBoltPageHdrSize + j*cnBoltElementSize
+		if elem+cnBoltElementSize > len(pg) {
+			vis.damaged(fmt.Errorf("%w: page %d has invalid element count",
+				ErrDamaged, binary.LittleEndian.Uint64(pg)))
+			return
+		}
+		if flags == cnBoltBranchPage {
+			sr.walk(binary.LittleEndian.Uint64(pg[elem+8:]), depth+1, vis)
+		} else {
+			pos := elem + int(field(elem, 4))
+			ksize, vsize := int(field(elem, 8)), int(field(elem, 12))
+			if pos < elem || ksize < 0 || vsize < 0 || pos+ksize+vsize > len(pg) {
+				vis.damaged(fmt.Errorf("%w: page %d has an invalid element",
+					ErrDamaged, binary.LittleEndian.Uint64(pg)))
+			} else {
+				vis.leaf(field(elem, 0), pg[pos:pos+ksize], pg[pos+ksize:pos+ksize+vsize])
+			}
+		}
+	}
+}
+
+// walk visits the elements of the tree rooted at page id.
+func (sr *salvageReader) walk(id uint64, depth int, vis salvageVisitor) {
+	if depth > cnBoltMaxDepth {
+		vis.damaged(fmt.Errorf("%w: page %d is nested too deeply", ErrDamaged, id))
+		return
+	}
+	pg, err := sr.page(id)
+	if err == nil {
+		sr.elements(pg, depth, vis)
+	} else {
+		vis.damaged(err)
+	}
+}
+
+// bucket visits the elements of the bucket whose header is hdr. A bucket
+// with a root of zero is stored inline following its header.
+func (sr *salvageReader) bucket(hdr []byte, vis salvageVisitor) {
+	if len(hdr) < cnBoltBucketHdr {
+		vis.damaged(fmt.Errorf("%w: invalid bucket header", ErrDamaged))
+	} else if root := binary.LittleEndian.Uint64(hdr); root != 0 {
+		sr.walk(root, 0, vis)
+	} else if len(hdr) >= cnBoltBucketHdr+cnBoltPageHdrSize {
+		sr.elements(hdr[cnBoltBucketHdr:], 0, vis)
+	}
+}
+
+// child returns a copy of the header of the bucket stored under key in the
+// bucket whose header is hdr, or nil if it cannot be found.
+func (sr *salvageReader) child(hdr, key []byte) (sub []byte, err error) {
+	sr.bucket(hdr, salvageVisitor{
+		leaf: func(flags uint32, k, v []byte) {
+			if flags&cnBoltBucketLeaf != 0 && bytes.Equal(k, key) {
+				sub = concat(v)
+			}
+		},
+		damaged: func(dmgErr error) {
+			if err == nil {
+				err = dmgErr
+			}
+		},
+	})
+	return
+}
+
+// salvageVersions returns the format versions recorded for the records of
+// each type (see BinaryMigrator) in the meta bucket whose header is meta,
+// keyed by type name and then by primary key. An error wrapping ErrDamaged is
+// returned along with the versions that could be read if some of them were
+// lost.
+func (sr *salvageReader) salvageVersions(meta []byte) (versions map[string]map[string][]byte, err error) {
+	var fmts []byte
+	var names []string
+	var hdrs [][]byte
+	damaged := func(dmgErr error) {
+		if err == nil {
+			err = dmgErr
+		}
+	}
+	versions = make(map[string]map[string][]byte)
+	fmts, err = sr.child(meta, []byte(formatBucketName))
+	if fmts != nil {
+		sr.bucket(fmts, salvageVisitor{
+			leaf: func(flags uint32, k, v []byte) {
+				if flags&cnBoltBucketLeaf != 0 {
+					names = append(names, string(k))
+					hdrs = append(hdrs, concat(v))
+				}
+			},
+			damaged: damaged,
+		})
+	}
+	for j, name := range names {
+		list := make(map[string][]byte)
+		sr.bucket(hdrs[j], salvageVisitor{
+			leaf: func(flags uint32, k, v []byte) {
+				if flags&cnBoltBucketLeaf == 0 && len(v) == 2 {
+					list[string(k)] = concat(v)
+				}
+			},
+			damaged: damaged,
+		})
+		versions[name] = list
+	}
+	return
+}
+
+// salvageType copies the readable primary records of the type whose bucket
+// header is hdr into db, along with their format versions, which are listed
+// in versions. If recPtr is not nil, records that it cannot migrate and
+// unmarshal are left out and the secondary indexes of the type are built once
+// the records have been copied.
+func (db *DB) salvageType(sr *salvageReader, name string, hdr []byte, recPtr Record,
+	versions map[string][]byte) (st SalvageType, err error) {
+	type kvType struct{ key, val []byte }
+	var primary []byte
+	var list []kvType
+	var last []byte
+	var gap bool
+	st.Name = name
+	primary, st.Err = sr.child(hdr, []byte{0})
+	if primary == nil && st.Err == nil {
+		st.Err = fmt.Errorf("%w: primary index of %s not found", ErrDamaged, name)
+	}
+	if st.Err != nil {
+		st.Lost = []SalvageGap{{}}
+	}
+	flush := func() (err error) {
+		if len(list) > 0 {
+			err = db.update(func(tx *bbolt.Tx) (err error) {
+				var rec, bck *bbolt.Bucket
+				rec, err = bucket(tx, name, true)
+				if err == nil {
+					bck, err = subbucket(rec, name, 0, true)
+				}
+				var fmts *bbolt.Bucket
+				for j := 0; j < len(list) && err == nil; j++ {
+					err = bck.Put(list[j].key, list[j].val)
+					if v := versions[string(list[j].key)]; v != nil && err == nil {
+						if fmts == nil {
+							fmts, err = formatBucket(tx, name, true)
+						}
+						if err == nil {
+							err = fmts.Put(list[j].key, v)
+						}
+					}
+				}
+				if err == nil && primary != nil {
+					err = bck.SetSequence(binary.LittleEndian.Uint64(primary[8:]))
+				}
+				return
+			})
+			list = list[:0]
+		}
+		return
+	}
+	var scratch Record
+	if recPtr != nil {
+		scratch = recPtr.New()
+	}
+	if primary != nil {
+		sr.bucket(primary, salvageVisitor{
+			leaf: func(flags uint32, k, v []byte) {
+				if err == nil && flags&cnBoltBucketLeaf == 0 {
+					if scratch == nil || salvageDecode(scratch, k, versions[string(k)], v) == nil {
+						if gap {
+							st.Lost[len(st.Lost)-1].Before = concat(k)
+							gap = false
+						}
+						list = append(list, kvType{concat(k), concat(v)})
+						last = k
+						st.Recovered++
+						if len(list) >= cnSalvageBatchSize {
+							err = flush()
+						}
+					} else {
+						st.Undecodable++
+					}
+				}
+			},
+			damaged: func(dmgErr error) {
+				if st.Err == nil {
+					st.Err = dmgErr
+				}
+				if !gap {
+					st.Lost = append(st.Lost, SalvageGap{After: concat(last)})
+					gap = true
+				}
+			},
+		})
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err == nil && recPtr != nil && st.Recovered > 0 {
+		var idxList []uint8
+		for j := uint8(1); j < recPtr.IndexCount(); j++ {
+			idxList = append(idxList, j)
+		}
+		if len(idxList) > 0 {
+			err = db.indexBuild(recPtr, idxList)
+		}
+	}
+	return
+}
+
+// salvageDecode migrates and unmarshals the data of the record with primary
+// key k and format version v into scratch.
+func salvageDecode(scratch Record, k, v, data []byte) error {
+	data, err := migrateVersion(scratch, k, v, data)
+	if err == nil {
+		err = scratch.UnmarshalBinary(data)
+	}
+	return err
+}
+
+// Salvage recovers what it can from the possibly damaged database at path
+// and stores it in a new database at dstPath, which is created with the
+// specified mode and options. The file is read page by page without the use
+// of bbolt, so that damage to one part of it does not prevent the recovery of
+// the rest. The primary records of every record type that can still be
+// reached are copied; secondary indexes are rebuilt for the types registered
+// with options.Records and are otherwise left for Open to build with
+// Options.Backfill. The format versions of records whose types implement
+// BinaryMigrator are copied with them, so that they are migrated correctly
+// when read. Other information that pinion keeps about the database, such as
+// checkpoints, is not copied. The source file is not modified.
+//
+// The returned list describes, for each record type found, how many records
+// were recovered and which ranges of primary keys were lost. If damage
+// prevents some record types from being found, those that were found are
+// salvaged and returned along with an error wrapping ErrDamaged. Any other
+// error means the salvage could not be completed.
+func Salvage(path, dstPath string, mode os.FileMode, options Options) (list []SalvageType, err error) {
+	var sr salvageReader
+	var dst *DB
+	var names []string
+	var hdrs [][]byte
+	var meta []byte
+	var versions map[string]map[string][]byte
+	var listErr error
+	if !exists(path) {
+		return nil, errNotExist(path)
+	}
+	err = sr.open(path)
+	if err == nil {
+		sr.bucket(sr.root, salvageVisitor{
+			leaf: func(flags uint32, k, v []byte) {
+				if flags&cnBoltBucketLeaf != 0 {
+					if string(k) == metaBucketName {
+						meta = concat(v)
+					} else {
+						names = append(names, string(k))
+						hdrs = append(hdrs, concat(v))
+					}
+				}
+			},
+			damaged: func(dmgErr error) {
+				if listErr == nil {
+					listErr = dmgErr
+				}
+			},
+		})
+		if meta != nil {
+			var verErr error
+			versions, verErr = sr.salvageVersions(meta)
+			if listErr == nil {
+				listErr = verErr
+			}
+		}
+		dst, err = Create(dstPath, mode, options)
+		if err == nil {
+			registered := make(map[string]Record)
+			for _, recPtr := range options.Records {
+				registered[recPtr.Name()] = recPtr
+			}
+			for j := 0; j < len(names) && err == nil; j++ {
+				var st SalvageType
+				st, err = dst.salvageType(&sr, names[j], hdrs[j], registered[names[j]], versions[names[j]])
+				list = append(list, st)
+			}
+			closeErr := dst.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+		sr.fl.Close()
+	}
+	if err == nil {
+		err = listErr
+	}
+	return
+}
@@ -0,0 +1,138 @@
+package pinion_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"go.etcd.io/bbolt"
+)
+
+// damage overwrites a leaf page of the quantity primary index with zeros and
+// returns the number of records that were stored in it.
+func damage(fileStr string) (count int, err error) {
+	var sl []byte
+	var pageSize int
+	var bdb *bbolt.DB
+	bdb, err = bbolt.Open(fileStr, 0600, nil)
+	if err == nil {
+		pageSize = bdb.Info().PageSize
+		bdb.Close()
+		sl, err = os.ReadFile(fileStr)
+	}
+	if err == nil {
+		var list []int
+		for pos := 0; pos+pageSize <= len(sl); pos += pageSize {
+			pg := sl[pos : pos+pageSize]
+			// Page header: id (8), flags (2), count (2), overflow (4); leaf
+			// element: flags (4), pos (4), key size (4), value size (4)
+			if binary.LittleEndian.Uint16(pg[8:]) == 0x02 && binary.LittleEndian.Uint16(pg[10:]) > 0 &&
+				binary.LittleEndian.Uint32(pg[24:]) == 4 && binary.LittleEndian.Uint32(pg[28:]) > 4 {
+				list = append(list, pos)
+			}
+		}
+		if len(list) > 2 {
+			pg := sl[list[len(list)/2]:][:pageSize]
+			count = int(binary.LittleEndian.Uint16(pg[10:]))
+			for j := range pg {
+				pg[j] = 0
+			}
+		}
+		err = os.WriteFile(fileStr, sl, 0600)
+	}
+	return
+}
+
+// Test recovery of records from a damaged database
+func TestSalvage(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var list []pinion.SalvageType
+	var lost, count int
+	opt := pinion.Options{Records: []pinion.Record{&quantityType{}}}
+	db, err = quantityDB("example/damaged.db", 1, 2000)
+	if err == nil {
+		db.Close()
+		lost, err = damage("example/damaged.db")
+	}
+	if err == nil && lost == 0 {
+		t.Fatalf("no page damaged")
+	}
+	if err == nil {
+		list, err = pinion.Salvage("example/damaged.db", "example/salvaged.db", 0600, opt)
+	}
+	if err == nil {
+		if len(list) != 1 || list[0].Name != "quantity" || !errors.Is(list[0].Err, pinion.ErrDamaged) {
+			t.Fatalf("unexpected salvage report %+v", list)
+		}
+		st := list[0]
+		if st.Recovered != 2000-lost || len(st.Lost) != 1 || st.Lost[0].After == nil || st.Lost[0].Before == nil {
+			t.Fatalf("unexpected salvage report %+v", st)
+		}
+		if gap := binary.BigEndian.Uint32(st.Lost[0].Before) - binary.BigEndian.Uint32(st.Lost[0].After) - 1; gap != uint32(lost) {
+			t.Fatalf("expecting gap of %d records, got %d", lost, gap)
+		}
+		db, err = pinion.Open("example/salvaged.db", 0600, opt)
+		if err == nil {
+			var q quantityType
+			err = db.Check(&q)
+			if err == nil {
+				err = db.Get(&q, idxQuantityVal, func() bool {
+					count++
+					return true
+				})
+			}
+			db.Close()
+		}
+		if err == nil && count != st.Recovered {
+			t.Fatalf("expecting %d records, got %d", st.Recovered, count)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test that records whose type implements BinaryMigrator keep their format
+// versions when salvaged
+func TestSalvage_Migrator(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/salvagefmt.db"
+	const dstStr = "example/salvagefmt_dst.db"
+	opt := pinion.Options{Records: []pinion.Record{&readingType{}}}
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	if err == nil {
+		err = db.PutRec(&readingOldType{id: 1, degrees: 18})
+		if err == nil {
+			err = db.PutRec(&readingType{id: 2, tenths: 215})
+		}
+		db.Close()
+	}
+	if err == nil {
+		_, err = pinion.Salvage(fileStr, dstStr, 0600, opt)
+	}
+	if err == nil {
+		db, err = pinion.Open(dstStr, 0600, opt)
+	}
+	if err == nil {
+		for _, want := range []readingType{{id: 1, tenths: 180}, {id: 2, tenths: 215}} {
+			r := readingType{id: want.id}
+			if err == nil {
+				err = db.GetRec(&r, 0)
+				if err == nil && r != want {
+					t.Fatalf("expecting %v, got %v", want, r)
+				}
+			}
+		}
+		if err == nil {
+			err = db.Check(&readingType{})
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,631 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piniondb/store"
+)
+
+// SchemaField describes one field of a record value in a Schema.
+type SchemaField struct {
+	// Name identifies the field. For the "json" encoding it is the name of
+	// the member in the stored object.
+	Name string `json:"name"`
+	// Type is one of uint8, uint16, uint32, uint64, int8, int16, int32,
+	// int64, str, bytes, time, float64 and bool. The last two are not
+	// supported by the "store" encoding.
+	Type string `json:"type"`
+	// Tag is the field's tag for the "tag" encoding. If zero, the field's
+	// position in Schema.Fields, counting from one, is used.
+	Tag uint64 `json:"tag,omitempty"`
+}
+
+// SchemaIndex describes how the key of one index is composed in a Schema.
+type SchemaIndex struct {
+	// Name is reported by the IndexName method of the record.
+	Name string `json:"name"`
+	// Fields lists the names of the fields that make up the key, in order.
+	Fields []string `json:"fields"`
+	// Widths holds the key width of each str and bytes field in Fields, in
+	// the same position. Widths of other fields are ignored.
+	Widths []uint `json:"widths,omitempty"`
+}
+
+// Schema describes a record type well enough to decode, encode and index its
+// stored values without its Go implementation. This allows generic tools such
+// as the pinionui package to work with the records of an application whose
+// source is not at hand. The descriptions are loaded at run time with
+// LoadSchemas and the resulting records registered with Options.Records.
+//
+// A schema can only describe records whose MarshalBinary and Key methods
+// follow one of the conventional layouts: fields packed in order with
+// store.PutBuffer ("store", the default), fields packed with TagPutBuffer
+// ("tag"), or an object encoded with encoding/json ("json"), and keys packed in
+// order with store.KeyBuffer.
+type Schema struct {
+	// Name is the record type name, as returned by the Name method of the
+	// application's record.
+	Name string `json:"name"`
+	// Encoding is "store", "tag" or "json". An empty value means "store".
+	Encoding string `json:"encoding,omitempty"`
+	// Fields lists the fields of the record value. For the "store" encoding
+	// they must be listed in the order in which they are packed.
+	Fields []SchemaField `json:"fields"`
+	// Indexes describes the keys of the record type; Indexes[0] is the
+	// primary key.
+	Indexes []SchemaIndex `json:"indexes"`
+	// ID optionally names the integer field that is assigned by NextID.
+	ID string `json:"id,omitempty"`
+}
+
+// SchemaRecord is a record whose layout is described by a Schema. Its field
+// values are represented as uint64 for unsigned integers, int64 for signed
+// integers, and as string, []byte, time.Time, float64 and bool otherwise.
+type SchemaRecord struct {
+	schema *Schema
+	vals   []interface{}
+}
+
+var schemaKeyTypes = map[string]bool{
+	"uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"int8": true, "int16": true, "int32": true, "int64": true,
+	"str": true, "bytes": true, "time": true,
+}
+
+// LoadSchemas reads a JSON array of Schema values from r and returns a record
+// for each of them. The records can be registered with Options.Records.
+func LoadSchemas(r io.Reader) (list []Record, err error) {
+	var schemas []Schema
+	err = json.NewDecoder(r).Decode(&schemas)
+	for j := 0; j < len(schemas) && err == nil; j++ {
+		err = schemas[j].validate()
+		if err == nil {
+			list = append(list, schemas[j].record())
+		}
+	}
+	if err != nil {
+		list = nil
+	}
+	return
+}
+
+// field returns the position of the named field, or -1 if it does not exist.
+func (s *Schema) field(name string) int {
+	for j, f := range s.Fields {
+		if f.Name == name {
+			return j
+		}
+	}
+	return -1
+}
+
+// validate reports the first problem found in the schema.
+func (s *Schema) validate() (err error) {
+	fail := func(format string, args ...interface{}) {
+		if err == nil {
+			err = fmt.Errorf("schema %q: "+format, append([]interface{}{s.Name}, args...)...)
+		}
+	}
+	if s.Name == "" {
+		fail("name is empty")
+	}
+	switch s.Encoding {
+	case "", "store", "tag", "json":
+	default:
+		fail("unknown encoding %q", s.Encoding)
+	}
+	if len(s.Fields) == 0 {
+		fail("no fields")
+	}
+	for j, f := range s.Fields {
+		switch {
+		case f.Name == "" || s.field(f.Name) != j:
+			fail("field name %q is empty or repeated", f.Name)
+		case f.Type == "float64" || f.Type == "bool":
+			if s.Encoding == "" || s.Encoding == "store" {
+				fail("field %s: type %s not supported by store encoding", f.Name, f.Type)
+			}
+		case !schemaKeyTypes[f.Type]:
+			fail("field %s: unknown type %q", f.Name, f.Type)
+		}
+	}
+	if len(s.Indexes) == 0 || len(s.Indexes) > 255 {
+		fail("must have from 1 to 255 indexes")
+	}
+	for j, idx := range s.Indexes {
+		if len(idx.Fields) == 0 {
+			fail("index %d has no fields", j)
+		}
+		for k, name := range idx.Fields {
+			pos := s.field(name)
+			switch {
+			case pos < 0:
+				fail("index %d: unknown field %q", j, name)
+			case !schemaKeyTypes[s.Fields[pos].Type]:
+				fail("index %d: field %s cannot be part of a key", j, name)
+			case s.Fields[pos].Type == "str" || s.Fields[pos].Type == "bytes":
+				if k >= len(idx.Widths) || idx.Widths[k] == 0 {
+					fail("index %d: field %s needs a key width", j, name)
+				}
+			}
+		}
+	}
+	if s.ID != "" {
+		pos := s.field(s.ID)
+		if pos < 0 || !strings.Contains(s.Fields[pos].Type, "int") {
+			fail("id %q is not an integer field", s.ID)
+		}
+	}
+	return
+}
+
+// record returns an empty record for the schema.
+func (s *Schema) record() *SchemaRecord {
+	rec := &SchemaRecord{schema: s, vals: make([]interface{}, len(s.Fields))}
+	for j, f := range s.Fields {
+		rec.vals[j] = schemaZero(f.Type)
+	}
+	return rec
+}
+
+// schemaZero returns the zero value of the representation of typ.
+func schemaZero(typ string) interface{} {
+	switch typ {
+	case "str":
+		return ""
+	case "bytes":
+		return []byte(nil)
+	case "time":
+		return time.Time{}
+	case "float64":
+		return float64(0)
+	case "bool":
+		return false
+	}
+	if strings.HasPrefix(typ, "u") {
+		return uint64(0)
+	}
+	return int64(0)
+}
+
+// Schema returns the description of the record's type.
+func (rec *SchemaRecord) Schema() Schema {
+	return *rec.schema
+}
+
+// Field returns the value of the named field, or nil if there is no such
+// field.
+func (rec *SchemaRecord) Field(name string) interface{} {
+	if pos := rec.schema.field(name); pos >= 0 {
+		return rec.vals[pos]
+	}
+	return nil
+}
+
+// SetField assigns val to the named field. val must have the representation
+// documented for SchemaRecord.
+func (rec *SchemaRecord) SetField(name string, val interface{}) (err error) {
+	pos := rec.schema.field(name)
+	if pos < 0 {
+		err = fmt.Errorf("schema %q has no field %s", rec.schema.Name, name)
+	} else if fmt.Sprintf("%T", val) != fmt.Sprintf("%T", rec.vals[pos]) {
+		err = fmt.Errorf("field %s: %T is not the representation of %s", name, val, rec.schema.Fields[pos].Type)
+	} else {
+		rec.vals[pos] = val
+	}
+	return
+}
+
+// String implements the fmt.Stringer interface.
+func (rec *SchemaRecord) String() string {
+	var buf bytes.Buffer
+	for j, f := range rec.schema.Fields {
+		if j > 0 {
+			buf.WriteString(", ")
+		}
+		switch v := rec.vals[j].(type) {
+		case string:
+			fmt.Fprintf(&buf, "%s: %q", f.Name, v)
+		case []byte:
+			fmt.Fprintf(&buf, "%s: %x", f.Name, v)
+		case time.Time:
+			fmt.Fprintf(&buf, "%s: %s", f.Name, v.Format(time.RFC3339Nano))
+		default:
+			fmt.Fprintf(&buf, "%s: %v", f.Name, v)
+		}
+	}
+	return buf.String()
+}
+
+// Name implements the Record interface.
+func (rec *SchemaRecord) Name() string {
+	return rec.schema.Name
+}
+
+// IndexCount implements the Record interface.
+func (rec *SchemaRecord) IndexCount() uint8 {
+	return uint8(len(rec.schema.Indexes))
+}
+
+// IndexName implements the IndexNamer interface.
+func (rec *SchemaRecord) IndexName(idx uint8) (name string) {
+	if int(idx) < len(rec.schema.Indexes) {
+		name = rec.schema.Indexes[idx].Name
+	}
+	return
+}
+
+// New implements the Record interface.
+func (rec *SchemaRecord) New() Record {
+	return rec.schema.record()
+}
+
+// NextID implements the Record interface. The ID is assigned to the field
+// named by Schema.ID, if any.
+func (rec *SchemaRecord) NextID(id uint64) {
+	if pos := rec.schema.field(rec.schema.ID); pos >= 0 {
+		if _, ok := rec.vals[pos].(uint64); ok {
+			rec.vals[pos] = id
+		} else {
+			rec.vals[pos] = int64(id)
+		}
+	}
+}
+
+// Key implements the Record interface.
+func (rec *SchemaRecord) Key(idx uint8) (key []byte, err error) {
+	var kb store.KeyBuffer
+	if int(idx) < len(rec.schema.Indexes) {
+		sidx := rec.schema.Indexes[idx]
+		for k, name := range sidx.Fields {
+			pos := rec.schema.field(name)
+			var width uint
+			if k < len(sidx.Widths) {
+				width = sidx.Widths[k]
+			}
+			switch v := rec.vals[pos].(type) {
+			case uint64:
+				switch rec.schema.Fields[pos].Type {
+				case "uint8":
+					kb.Uint8(uint8(v))
+				case "uint16":
+					kb.Uint16(uint16(v))
+				case "uint32":
+					kb.Uint32(uint32(v))
+				default:
+					kb.Uint64(v)
+				}
+			case int64:
+				switch rec.schema.Fields[pos].Type {
+				case "int8":
+					kb.Int8(int8(v))
+				case "int16":
+					kb.Int16(int16(v))
+				case "int32":
+					kb.Int32(int32(v))
+				default:
+					kb.Int64(v)
+				}
+			case string:
+				kb.Str(v, width)
+			case []byte:
+				kb.Bytes(v, width)
+			case time.Time:
+				kb.Time(v)
+			}
+		}
+	} else {
+		kb.SetError(fmt.Errorf("index %d is out of bounds", idx))
+	}
+	return kb.Data()
+}
+
+// tag returns the tag of the field at position pos.
+func (rec *SchemaRecord) tag(pos int) uint64 {
+	if tag := rec.schema.Fields[pos].Tag; tag != 0 {
+		return tag
+	}
+	return uint64(pos + 1)
+}
+
+// MarshalBinary implements the Record interface.
+func (rec *SchemaRecord) MarshalBinary() (data []byte, err error) {
+	switch rec.schema.Encoding {
+	case "tag":
+		var put TagPutBuffer
+		for j, f := range rec.schema.Fields {
+			tag := rec.tag(j)
+			switch v := rec.vals[j].(type) {
+			case uint64:
+				if f.Type == "uint64" {
+					put.Uint64(tag, v)
+				} else {
+					put.Uint32(tag, uint32(v))
+				}
+			case int64:
+				if f.Type == "int64" {
+					put.Int64(tag, v)
+				} else {
+					put.Int32(tag, int32(v))
+				}
+			case string:
+				put.Str(tag, v)
+			case []byte:
+				put.Bytes(tag, v)
+			case time.Time:
+				put.Time(tag, v)
+			case float64:
+				put.Float64(tag, v)
+			case bool:
+				put.Bool(tag, v)
+			}
+		}
+		data, err = put.Data()
+	case "json":
+		obj := make(map[string]interface{}, len(rec.vals))
+		for j, f := range rec.schema.Fields {
+			obj[f.Name] = rec.vals[j]
+		}
+		data, err = json.Marshal(obj)
+	default:
+		var put store.PutBuffer
+		for j, f := range rec.schema.Fields {
+			switch v := rec.vals[j].(type) {
+			case uint64:
+				switch f.Type {
+				case "uint8":
+					put.Uint8(uint8(v))
+				case "uint16":
+					put.Uint16(uint16(v))
+				case "uint32":
+					put.Uint32(uint32(v))
+				default:
+					put.Uint64(v)
+				}
+			case int64:
+				switch f.Type {
+				case "int8":
+					put.Int8(int8(v))
+				case "int16":
+					put.Int16(int16(v))
+				case "int32":
+					put.Int32(int32(v))
+				default:
+					put.Int64(v)
+				}
+			case string:
+				put.Str(v)
+			case []byte:
+				put.Bytes(v)
+			case time.Time:
+				put.Time(v)
+			}
+		}
+		data, err = put.Data()
+	}
+	return
+}
+
+// UnmarshalBinary implements the Record interface.
+func (rec *SchemaRecord) UnmarshalBinary(data []byte) (err error) {
+	for j, f := range rec.schema.Fields {
+		rec.vals[j] = schemaZero(f.Type)
+	}
+	switch rec.schema.Encoding {
+	case "tag":
+		get := NewTagGetBuffer(data)
+		for j, f := range rec.schema.Fields {
+			tag := rec.tag(j)
+			switch v := rec.vals[j].(type) {
+			case uint64:
+				if f.Type == "uint64" {
+					get.Uint64(tag, &v)
+				} else {
+					var v32 uint32
+					get.Uint32(tag, &v32)
+					v = uint64(v32)
+				}
+				rec.vals[j] = v
+			case int64:
+				if f.Type == "int64" {
+					get.Int64(tag, &v)
+				} else {
+					var v32 int32
+					get.Int32(tag, &v32)
+					v = int64(v32)
+				}
+				rec.vals[j] = v
+			case string:
+				get.Str(tag, &v)
+				rec.vals[j] = v
+			case []byte:
+				get.Bytes(tag, &v)
+				rec.vals[j] = v
+			case time.Time:
+				get.Time(tag, &v)
+				rec.vals[j] = v
+			case float64:
+				get.Float64(tag, &v)
+				rec.vals[j] = v
+			case bool:
+				get.Bool(tag, &v)
+				rec.vals[j] = v
+			}
+		}
+		err = get.Done()
+	case "json":
+		err = rec.jsonDecode(data)
+	default:
+		get := store.NewGetBuffer(data)
+		for j, f := range rec.schema.Fields {
+			switch v := rec.vals[j].(type) {
+			case uint64:
+				switch f.Type {
+				case "uint8":
+					var n uint8
+					get.Uint8(&n)
+					v = uint64(n)
+				case "uint16":
+					var n uint16
+					get.Uint16(&n)
+					v = uint64(n)
+				case "uint32":
+					var n uint32
+					get.Uint32(&n)
+					v = uint64(n)
+				default:
+					get.Uint64(&v)
+				}
+				rec.vals[j] = v
+			case int64:
+				switch f.Type {
+				case "int8":
+					var n int8
+					get.Int8(&n)
+					v = int64(n)
+				case "int16":
+					var n int16
+					get.Int16(&n)
+					v = int64(n)
+				case "int32":
+					var n int32
+					get.Int32(&n)
+					v = int64(n)
+				default:
+					get.Int64(&v)
+				}
+				rec.vals[j] = v
+			case string:
+				get.Str(&v)
+				rec.vals[j] = v
+			case []byte:
+				get.Bytes(&v)
+				rec.vals[j] = v
+			case time.Time:
+				get.Time(&v)
+				rec.vals[j] = v
+			}
+		}
+		err = get.Done()
+	}
+	return
+}
+
+// jsonDecode assigns the fields of rec from a JSON object. Members that are
+// not described by the schema are ignored.
+func (rec *SchemaRecord) jsonDecode(data []byte) (err error) {
+	var obj map[string]json.RawMessage
+	err = json.Unmarshal(data, &obj)
+	for j, f := range rec.schema.Fields {
+		raw, ok := obj[f.Name]
+		if err != nil || !ok || string(raw) == "null" {
+			continue
+		}
+		var s string
+		switch rec.vals[j].(type) {
+		case uint64:
+			var v uint64
+			v, err = strconv.ParseUint(string(raw), 10, 64)
+			rec.vals[j] = v
+		case int64:
+			var v int64
+			v, err = strconv.ParseInt(string(raw), 10, 64)
+			rec.vals[j] = v
+		case float64:
+			var v float64
+			err = json.Unmarshal(raw, &v)
+			rec.vals[j] = v
+		case bool:
+			var v bool
+			err = json.Unmarshal(raw, &v)
+			rec.vals[j] = v
+		case string:
+			err = json.Unmarshal(raw, &s)
+			rec.vals[j] = s
+		case []byte:
+			err = json.Unmarshal(raw, &s)
+			if err == nil {
+				rec.vals[j], err = base64.StdEncoding.DecodeString(s)
+			}
+		case time.Time:
+			var v time.Time
+			err = json.Unmarshal(raw, &v)
+			rec.vals[j] = v
+		}
+		if err != nil {
+			err = fmt.Errorf("field %s: %w", f.Name, err)
+		}
+	}
+	return
+}
+
+// KeySegments implements the KeySegmenter interface.
+func (rec *SchemaRecord) KeySegments(idx uint8, key []byte) (segs []string) {
+	if int(idx) >= len(rec.schema.Indexes) {
+		return nil
+	}
+	sidx := rec.schema.Indexes[idx]
+	for k, name := range sidx.Fields {
+		typ := rec.schema.Fields[rec.schema.field(name)].Type
+		var size int
+		switch typ {
+		case "uint8", "int8":
+			size = 1
+		case "uint16", "int16":
+			size = 2
+		case "uint32", "int32":
+			size = 4
+		case "str", "bytes":
+			size = int(sidx.Widths[k])
+		default:
+			size = 8
+		}
+		if len(key) < size {
+			return nil
+		}
+		var u uint64
+		for _, b := range key[:size] {
+			u = u<<8 | uint64(b)
+		}
+		var seg string
+		switch typ {
+		case "uint8", "uint16", "uint32", "uint64":
+			seg = strconv.FormatUint(u, 10)
+		case "int8", "int16", "int32", "int64":
+			// Keys of signed integers are offset so that they sort correctly
+			seg = strconv.FormatInt(int64(u^1<<(8*size-1))<<(64-8*size)>>(64-8*size), 10)
+		case "str":
+			seg = strconv.Quote(strings.TrimRight(string(key[:size]), " "))
+		case "bytes":
+			seg = fmt.Sprintf("%x", key[:size])
+		case "time":
+			seg = time.Unix(int64(u^1<<63), 0).UTC().Format(time.RFC3339)
+		}
+		segs = append(segs, seg)
+		key = key[size:]
+	}
+	return
+}
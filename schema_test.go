@@ -0,0 +1,61 @@
+package pinion_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/piniondb/pinion"
+)
+
+const contactSchema = `[{
+	"name": "contact",
+	"encoding": "tag",
+	"fields": [
+		{"name": "id", "type": "uint32"},
+		{"name": "name", "type": "str"},
+		{"name": "phone", "type": "str"},
+		{"name": "seen", "type": "time"}
+	],
+	"indexes": [{"name": "ID", "fields": ["id"]}],
+	"id": "id"
+}]`
+
+// This example demonstrates reading and writing contact records by means of
+// a schema loaded at run time rather than the contact record types.
+func ExampleLoadSchemas() {
+	var db *pinion.DB
+	var list []pinion.Record
+	var err error
+	db, err = pinion.Create("example/schema.db", 0600, pinion.Options{})
+	if err == nil {
+		err = db.AddRec(&contactRecV2{contactV2{name: "Carol", phone: "555-0100"}})
+		db.Close()
+	}
+	if err == nil {
+		list, err = pinion.LoadSchemas(strings.NewReader(contactSchema))
+	}
+	if err == nil {
+		db, err = pinion.Open("example/schema.db", 0600, pinion.Options{Records: list})
+	}
+	if err == nil {
+		rec := db.RecordTypes()[0].New().(*pinion.SchemaRecord)
+		err = rec.SetField("name", "Robert")
+		if err == nil {
+			err = db.AddRec(rec)
+		}
+		if err == nil {
+			rec = db.RecordTypes()[0].New().(*pinion.SchemaRecord)
+			err = db.Get(rec, 0, func() bool {
+				fmt.Println(rec.Field("id"), rec.Field("name"), rec.Field("phone"))
+				return true
+			})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 1 Carol 555-0100
+	// 2 Robert
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+
+	"github.com/piniondb/store"
+)
+
+// SeekKeys returns the lowest and highest possible keys of index idx that
+// begin with the leading key fields packed by bound. bound is passed an empty
+// key buffer and should pack the fields that are to be matched in the same
+// way as the Key method of recPtr, for example the customer ID of an index
+// keyed by customer ID and order date. The remainder of each key is padded
+// with the lowest or highest byte value, as appropriate, to the length of the
+// key that recPtr returns for idx, so none of the widths of the open fields
+// need to be known. Only the type of recPtr is used.
+//
+// The keys are typically passed to GetKeyRange. A range over the first open
+// field, such as the orders of one customer within a year, is obtained by
+// taking lo from a call that binds the customer ID and the first date of the
+// year and hi from a call that binds the customer ID and the last.
+func SeekKeys(recPtr Record, idx uint8, bound func(kb *store.KeyBuffer)) (lo, hi []byte, err error) {
+	var key, prefix []byte
+	var kb store.KeyBuffer
+	key, err = recPtr.New().Key(idx)
+	if err == nil {
+		bound(&kb)
+		prefix, err = kb.Data()
+	}
+	if err == nil {
+		pad := 0
+		if len(key) > len(prefix) {
+			pad = len(key) - len(prefix)
+		}
+		lo = concat(prefix, make([]byte, pad))
+		hi = concat(prefix, bytes.Repeat([]byte{0xff}, pad))
+	}
+	return
+}
+
+// GetKeyRange functions like Get except that the records returned are those
+// whose key for index idx lies between lo and hi inclusive. For secondary
+// indexes, the primary key that is appended to stored keys is not part of the
+// comparison. The keys are usually obtained with SeekKeys. The initial value
+// of the record pointed to by recPtr is not used.
+func (db *DB) GetKeyRange(recPtr Record, idx uint8, lo, hi []byte, f func() bool) error {
+	return db.scan(recPtr, &scanType{idx: idx, from: lo, within: func(key []byte) bool {
+		return bytes.Compare(key, hi) <= 0
+	}}, f)
+}
+
+// GetMatch functions like Get except that only the records whose key for
+// index idx begins with exactly the fields packed by bound are returned.
+// bound is passed an empty key buffer and packs leading key fields as
+// described for SeekKeys. Every field that bound packs is matched exactly,
+// even if it holds an empty string or a zero value, and every field that it
+// leaves out matches any value. This removes the ambiguity of the initial
+// record passed to Get, in which an empty string could mean either that the
+// field is unset, so that the search starts at the beginning, or that only
+// records with an empty value are wanted. The initial value of the record
+// pointed to by recPtr is not used.
+func (db *DB) GetMatch(recPtr Record, idx uint8, bound func(kb *store.KeyBuffer), f func() bool) (err error) {
+	var lo, hi []byte
+	lo, hi, err = SeekKeys(recPtr, idx, bound)
+	if err == nil {
+		err = db.GetKeyRange(recPtr, idx, lo, hi, f)
+	}
+	return
+}
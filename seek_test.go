@@ -0,0 +1,109 @@
+package pinion_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// This example demonstrates scans of index ranges in which only the leading
+// fields of the key are specified.
+func ExampleSeekKeys() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/seek.db", 0600, pinion.Options{})
+	if err == nil {
+		wdb := db.Wrap()
+		for _, n := range []nameType{
+			{last: "Jones", first: "Robert"}, {last: "Smith", first: "Carol"},
+			{last: "Jones", first: "Alice"}, {last: "Brown", first: "Ted"},
+			{last: "Kim", first: "Bob"},
+		} {
+			wdb.AddRec(&personType{name: n})
+		}
+		err = wdb.Error()
+	}
+	show := func(lo, hi []byte) {
+		var p personType
+		var list []string
+		if err == nil {
+			err = db.GetKeyRange(&p, idxPersonNameLast, lo, hi, func() bool {
+				list = append(list, p.name.first)
+				return true
+			})
+			fmt.Println(strings.Join(list, ", "))
+		}
+	}
+	if err == nil {
+		var lo, hi []byte
+		lo, hi, err = pinion.SeekKeys(&personType{}, idxPersonNameLast, func(kb *store.KeyBuffer) {
+			kb.Str("Jones", 12)
+		})
+		show(lo, hi)
+		if err == nil {
+			lo, _, err = pinion.SeekKeys(&personType{}, idxPersonNameLast, func(kb *store.KeyBuffer) {
+				kb.Str("Brown", 12)
+			})
+		}
+		if err == nil {
+			_, hi, err = pinion.SeekKeys(&personType{}, idxPersonNameLast, func(kb *store.KeyBuffer) {
+				kb.Str("Jones", 12)
+			})
+		}
+		show(lo, hi)
+	}
+	if db != nil {
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Alice, Robert
+	// Ted, Alice, Robert
+}
+
+// This example demonstrates the difference between a search seeded with an
+// empty string and an exact match of one.
+func ExampleDB_GetMatch() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/match.db", 0600, pinion.Options{})
+	if err == nil {
+		wdb := db.Wrap()
+		for _, title := range []string{"Plan", "", "Ship", ""} {
+			wdb.AddRec(&taskType{title: title})
+		}
+		err = wdb.Error()
+	}
+	show := func(label string, get func(t *taskType, f func() bool) error) {
+		var t taskType
+		var list []uint32
+		if err == nil {
+			err = get(&t, func() bool {
+				list = append(list, t.id)
+				return true
+			})
+			fmt.Println(label, list)
+		}
+	}
+	show("seeded", func(t *taskType, f func() bool) error {
+		return db.Get(t, 1, f)
+	})
+	show("matched", func(t *taskType, f func() bool) error {
+		return db.GetMatch(t, 1, func(kb *store.KeyBuffer) {
+			kb.Str("", 16)
+		}, f)
+	})
+	if db != nil {
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// seeded [2 4 1 3]
+	// matched [2 4]
+}
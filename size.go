@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"math/bits"
+
+	"go.etcd.io/bbolt"
+)
+
+// Name of the bucket, within the meta bucket, that holds a histogram of the
+// sizes of the stored records of each type. A key is the type name followed
+// by a zero byte and a size class, and the value is the big-endian 64-bit
+// number of records in that class. The key made of the type name and the zero
+// byte alone marks a histogram that is being kept.
+const sizeBucketName = "size"
+
+// sizeClasses is the number of size classes. Records of class j, for j > 0,
+// have between 2^(j-1) and 2^j - 1 bytes; class 0 holds empty records.
+const sizeClasses = 33
+
+// RecordSize describes a record that exceeds Options.RecordSizeThreshold.
+type RecordSize struct {
+	Name string // Name of the record type
+	Key  []byte // Primary key of the record
+	Size int    // Size of the record's data in bytes
+}
+
+// sizeClass returns the size class of a record of n bytes.
+func sizeClass(n int) byte {
+	c := bits.Len(uint(n))
+	if c >= sizeClasses {
+		c = sizeClasses - 1
+	}
+	return byte(c)
+}
+
+// sizeScan returns the histogram of the sizes of the records in the primary
+// index bck.
+func sizeScan(bck *bbolt.Bucket) (hist []uint64) {
+	hist = make([]uint64, sizeClasses)
+	bck.ForEach(func(k, v []byte) error {
+		hist[sizeClass(len(v))]++
+		return nil
+	})
+	return
+}
+
+// sizeTrim returns hist without its trailing empty classes.
+func sizeTrim(hist []uint64) []uint64 {
+	n := len(hist)
+	for n > 0 && hist[n-1] == 0 {
+		n--
+	}
+	return hist[:n]
+}
+
+// sizeAdd updates the size histogram of the type named nameStr for a record
+// whose size changes from oldSize to newSize bytes. An oldSize of -1 denotes
+// a record that is added and a newSize of -1 one that is deleted. Like
+// countAdd, it must be called before the record is stored or deleted.
+func (bck bucketGrpType) sizeAdd(nameStr string, oldSize, newSize int) (err error) {
+	var meta, sz *bbolt.Bucket
+	meta, err = bucket(bck.rec.Tx(), metaBucketName, true)
+	if err == nil {
+		sz, err = meta.CreateBucketIfNotExists([]byte(sizeBucketName))
+	}
+	if err != nil {
+		return
+	}
+	marker := countKey(nameStr)
+	if sz.Get(marker) == nil {
+		for j, n := range sizeScan(bck.idxs[0]) {
+			if n > 0 && err == nil {
+				err = sizePut(sz, concat(marker, []byte{byte(j)}), n)
+			}
+		}
+		if err == nil {
+			err = sz.Put(marker, []byte{})
+		}
+	}
+	adjust := func(size int, add bool) {
+		if size >= 0 && err == nil {
+			key := concat(marker, []byte{sizeClass(size)})
+			var n uint64
+			if data := sz.Get(key); len(data) == 8 {
+				n = binary.BigEndian.Uint64(data)
+			}
+			if add {
+				n++
+			} else if n > 0 {
+				n--
+			}
+			err = sizePut(sz, key, n)
+		}
+	}
+	if oldSize < 0 || newSize < 0 || sizeClass(oldSize) != sizeClass(newSize) {
+		adjust(oldSize, false)
+		adjust(newSize, true)
+	}
+	return
+}
+
+// sizePut stores a class count of a size histogram, removing it if it is
+// zero.
+func sizePut(sz *bbolt.Bucket, key []byte, n uint64) error {
+	if n == 0 {
+		return sz.Delete(key)
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	return sz.Put(key, buf[:])
+}
+
+// oversize returns a function that reports a record of recPtr's type that
+// exceeds Options.RecordSizeThreshold, or nil if no threshold is set.
+func (db *DB) oversize(recPtr Record) func(key []byte, size int) {
+	limit := db.opt.RecordSizeThreshold
+	if limit <= 0 {
+		return nil
+	}
+	nameStr := recPtr.Name()
+	return func(key []byte, size int) {
+		if size >= limit {
+			rs := RecordSize{Name: nameStr, Key: concat(key), Size: size}
+			if db.opt.RecordSizeHook != nil {
+				db.opt.RecordSizeHook(rs)
+			} else {
+				log.Printf("pinion: %s record %x has %d bytes", rs.Name, rs.Key, rs.Size)
+			}
+		}
+	}
+}
+
+// SizeHistogram returns the distribution of the sizes of the stored records
+// of recPtr's type. Element j, for j > 0, is the number of records whose data
+// has between 2^(j-1) and 2^j - 1 bytes, and element 0 is the number of empty
+// records; trailing empty classes are omitted. The histogram is maintained as
+// records are written and deleted. The records of a type last written by a
+// version of pinion that did not keep histograms are visited instead, until
+// the next write of the type establishes its histogram. Only the type of
+// recPtr is used.
+func (db *DB) SizeHistogram(recPtr Record) (hist []uint64, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.SizeHistogram(recPtr)
+	}
+	err = db.view(func(tx *bbolt.Tx) error {
+		hist = sizeGet(tx, recPtr.Name())
+		return nil
+	})
+	return
+}
+
+// sizeGet returns the size histogram of the type named nameStr.
+func sizeGet(tx *bbolt.Tx, nameStr string) (hist []uint64) {
+	marker := countKey(nameStr)
+	if meta := tx.Bucket([]byte(metaBucketName)); meta != nil {
+		if sz := meta.Bucket([]byte(sizeBucketName)); sz != nil && sz.Get(marker) != nil {
+			hist = make([]uint64, sizeClasses)
+			c := sz.Cursor()
+			for k, v := c.Seek(marker); bytes.HasPrefix(k, marker); k, v = c.Next() {
+				if len(k) == len(marker)+1 && k[len(marker)] < sizeClasses && len(v) == 8 {
+					hist[k[len(marker)]] = binary.BigEndian.Uint64(v)
+				}
+			}
+			return sizeTrim(hist)
+		}
+	}
+	if bck := tx.Bucket([]byte(nameStr)); bck != nil {
+		if idx := bck.Bucket([]byte{0}); idx != nil {
+			hist = sizeTrim(sizeScan(idx))
+		}
+	}
+	return
+}
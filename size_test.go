@@ -0,0 +1,58 @@
+package pinion_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example tracks the sizes of stored records and reports one that is
+// unexpectedly large.
+func ExampleDB_SizeHistogram() {
+	var db *pinion.DB
+	var err error
+	var hist []uint64
+	opt := pinion.Options{
+		RecordSizeThreshold: 4096,
+		RecordSizeHook: func(rs pinion.RecordSize) {
+			fmt.Printf("%s record %x has %d bytes\n", rs.Name, rs.Key, rs.Size)
+		},
+	}
+	db, err = pinion.Create("example/size.db", 0600, opt)
+	if err == nil {
+		wdb := db.Wrap()
+		for _, title := range []string{"Groceries", "Call Carol", "Water plants",
+			strings.Repeat("Pasted by mistake ", 400)} {
+			n := noteType{Title: title}
+			wdb.AddRec(&n)
+		}
+		err = wdb.Error()
+		show := func() {
+			if err == nil {
+				hist, err = db.SizeHistogram(&noteType{})
+				for j, count := range hist {
+					if count > 0 {
+						fmt.Printf("%5d..%5d bytes: %d\n", 1<<j>>1, 1<<j-1, count)
+					}
+				}
+			}
+		}
+		show()
+		if err == nil {
+			fmt.Println("deleting 4")
+			err = db.DeleteRec(&noteType{ID: 4})
+		}
+		show()
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// note record 00000004 has 7219 bytes
+	//    16..   31 bytes: 3
+	//  4096.. 8191 bytes: 1
+	// deleting 4
+	//    16..   31 bytes: 3
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+
+	"go.etcd.io/bbolt"
+)
+
+// Name of the bucket, within the meta bucket, that holds a HyperLogLog sketch
+// for each index of the types listed in Options.Sketches. It contains a
+// bucket for each type, which contains a bucket for each index. The keys of
+// an index bucket are the big-endian register numbers and the values are the
+// nonzero register values.
+const (
+	sketchBucketName = "sketch"
+	sketchPrecision  = 12 // 4096 registers; standard error about 1.6 percent
+)
+
+// sketched reports whether the type of recPtr is listed in Options.Sketches.
+func (db *DB) sketched(recPtr Record) bool {
+	name := recPtr.Name()
+	for _, r := range db.opt.Sketches {
+		if r.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sketchHash returns a well-mixed 64-bit hash of key.
+func sketchHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	x := h.Sum64()
+	// Finalizer of splitmix64
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// sketchBucket returns the sketch bucket of index idx of the type named
+// nameStr, or nil if it does not exist and createIfNeeded is false.
+func sketchBucket(tx *bbolt.Tx, nameStr string, idx uint8, createIfNeeded bool) (bck *bbolt.Bucket, err error) {
+	path := [][]byte{[]byte(sketchBucketName), []byte(nameStr), {idx}}
+	bck, err = bucket(tx, metaBucketName, createIfNeeded)
+	for j := 0; j < len(path) && err == nil && bck != nil; j++ {
+		if createIfNeeded {
+			bck, err = bck.CreateBucketIfNotExists(path[j])
+		} else {
+			bck = bck.Bucket(path[j])
+		}
+	}
+	if err != nil && !createIfNeeded {
+		bck, err = nil, nil
+	}
+	return
+}
+
+// sketchKey records key in a sketch bucket.
+func sketchKey(bck *bbolt.Bucket, key []byte) (err error) {
+	var reg [2]byte
+	h := sketchHash(key)
+	binary.BigEndian.PutUint16(reg[:], uint16(h>>(64-sketchPrecision)))
+	rho := uint8(bits.LeadingZeros64(h<<sketchPrecision|1<<(sketchPrecision-1))) + 1
+	if cur := bck.Get(reg[:]); len(cur) == 0 || cur[0] < rho {
+		err = bck.Put(reg[:], []byte{rho})
+	}
+	return
+}
+
+// sketchAdd records the keys of a record that has just been stored in the
+// sketches of its type.
+func sketchAdd(tx *bbolt.Tx, nameStr string, val valType) (err error) {
+	primaryKey := val.keys[0]
+	for j := 0; j < len(val.keys) && err == nil; j++ {
+		var bck *bbolt.Bucket
+		list := [][]byte{val.keys[j]}
+		if val.sets != nil && j > 0 {
+			list = val.sets[j]
+		}
+		for _, key := range list {
+			if key == nil {
+				continue
+			}
+			if bck == nil {
+				bck, err = sketchBucket(tx, nameStr, uint8(j), true)
+			}
+			if err == nil {
+				if j > 0 {
+					// Secondary entry keys are followed by the primary key
+					key = key[:len(key)-len(primaryKey)]
+				}
+				err = sketchKey(bck, key)
+			}
+		}
+	}
+	return
+}
+
+// sketchInit builds the sketches of the types listed in Options.Sketches that
+// have stored records but no sketches, such as types that have just been
+// listed.
+func (db *DB) sketchInit() (err error) {
+	if db.opt.BoltOpt.ReadOnly {
+		return
+	}
+	for _, recPtr := range db.opt.Sketches {
+		nameStr := recPtr.Name()
+		count := recPtr.IndexCount()
+		if err == nil {
+			err = db.update(func(tx *bbolt.Tx) (err error) {
+				var bck bucketGrpType
+				var sk *bbolt.Bucket
+				if tx.Bucket([]byte(nameStr)) == nil {
+					return
+				}
+				sk, _ = sketchBucket(tx, nameStr, 0, false)
+				if sk != nil {
+					return
+				}
+				bck, err = bucketGet(recPtr, count, false, tx)
+				for j := uint8(0); j < count && err == nil; j++ {
+					sk, err = sketchBucket(tx, nameStr, j, true)
+					if err == nil {
+						err = bck.idxs[j].ForEach(func(k, v []byte) error {
+							if j > 0 {
+								k = k[:len(k)-len(v)]
+							}
+							return sketchKey(sk, k)
+						})
+					}
+				}
+				return
+			})
+		}
+	}
+	return
+}
+
+// ApproxDistinct returns an estimate of the number of distinct keys in index
+// idx of the type pointed to by recPtr, which must be listed in
+// Options.Sketches. For index 0, this is the number of records. The estimate
+// is maintained with a HyperLogLog sketch that is updated as records are
+// written, so it is obtained without scanning the index; its standard error is
+// about 1.6 percent. Keys that are removed, whether by deletion or by an
+// update, continue to be counted, so the estimate reflects all of the keys
+// that an index has held since the type was listed.
+func (db *DB) ApproxDistinct(recPtr Record, idx uint8) (n uint64, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.ApproxDistinct(recPtr, idx)
+	}
+	if !db.sketched(recPtr) {
+		return 0, fmt.Errorf("record type %s is not listed in Options.Sketches", recPtr.Name())
+	}
+	if count := recPtr.IndexCount(); idx >= count {
+		return 0, fmt.Errorf("index %d too large, must be less than %d", idx, count)
+	}
+	err = db.view(func(tx *bbolt.Tx) error {
+		const m = 1 << sketchPrecision
+		var sum float64
+		zeros := m
+		if bck, _ := sketchBucket(tx, recPtr.Name(), idx, false); bck != nil {
+			bck.ForEach(func(k, v []byte) error {
+				sum += math.Ldexp(1, -int(v[0]))
+				zeros--
+				return nil
+			})
+		}
+		sum += float64(zeros)
+		est := 0.7213 / (1 + 1.079/m) * m * m / sum
+		if est <= 2.5*m && zeros > 0 {
+			// Linear counting is more accurate for small cardinalities
+			est = m * math.Log(float64(m)/float64(zeros))
+		}
+		n = uint64(est + 0.5)
+		return nil
+	})
+	return
+}
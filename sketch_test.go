@@ -0,0 +1,51 @@
+package pinion_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/piniondb/pinion"
+)
+
+// Test that distinct key estimates are built for existing records and kept
+// current as records are added.
+func TestDB_ApproxDistinct(t *testing.T) {
+	const fileStr = "example/sketch.db"
+	opt := pinion.Options{Sketches: []pinion.Record{&quantityType{}}}
+	db, err := quantityDB(fileStr, 1, 20000)
+	if err == nil {
+		db.Close()
+		db, err = pinion.Open(fileStr, 0600, opt)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check := func(want float64) {
+		for idx := uint8(0); idx < idxQuantityCount; idx++ {
+			n, err := db.ApproxDistinct(&quantityType{}, idx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(float64(n)-want)/want > 0.05 {
+				t.Fatalf("index %d: estimated %d distinct keys, want about %.0f", idx, n, want)
+			}
+		}
+	}
+	check(20000)
+	var q quantityType
+	id := uint32(20000)
+	err = db.Put(&q, func() bool {
+		id++
+		q = quantityRec(id)
+		return id <= 30000
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(30000)
+	_, err = db.ApproxDistinct(&personType{}, 0)
+	if err == nil {
+		t.Fatal("expected error for type without sketches")
+	}
+}
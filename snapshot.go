@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrNotSnapshot is reported when Refresh is called for a database that was
+// not opened with OpenSnapshot
+var ErrNotSnapshot = errors.New("database is not a snapshot")
+
+// snapshotType holds the details of a database opened with OpenSnapshot
+type snapshotType struct {
+	src  string      // Path of source database
+	path string      // Path of temporary copy; protected by DB.mu
+	mode os.FileMode // Permissions of temporary copy
+	// users counts the callers of DB.acquire that have not yet released the
+	// current copy; protected by DB.mu
+	users *sync.WaitGroup
+}
+
+// registry tracks the databases open in this process by absolute path. It
+// allows a snapshot of a database that is open for writing to be copied
+// within a transaction rather than from the file directly.
+var registry = struct {
+	sync.Mutex
+	dbs map[string]*DB
+}{dbs: make(map[string]*DB)}
+
+// register records db as open at path.
+func register(db *DB, path string) {
+	var err error
+	db.path, err = filepath.Abs(path)
+	if err == nil {
+		registry.Lock()
+		registry.dbs[db.path] = db
+		registry.Unlock()
+	}
+}
+
+// unregister removes db from the registry of open databases.
+func unregister(db *DB) {
+	registry.Lock()
+	if registry.dbs[db.path] == db {
+		delete(registry.dbs, db.path)
+	}
+	registry.Unlock()
+}
+
+// snapshotCopy copies the database at src to a new temporary file and returns
+// the file's path. If the source database is open in this process, the copy
+// is made in a read transaction and is consistent even while records are being
+// written. Otherwise, the file is copied directly; in this case, no other
+// process should be writing to the database.
+func snapshotCopy(src string, mode os.FileMode) (dst string, err error) {
+	var fl, srcFl *os.File
+	var live *DB
+	src, err = filepath.Abs(src)
+	if err == nil {
+		registry.Lock()
+		live = registry.dbs[src]
+		registry.Unlock()
+		fl, err = os.CreateTemp("", "pinion-snapshot-*.db")
+	}
+	if err == nil {
+		dst = fl.Name()
+		if live != nil {
+			err = live.view(func(tx *bbolt.Tx) (err error) {
+				_, err = tx.WriteTo(fl)
+				return
+			})
+		} else {
+			srcFl, err = os.Open(src)
+			if err == nil {
+				_, err = io.Copy(fl, srcFl)
+				srcFl.Close()
+			}
+		}
+		if err == nil {
+			err = fl.Chmod(mode)
+		}
+		closeErr := fl.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(dst)
+			dst = ""
+		}
+	}
+	return
+}
+
+// OpenSnapshot opens a frozen, read-only copy of the database at path. This
+// allows heavy analytical reads to be isolated from the application that
+// writes to the database. The copy is made to a temporary file that is removed
+// when the snapshot is closed. Call Refresh to replace the copy with a newer
+// one.
+//
+// If the source database is open in this process, the copy is consistent even
+// while records are being written to it. Otherwise, the source file is copied
+// directly and must not be open for writing in another process.
+func OpenSnapshot(path string, mode os.FileMode, options Options) (db *DB, err error) {
+	var tmpPath string
+	if exists(path) {
+		tmpPath, err = snapshotCopy(path, mode)
+		if err == nil {
+			options.BoltOpt.ReadOnly = true
+			db, err = open(tmpPath, mode, options)
+			if err == nil {
+				db.snap = &snapshotType{src: path, path: tmpPath, mode: mode, users: new(sync.WaitGroup)}
+			} else {
+				os.Remove(tmpPath)
+			}
+		}
+	} else {
+		err = errNotExist(path)
+	}
+	return
+}
+
+// Refresh atomically replaces the contents of a snapshot with a newer copy of
+// its source database, including its header. Reads that are in progress
+// complete against the previous copy, which is closed once they have ended.
+// ErrNotSnapshot is returned if db was not opened with OpenSnapshot.
+func (db *DB) Refresh() (err error) {
+	var tmpPath, oldPath string
+	var bdb, old *bbolt.DB
+	var users *sync.WaitGroup
+	var hdr Header
+	if db.snap == nil {
+		return ErrNotSnapshot
+	}
+	tmpPath, err = snapshotCopy(db.snap.src, db.snap.mode)
+	if err == nil {
+		opt := db.opt.BoltOpt
+		opt.ReadOnly = true
+		bdb, err = bbolt.Open(tmpPath, db.snap.mode, &opt)
+		if err == nil {
+			err = bdb.View(func(tx *bbolt.Tx) (err error) {
+				if data := headerGet(tx); data != nil {
+					err = hdr.UnmarshalBinary(data)
+				}
+				return
+			})
+			if err == nil {
+				db.mu.Lock()
+				old, oldPath, users = db.boltDB, db.snap.path, db.snap.users
+				if old != nil {
+					db.boltDB, db.snap.path, db.hdr = bdb, tmpPath, hdr
+					db.snap.users = new(sync.WaitGroup)
+				}
+				db.mu.Unlock()
+			}
+			if old != nil {
+				// Wait for the callers that obtained the previous copy
+				users.Wait()
+				old.Close()
+				os.Remove(oldPath)
+			} else {
+				if err == nil {
+					err = ErrNotOpen
+				}
+				bdb.Close()
+			}
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}
+	return
+}
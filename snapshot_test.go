@@ -0,0 +1,113 @@
+package pinion_test
+
+import (
+	"testing"
+
+	"github.com/piniondb/pinion"
+)
+
+// quantityCount returns the number of quantity records in db.
+func quantityCount(db *pinion.DB) (count int, err error) {
+	var q quantityType
+	err = db.Get(&q, idxQuantityID, func() bool {
+		count++
+		return true
+	})
+	return
+}
+
+// Test snapshot isolation and refresh
+func TestDB_Snapshot(t *testing.T) {
+	var db, snap *pinion.DB
+	var err error
+	var count int
+	const fileStr = "example/snapshot.db"
+	check := func(want int) {
+		if err == nil {
+			count, err = quantityCount(snap)
+			if err == nil && count != want {
+				t.Fatalf("expecting %d records in snapshot, got %d", want, count)
+			}
+		}
+	}
+	db, err = quantityDB(fileStr, 1, 3)
+	if err == nil {
+		snap, err = pinion.OpenSnapshot(fileStr, 0600, pinion.Options{})
+		if err == nil {
+			q := quantityRec(4)
+			err = db.PutRec(&q)
+			check(3)
+			if err == nil {
+				err = snap.Refresh()
+			}
+			check(4)
+			if err == nil {
+				if snap.PutRec(&q) == nil {
+					t.Fatalf("snapshot should not be writeable")
+				}
+				if db.Refresh() != pinion.ErrNotSnapshot {
+					t.Fatalf("expecting ErrNotSnapshot")
+				}
+			}
+			snap.Close()
+		}
+		db.Close()
+	}
+	if err == nil {
+		// Copy the file directly now that it is closed
+		snap, err = pinion.OpenSnapshot(fileStr, 0600, pinion.Options{})
+		if err == nil {
+			check(4)
+			snap.Close()
+			if snap.Refresh() != pinion.ErrNotOpen {
+				t.Fatalf("expecting ErrNotOpen when refreshing closed snapshot")
+			}
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test that reads made while a snapshot is refreshed succeed
+func TestDB_SnapshotRefreshReads(t *testing.T) {
+	const fileStr = "example/snapshot_reads.db"
+	db, err := quantityDB(fileStr, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	snap, err := pinion.OpenSnapshot(fileStr, 0600, pinion.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	// Refresh repeatedly until every reader has made its reads
+	errs := make(chan error)
+	const readers = 4
+	for j := 0; j < readers; j++ {
+		go func() {
+			var err error
+			for k := 0; k < 100 && err == nil; k++ {
+				_, err = quantityCount(snap)
+			}
+			errs <- err
+		}()
+	}
+	for finished := 0; finished < readers; {
+		select {
+		case readErr := <-errs:
+			if readErr != nil {
+				t.Fatalf("read during refresh: %v", readErr)
+			}
+			finished++
+		default:
+			if err == nil {
+				err = snap.Refresh()
+			}
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"math/rand"
+	"sync"
+
+	"go.etcd.io/bbolt"
+)
+
+// SoakOptions configures a run of Soak. Zero values are replaced with
+// reasonable defaults.
+type SoakOptions struct {
+	// Workers is the number of goroutines that operate on the database
+	// concurrently (default 4).
+	Workers int
+	// Ops is the number of operations performed by each worker (default 1000).
+	Ops int
+	// CheckEvery is the number of operations a worker performs between
+	// invariant checks (default 100).
+	CheckEvery int
+	// Seed initializes the pseudo-random sequence of each worker so that a
+	// failing run can be repeated.
+	Seed int64
+}
+
+// Soak is a torture test that applications can run against their own record
+// types before putting them into production. Several goroutines perform a
+// random mix of Add, Put, Delete and Get operations, and periodically verify
+// that every stored record survives an unmarshal/marshal roundtrip and that
+// all indexes agree with the stored data. This tends to expose key-building
+// logic that depends on fields that are not marshalled, and marshalling code
+// that is not the exact inverse of its unmarshalling counterpart.
+//
+// gen is called to populate rec with a random record. It is called
+// concurrently by the workers, each of which has its own record obtained by
+// calling recPtr.New() and its own random source. The first error encountered
+// stops the run and is returned. Soak is intended to be used with a scratch
+// database; it leaves the records it has written in place.
+func (db *DB) Soak(recPtr Record, gen func(rnd *rand.Rand, rec Record), opt SoakOptions) (err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.Soak(recPtr, gen, opt)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	// Create the record type's buckets so that early Get and Delete operations
+	// do not fail on a fresh database
+	err = db.update(func(tx *bbolt.Tx) (err error) {
+		_, err = bucketGet(recPtr, recPtr.IndexCount(), true, tx)
+		return
+	})
+	if err != nil {
+		return
+	}
+	if opt.Workers <= 0 {
+		opt.Workers = 4
+	}
+	if opt.Ops <= 0 {
+		opt.Ops = 1000
+	}
+	if opt.CheckEvery <= 0 {
+		opt.CheckEvery = 100
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return err != nil
+	}
+	fail := func(e error) {
+		mu.Lock()
+		if err == nil {
+			err = e
+		}
+		mu.Unlock()
+	}
+	for w := 0; w < opt.Workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			var e error
+			rec := recPtr.New()
+			rnd := rand.New(rand.NewSource(opt.Seed + int64(w)))
+			for j := 1; j <= opt.Ops && e == nil && !failed(); j++ {
+				gen(rnd, rec)
+				switch op := rnd.Intn(100); {
+				case op < 40:
+					e = db.PutRec(rec)
+				case op < 55:
+					e = db.AddRec(rec)
+				case op < 75:
+					e = db.DeleteRec(rec)
+				default:
+					e = db.GetRec(rec, uint8(rnd.Intn(int(rec.IndexCount()))))
+					if e == ErrRecNotFound {
+						e = nil
+					}
+				}
+				if e == nil && j%opt.CheckEvery == 0 {
+					e = db.Check(rec)
+				}
+			}
+			if e != nil {
+				fail(e)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err == nil {
+		err = db.Check(recPtr)
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package pinion_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// lossyQuantityType drops its English word field when unmarshalled. Its
+// secondary index is therefore built from a field that does not survive the
+// trip to storage.
+type lossyQuantityType struct {
+	quantityType
+}
+
+func (l *lossyQuantityType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint32(&l.id)
+	return get.Done()
+}
+
+func (l lossyQuantityType) New() pinion.Record {
+	return new(lossyQuantityType)
+}
+
+func genQuantity(rnd *rand.Rand, rec pinion.Record) {
+	switch q := rec.(type) {
+	case *quantityType:
+		*q = quantityRec(uint32(rnd.Intn(500)))
+	case *lossyQuantityType:
+		q.quantityType = quantityRec(uint32(rnd.Intn(500)))
+	}
+}
+
+// Test soak harness against well-behaved and defective record types
+func TestDB_Soak(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	const fileStr = "example/soak.db"
+	db, err = pinion.Create(fileStr, 0600, pinion.Options{})
+	if err == nil {
+		err = db.Soak(&quantityType{}, genQuantity, pinion.SoakOptions{Ops: 500, Seed: 42})
+		if err == nil {
+			err = db.Soak(&lossyQuantityType{}, genQuantity, pinion.SoakOptions{Ops: 100})
+			if err == nil {
+				t.Fatalf("soak should have detected lossy marshalling")
+			} else {
+				err = nil
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
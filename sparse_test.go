@@ -0,0 +1,105 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// memberType is a record with an optional email address that is indexed only
+// when it is assigned.
+type memberType struct {
+	id    uint32
+	name  string
+	email string
+}
+
+func (m memberType) MarshalBinary() ([]byte, error) {
+	var put store.PutBuffer
+	put.Uint32(m.id)
+	put.Str(m.name)
+	put.Str(m.email)
+	return put.Data()
+}
+
+func (m *memberType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint32(&m.id)
+	get.Str(&m.name)
+	get.Str(&m.email)
+	return get.Done()
+}
+
+func (m memberType) Name() string {
+	return "member"
+}
+
+func (m memberType) IndexCount() uint8 {
+	return 2
+}
+
+func (m memberType) New() pinion.Record {
+	return new(memberType)
+}
+
+func (m *memberType) NextID(id uint64) {
+	m.id = uint32(id)
+}
+
+func (m memberType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	switch idx {
+	case 0:
+		kb.Uint32(m.id)
+	case 1:
+		if m.email == "" {
+			return nil, nil
+		}
+		kb.Str(m.email, 24)
+	}
+	return kb.Data()
+}
+
+// This example demonstrates a secondary index that holds entries only for
+// records that have an email address.
+func ExampleRecord_sparse() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/sparse.db", 0600, pinion.Options{})
+	if err == nil {
+		wdb := db.Wrap()
+		wdb.AddRec(&memberType{name: "Carol", email: "carol@example.com"})
+		wdb.AddRec(&memberType{name: "Robert"})
+		wdb.AddRec(&memberType{name: "Alice", email: "alice@example.com"})
+		show := func() {
+			var m memberType
+			count := 0
+			wdb.GetKeys(&m, 1, func(key, primaryKey []byte) bool {
+				count++
+				return true
+			})
+			fmt.Printf("%d entries:", count)
+			wdb.Get(&m, 1, func() bool {
+				fmt.Printf(" %s", m.name)
+				return true
+			})
+			fmt.Println()
+		}
+		show()
+		wdb.PutRec(&memberType{id: 1, name: "Carol"})
+		wdb.PutRec(&memberType{id: 2, name: "Robert", email: "bob@example.com"})
+		show()
+		err = wdb.Error()
+		if err == nil {
+			err = db.Check(&memberType{})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 2 entries: Alice Carol
+	// 2 entries: Alice Robert
+}
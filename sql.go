@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// sqlTypes maps the field types of a Schema to SQL column types.
+var sqlTypes = map[string]string{
+	"uint8": "INTEGER", "uint16": "INTEGER", "uint32": "INTEGER", "uint64": "INTEGER",
+	"int8": "INTEGER", "int16": "INTEGER", "int32": "INTEGER", "int64": "INTEGER",
+	"str": "TEXT", "bytes": "BLOB", "time": "TIMESTAMP", "float64": "REAL",
+	"bool": "BOOLEAN",
+}
+
+// sqlName quotes str for use as an SQL identifier.
+func sqlName(str string) string {
+	return `"` + strings.ReplaceAll(str, `"`, `""`) + `"`
+}
+
+// sqlValue returns the SQL literal of a SchemaRecord field value.
+func sqlValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case []byte:
+		return fmt.Sprintf("X'%X'", v)
+	case time.Time:
+		return "'" + v.UTC().Format("2006-01-02 15:04:05.999999999") + "'"
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return "NULL"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return fmt.Sprint(val)
+}
+
+// ExportSQL writes an SQL script to wr that creates a table for each record
+// type in list and inserts the stored records of the type into it. Each
+// record in list must be a *SchemaRecord, typically one returned by
+// LoadSchemas. The table is named after the type and has a column for each
+// schema field; the fields of index 0 form its primary key and each secondary
+// index becomes an SQL index named type_index. The script uses the dialect of
+// SQLite, so that, for example,
+//
+//	sqlite3 app.sqlite < app.sql
+//
+// produces a database for ad hoc queries that DuckDB can also attach. Values
+// of uint64 fields above the largest int64 are stored by SQLite as REAL, and
+// float64 infinities and NaN are written as NULL. The records of each type
+// are read in a single transaction; a type with no stored records yields an
+// empty table.
+func (db *DB) ExportSQL(wr io.Writer, list []Record) (err error) {
+	bw := bufio.NewWriter(wr)
+	for _, recPtr := range list {
+		rec, ok := recPtr.(*SchemaRecord)
+		if !ok {
+			err = fmt.Errorf("record type %s has no schema", recPtr.Name())
+			break
+		}
+		err = db.exportSQL(bw, rec.New().(*SchemaRecord))
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	return
+}
+
+// exportSQL writes the table definition and records of rec's type to bw.
+func (db *DB) exportSQL(bw *bufio.Writer, rec *SchemaRecord) (err error) {
+	s := rec.schema
+	table := sqlName(s.Name)
+	cols := make([]string, len(s.Fields))
+	for j, f := range s.Fields {
+		cols[j] = sqlName(f.Name)
+	}
+	keyCols := func(idx SchemaIndex) string {
+		list := make([]string, len(idx.Fields))
+		for j, name := range idx.Fields {
+			list[j] = sqlName(name)
+		}
+		return strings.Join(list, ", ")
+	}
+	fmt.Fprintf(bw, "CREATE TABLE %s (\n", table)
+	for j, f := range s.Fields {
+		fmt.Fprintf(bw, "\t%s %s,\n", cols[j], sqlTypes[f.Type])
+	}
+	fmt.Fprintf(bw, "\tPRIMARY KEY (%s)\n);\n", keyCols(s.Indexes[0]))
+	for j := 1; j < len(s.Indexes); j++ {
+		name := rec.IndexName(uint8(j))
+		if name == "" {
+			name = strconv.Itoa(j)
+		}
+		fmt.Fprintf(bw, "CREATE INDEX %s ON %s (%s);\n",
+			sqlName(s.Name+"_"+name), table, keyCols(s.Indexes[j]))
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (", table, strings.Join(cols, ", "))
+	vals := make([]string, len(s.Fields))
+	fmt.Fprintln(bw, "BEGIN;")
+	var wrErr error
+	var stored bool
+	err = db.owner(rec).view(func(tx *bbolt.Tx) error {
+		stored = tx.Bucket([]byte(s.Name)) != nil
+		return nil
+	})
+	if err == nil && stored {
+		err = db.scan(rec, &scanType{from: []byte{}}, func() bool {
+			for j, val := range rec.vals {
+				vals[j] = sqlValue(val)
+			}
+			_, wrErr = fmt.Fprintf(bw, "%s%s);\n", insert, strings.Join(vals, ", "))
+			return wrErr == nil
+		})
+	}
+	if err == nil {
+		err = wrErr
+	}
+	if err == nil {
+		_, err = fmt.Fprintln(bw, "COMMIT;")
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package pinion_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/piniondb/pinion"
+)
+
+const staffSchema = `[{
+	"name": "staff",
+	"fields": [
+		{"name": "id", "type": "uint32"},
+		{"name": "name", "type": "str"},
+		{"name": "badge", "type": "bytes"}
+	],
+	"indexes": [
+		{"name": "ID", "fields": ["id"]},
+		{"name": "Name", "fields": ["name"], "widths": [16]}
+	],
+	"id": "id"
+}]`
+
+// This example demonstrates the export of records described by a schema as
+// an SQL script.
+func ExampleDB_ExportSQL() {
+	var db *pinion.DB
+	var list []pinion.Record
+	var err error
+	list, err = pinion.LoadSchemas(strings.NewReader(staffSchema))
+	if err == nil {
+		db, err = pinion.Create("example/sql.db", 0600, pinion.Options{Records: list})
+	}
+	if err == nil {
+		for _, name := range []string{"Dana O'Brien", "Ali"} {
+			rec := list[0].New().(*pinion.SchemaRecord)
+			err = rec.SetField("name", name)
+			if err == nil {
+				err = rec.SetField("badge", []byte(name[:2]))
+			}
+			if err == nil {
+				err = db.AddRec(rec)
+			}
+		}
+		if err == nil {
+			err = db.ExportSQL(os.Stdout, list)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// CREATE TABLE "staff" (
+	// 	"id" INTEGER,
+	// 	"name" TEXT,
+	// 	"badge" BLOB,
+	// 	PRIMARY KEY ("id")
+	// );
+	// CREATE INDEX "staff_Name" ON "staff" ("name");
+	// BEGIN;
+	// INSERT INTO "staff" ("id", "name", "badge") VALUES (1, 'Dana O''Brien', X'4461');
+	// INSERT INTO "staff" ("id", "name", "badge") VALUES (2, 'Ali', X'416C');
+	// COMMIT;
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"go.etcd.io/bbolt"
+)
+
+// TypeStats describes the stored records of a record type.
+type TypeStats struct {
+	Name         string   // Name of the record type
+	Records      int      // Stored records
+	KeyBytes     int      // Total size of the primary keys
+	ValueBytes   int      // Total size of the record data
+	IndexEntries int      // Entries in the secondary indexes
+	IndexBytes   int      // Total size of the keys and values of those entries
+	Pages        int      // Pages, including overflow pages, used by the type
+	Fill         float64  // Percentage of the bytes of those pages in use
+	Sizes        []uint64 // Histogram of record sizes; see SizeHistogram
+}
+
+// Stats describes the contents of a database. See DB.Stats.
+type Stats struct {
+	// Types describes each record type that has been stored in the database,
+	// in order of name.
+	Types []TypeStats
+	// Size is the size in bytes of the database as seen by the transaction
+	// in which the statistics were gathered.
+	Size int64
+	// Bolt holds bbolt's statistics of free pages and of the transactions
+	// run on the database, such as the number of pages written and the time
+	// spent writing them.
+	Bolt bbolt.Stats
+}
+
+// typeStats gathers the statistics of the type whose bucket is bck.
+func typeStats(nameStr string, bck *bbolt.Bucket) (ts TypeStats) {
+	ts.Name = nameStr
+	bst := bck.Stats()
+	ts.Pages = bst.BranchPageN + bst.BranchOverflowN + bst.LeafPageN + bst.LeafOverflowN
+	if alloc := bst.BranchAlloc + bst.LeafAlloc; alloc > 0 {
+		ts.Fill = 100 * float64(bst.BranchInuse+bst.LeafInuse) / float64(alloc)
+	}
+	if idx := bck.Bucket([]byte{0}); idx != nil {
+		idx.ForEach(func(k, v []byte) error {
+			ts.Records++
+			ts.KeyBytes += len(k)
+			ts.ValueBytes += len(v)
+			return nil
+		})
+	}
+	for j := 1; j < 256; j++ {
+		if idx := bck.Bucket([]byte{byte(j)}); idx != nil {
+			idx.ForEach(func(k, v []byte) error {
+				ts.IndexEntries++
+				ts.IndexBytes += len(k) + len(v)
+				return nil
+			})
+		}
+	}
+	return
+}
+
+// Stats reports the number and size of the stored records and index entries
+// of each record type, the distribution of record sizes, how densely their pages are filled, and bbolt's
+// statistics of the database. It is intended for dashboards and capacity
+// planning. A low fill percentage is typical of a type whose records have
+// been written in random key order or largely deleted. Every record and index entry is visited in a single read transaction, so
+// gathering the statistics of a large database takes a while. Only the
+// records of db itself are described, not those of attached databases.
+func (db *DB) Stats() (st Stats, err error) {
+	err = db.view(func(tx *bbolt.Tx) error {
+		st.Size = tx.Size()
+		return tx.ForEach(func(name []byte, bck *bbolt.Bucket) error {
+			if string(name) != metaBucketName {
+				ts := typeStats(string(name), bck)
+				ts.Sizes = sizeGet(tx, ts.Name)
+				st.Types = append(st.Types, ts)
+			}
+			return nil
+		})
+	})
+	if err == nil {
+		bdb, release := db.acquire()
+		if bdb != nil {
+			st.Bolt = bdb.Stats()
+		}
+		release()
+	}
+	return
+}
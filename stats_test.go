@@ -0,0 +1,43 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example reports the records stored of each type.
+func ExampleDB_Stats() {
+	var db *pinion.DB
+	var err error
+	var st pinion.Stats
+	db, err = pinion.Create("example/stats.db", 0600, pinion.Options{})
+	if err == nil {
+		wdb := db.Wrap()
+		for id := uint32(1); id <= 100; id++ {
+			q := quantityRec(id)
+			wdb.PutRec(&q)
+		}
+		n := noteType{Title: "Groceries"}
+		wdb.AddRec(&n)
+		err = wdb.Error()
+		if err == nil {
+			st, err = db.Stats()
+		}
+		if err == nil {
+			for _, ts := range st.Types {
+				fmt.Println(ts.Name, ts.Records, ts.IndexEntries, ts.Pages > 0,
+					ts.Fill > 0 && ts.Fill <= 100)
+			}
+			fmt.Println(st.Size > 0, st.Bolt.TxStats.Write > 0)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// note 1 0 true true
+	// quantity 100 100 true true
+	// true true
+}
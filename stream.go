@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding"
+
+	"github.com/piniondb/store"
+	"go.etcd.io/bbolt"
+)
+
+// EventState is implemented by the state that an EventStream folds from its
+// events. Its MarshalBinary and UnmarshalBinary methods store and restore the
+// state in snapshots.
+type EventState interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	// Apply folds the event with sequence number seq into the state. data
+	// is the event as passed to Append.
+	Apply(seq uint64, data []byte) error
+}
+
+// EventStream is an append-only sequence of events stored as records of a
+// type with the stream's name. Each event is assigned the next sequence
+// number, starting with one, and can never be replaced or deleted except with
+// ForceDelete. The current state is obtained by folding the events, in
+// order, into an EventState. To keep that from growing more expensive as
+// events accumulate, the stream can store snapshots of the state, as records
+// of a second type, every n events; State then begins with the most recent
+// snapshot.
+type EventStream struct {
+	db       *DB
+	name     string
+	every    uint64
+	newState func() EventState
+}
+
+// streamEventType is the record type of the events of a stream.
+type streamEventType struct {
+	name string
+	seq  uint64
+	data []byte
+}
+
+func (e streamEventType) MarshalBinary() ([]byte, error) {
+	var put store.PutBuffer
+	put.Uint64(e.seq)
+	put.Bytes(e.data)
+	return put.Data()
+}
+
+func (e *streamEventType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint64(&e.seq)
+	get.Bytes(&e.data)
+	return get.Done()
+}
+
+func (e streamEventType) Name() string {
+	return e.name
+}
+
+func (e streamEventType) IndexCount() uint8 {
+	return 1
+}
+
+func (e streamEventType) New() Record {
+	return &streamEventType{name: e.name}
+}
+
+func (e *streamEventType) NextID(id uint64) {
+	e.seq = id
+}
+
+func (e streamEventType) Key(idx uint8) ([]byte, error) {
+	var kb store.KeyBuffer
+	kb.Uint64(e.seq)
+	return kb.Data()
+}
+
+// Immutable implements the Immutable interface.
+func (e streamEventType) Immutable() bool {
+	return true
+}
+
+// streamSnapshotType is the record type of the state snapshots of a stream.
+// It has the layout of streamEventType, with seq holding the sequence number
+// of the last event folded into the state.
+type streamSnapshotType struct {
+	streamEventType
+}
+
+func (s streamSnapshotType) Name() string {
+	return s.name + ".snapshot"
+}
+
+func (s streamSnapshotType) New() Record {
+	return &streamSnapshotType{streamEventType{name: s.name}}
+}
+
+func (s streamSnapshotType) Immutable() bool {
+	return false
+}
+
+// NewEventStream returns the event stream named name in db. The events are
+// stored as records of a type with that name, which must not be used by any
+// other record type.
+func NewEventStream(db *DB, name string) *EventStream {
+	return &EventStream{db: db, name: name}
+}
+
+// SnapshotEvery arranges for the state of the stream to be stored whenever an
+// event whose sequence number is a multiple of n is appended. newState
+// returns an empty state into which the events are folded when no earlier
+// snapshot exists. A value of zero for n stops the taking of snapshots.
+func (es *EventStream) SnapshotEvery(n uint64, newState func() EventState) {
+	es.every, es.newState = n, newState
+}
+
+// typeStored reports whether records of the type named nameStr are stored.
+func typeStored(db *DB, nameStr string) (ok bool, err error) {
+	err = db.view(func(tx *bbolt.Tx) error {
+		ok = tx.Bucket([]byte(nameStr)) != nil
+		return nil
+	})
+	return
+}
+
+// Append stores the encoded event data as the next event of the stream and
+// returns its sequence number. If a snapshot is due, it is taken in the same
+// transaction.
+func (es *EventStream) Append(data []byte) (seq uint64, err error) {
+	err = es.db.Update(func(tx *Tx) (err error) {
+		ev := streamEventType{name: es.name, data: data}
+		err = tx.AddRec(&ev)
+		if err == nil {
+			seq = ev.seq
+			if es.every > 0 && seq%es.every == 0 {
+				st := es.newState()
+				snap := streamSnapshotType{streamEventType{name: es.name}}
+				snap.seq, err = es.fold(tx.db, st)
+				if err == nil {
+					snap.data, err = st.MarshalBinary()
+				}
+				if err == nil {
+					err = tx.PutRec(&snap)
+				}
+			}
+		}
+		return
+	})
+	if err != nil {
+		seq = 0
+	}
+	return
+}
+
+// Replay calls f with the sequence number and data of each event of the
+// stream, in order, beginning with event from. The iteration stops when f
+// returns false. The data slice is valid only for the duration of the call.
+func (es *EventStream) Replay(from uint64, f func(seq uint64, data []byte) bool) error {
+	return es.replay(es.db, from, f)
+}
+
+// replay is the worker for Replay; db may be bound to a transaction.
+func (es *EventStream) replay(db *DB, from uint64, f func(seq uint64, data []byte) bool) (err error) {
+	var ok bool
+	ok, err = typeStored(db, es.name)
+	if err == nil && ok {
+		ev := streamEventType{name: es.name, seq: from}
+		err = db.Get(&ev, 0, func() bool {
+			return f(ev.seq, ev.data)
+		})
+	}
+	return
+}
+
+// fold restores the most recent snapshot into st, if there is one, and folds
+// the subsequent events into it. The sequence number of the last event folded
+// into st is returned.
+func (es *EventStream) fold(db *DB, st EventState) (seq uint64, err error) {
+	var ok bool
+	var snap streamSnapshotType
+	snap.name = es.name
+	ok, err = typeStored(db, snap.Name())
+	if err == nil && ok {
+		err = db.LastRec(&snap, 0)
+		if err == nil {
+			err = st.UnmarshalBinary(snap.data)
+		}
+	}
+	if err == nil {
+		var applyErr error
+		err = es.replay(db, snap.seq+1, func(seq uint64, data []byte) bool {
+			applyErr = st.Apply(seq, data)
+			snap.seq = seq
+			return applyErr == nil
+		})
+		if err == nil {
+			err = applyErr
+		}
+	}
+	if err == nil {
+		seq = snap.seq
+	}
+	return
+}
+
+// State folds the events of the stream into st, which must be empty,
+// beginning with the most recent snapshot if there is one. The sequence
+// number of the last event folded into st is returned; it is zero if the
+// stream has no events. Everything is read in a single transaction.
+func (es *EventStream) State(st EventState) (seq uint64, err error) {
+	err = es.db.View(func(tx *Tx) (err error) {
+		seq, err = es.fold(tx.db, st)
+		return
+	})
+	return
+}
@@ -0,0 +1,70 @@
+package pinion_test
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/piniondb/pinion"
+)
+
+// balanceType is the state of an account whose events are signed amounts.
+// applied counts the events folded into the state since it was restored;
+// it is not stored.
+type balanceType struct {
+	balance int64
+	applied int
+}
+
+func (b balanceType) MarshalBinary() ([]byte, error) {
+	return []byte(strconv.FormatInt(b.balance, 10)), nil
+}
+
+func (b *balanceType) UnmarshalBinary(data []byte) (err error) {
+	b.balance, err = strconv.ParseInt(string(data), 10, 64)
+	return
+}
+
+// Apply implements the pinion.EventState interface
+func (b *balanceType) Apply(seq uint64, data []byte) error {
+	amt, err := strconv.ParseInt(string(data), 10, 64)
+	b.balance += amt
+	b.applied++
+	return err
+}
+
+// This example demonstrates an event stream whose state is snapshotted every
+// two events.
+func ExampleEventStream() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/stream.db", 0600, pinion.Options{})
+	if err == nil {
+		es := pinion.NewEventStream(db, "account")
+		es.SnapshotEvery(2, func() pinion.EventState { return new(balanceType) })
+		for _, amt := range []string{"100", "-30", "+5", "-25", "40"} {
+			if err == nil {
+				_, err = es.Append([]byte(amt))
+			}
+		}
+		if err == nil {
+			var seq uint64
+			var st balanceType
+			seq, err = es.State(&st)
+			fmt.Printf("balance %d after event %d, %d event applied\n", st.balance, seq, st.applied)
+		}
+		if err == nil {
+			err = es.Replay(4, func(seq uint64, data []byte) bool {
+				fmt.Printf("event %d: %s\n", seq, data)
+				return true
+			})
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// balance 90 after event 5, 1 event applied
+	// event 4: -25
+	// event 5: 40
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// TagPutBuffer packs record fields that are each identified by a numeric tag.
+// Its counterpart, TagGetBuffer, extracts fields by tag rather than by
+// position. Consequently, fields can be added to a record type without
+// breaking the UnmarshalBinary method for values stored by earlier versions of
+// the application: fields missing from a stored value are zeroed, and stored
+// fields whose tags are no longer read are ignored. A tag must not be reused
+// for a field of a different type.
+//
+// Each field is stored with its tag and length, so values are somewhat larger
+// than those packed with the piniondb/store package.
+type TagPutBuffer struct {
+	buf  []byte
+	tags map[uint64]bool
+	err  error
+}
+
+// appendUvarint appends the variable-length encoding of val to sl.
+func appendUvarint(sl []byte, val uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(sl, buf[:binary.PutUvarint(buf[:], val)]...)
+}
+
+// appendVarint appends the variable-length encoding of val to sl.
+func appendVarint(sl []byte, val int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(sl, buf[:binary.PutVarint(buf[:], val)]...)
+}
+
+// field appends the tagged field value to the buffer.
+func (put *TagPutBuffer) field(tag uint64, val []byte) {
+	if put.err == nil {
+		if put.tags == nil {
+			put.tags = make(map[uint64]bool)
+		}
+		if put.tags[tag] {
+			put.err = fmt.Errorf("tag %d is used more than once", tag)
+		} else {
+			put.tags[tag] = true
+			put.buf = appendUvarint(put.buf, tag)
+			put.buf = appendUvarint(put.buf, uint64(len(val)))
+			put.buf = append(put.buf, val...)
+		}
+	}
+}
+
+// Uint64 packs val into the field identified by tag.
+func (put *TagPutBuffer) Uint64(tag uint64, val uint64) {
+	put.field(tag, appendUvarint(nil, val))
+}
+
+// Int64 packs val into the field identified by tag.
+func (put *TagPutBuffer) Int64(tag uint64, val int64) {
+	put.field(tag, appendVarint(nil, val))
+}
+
+// Uint32 packs val into the field identified by tag.
+func (put *TagPutBuffer) Uint32(tag uint64, val uint32) {
+	put.Uint64(tag, uint64(val))
+}
+
+// Int32 packs val into the field identified by tag.
+func (put *TagPutBuffer) Int32(tag uint64, val int32) {
+	put.Int64(tag, int64(val))
+}
+
+// Float64 packs val into the field identified by tag.
+func (put *TagPutBuffer) Float64(tag uint64, val float64) {
+	put.Uint64(tag, math.Float64bits(val))
+}
+
+// Bool packs val into the field identified by tag.
+func (put *TagPutBuffer) Bool(tag uint64, val bool) {
+	if val {
+		put.Uint64(tag, 1)
+	} else {
+		put.Uint64(tag, 0)
+	}
+}
+
+// Time packs tm into the field identified by tag.
+func (put *TagPutBuffer) Time(tag uint64, tm time.Time) {
+	sl, err := tm.MarshalBinary()
+	if err == nil {
+		put.field(tag, sl)
+	} else {
+		put.SetError(err)
+	}
+}
+
+// Str packs str into the field identified by tag.
+func (put *TagPutBuffer) Str(tag uint64, str string) {
+	put.field(tag, []byte(str))
+}
+
+// Bytes packs sl into the field identified by tag.
+func (put *TagPutBuffer) Bytes(tag uint64, sl []byte) {
+	put.field(tag, sl)
+}
+
+// SetError sets the buffer's internal error value if it is not already set.
+// If err is nil, it is ignored.
+func (put *TagPutBuffer) SetError(err error) {
+	if put.err == nil && err != nil {
+		put.err = err
+	}
+}
+
+// Error returns the buffer's internal error value.
+func (put *TagPutBuffer) Error() error {
+	return put.err
+}
+
+// Data returns the packed fields and the buffer's internal error value.
+func (put *TagPutBuffer) Data() ([]byte, error) {
+	if put.err != nil {
+		return nil, put.err
+	}
+	return put.buf, nil
+}
+
+// errTagCorrupt is reported when a tagged value cannot be parsed
+var errTagCorrupt = errors.New("corrupt tagged field data")
+
+// TagGetBuffer extracts fields from a value packed by TagPutBuffer.
+type TagGetBuffer struct {
+	fields map[uint64][]byte
+	err    error
+}
+
+// NewTagGetBuffer returns a buffer from which the tagged fields in data can
+// be extracted.
+func NewTagGetBuffer(data []byte) (get *TagGetBuffer) {
+	var tag, size uint64
+	var n int
+	get = new(TagGetBuffer)
+	get.fields = make(map[uint64][]byte)
+	for len(data) > 0 && get.err == nil {
+		tag, n = binary.Uvarint(data)
+		if n > 0 {
+			data = data[n:]
+			size, n = binary.Uvarint(data)
+		}
+		if n > 0 && size <= uint64(len(data)-n) {
+			data = data[n:]
+			get.fields[tag] = data[:size]
+			data = data[size:]
+		} else {
+			get.err = errTagCorrupt
+		}
+	}
+	return
+}
+
+// Has returns true if the field identified by tag is present.
+func (get *TagGetBuffer) Has(tag uint64) (ok bool) {
+	_, ok = get.fields[tag]
+	return
+}
+
+// uvarint returns the unsigned integer stored in the field identified by
+// tag, or zero if the field is not present.
+func (get *TagGetBuffer) uvarint(tag uint64) (val uint64) {
+	if get.err == nil {
+		sl, ok := get.fields[tag]
+		if ok {
+			var n int
+			val, n = binary.Uvarint(sl)
+			if n != len(sl) {
+				get.err = fmt.Errorf("tag %d: %s", tag, errTagCorrupt)
+			}
+		}
+	}
+	return
+}
+
+// Uint64 extracts the field identified by tag into the variable pointed to by
+// val. The variable is zeroed if the field is not present.
+func (get *TagGetBuffer) Uint64(tag uint64, val *uint64) {
+	*val = get.uvarint(tag)
+}
+
+// Int64 extracts the field identified by tag into the variable pointed to by
+// val. The variable is zeroed if the field is not present.
+func (get *TagGetBuffer) Int64(tag uint64, val *int64) {
+	*val = 0
+	if get.err == nil {
+		sl, ok := get.fields[tag]
+		if ok {
+			var n int
+			*val, n = binary.Varint(sl)
+			if n != len(sl) {
+				get.err = fmt.Errorf("tag %d: %s", tag, errTagCorrupt)
+			}
+		}
+	}
+}
+
+// Uint32 extracts the field identified by tag into the variable pointed to by
+// val. The variable is zeroed if the field is not present.
+func (get *TagGetBuffer) Uint32(tag uint64, val *uint32) {
+	v := get.uvarint(tag)
+	if v > math.MaxUint32 {
+		get.SetError(fmt.Errorf("tag %d: value %d overflows uint32", tag, v))
+	}
+	*val = uint32(v)
+}
+
+// Int32 extracts the field identified by tag into the variable pointed to by
+// val. The variable is zeroed if the field is not present.
+func (get *TagGetBuffer) Int32(tag uint64, val *int32) {
+	var v int64
+	get.Int64(tag, &v)
+	if v > math.MaxInt32 || v < math.MinInt32 {
+		get.SetError(fmt.Errorf("tag %d: value %d overflows int32", tag, v))
+	}
+	*val = int32(v)
+}
+
+// Float64 extracts the field identified by tag into the variable pointed to
+// by val. The variable is zeroed if the field is not present.
+func (get *TagGetBuffer) Float64(tag uint64, val *float64) {
+	*val = math.Float64frombits(get.uvarint(tag))
+}
+
+// Bool extracts the field identified by tag into the variable pointed to by
+// val. The variable is set to false if the field is not present.
+func (get *TagGetBuffer) Bool(tag uint64, val *bool) {
+	*val = get.uvarint(tag) != 0
+}
+
+// Time extracts the field identified by tag into the variable pointed to by
+// tm. The variable is zeroed if the field is not present.
+func (get *TagGetBuffer) Time(tag uint64, tm *time.Time) {
+	*tm = time.Time{}
+	if get.err == nil {
+		sl, ok := get.fields[tag]
+		if ok {
+			get.SetError(tm.UnmarshalBinary(sl))
+		}
+	}
+}
+
+// Str extracts the field identified by tag into the variable pointed to by
+// str. The variable is set to an empty string if the field is not present.
+func (get *TagGetBuffer) Str(tag uint64, str *string) {
+	*str = ""
+	if get.err == nil {
+		*str = string(get.fields[tag])
+	}
+}
+
+// Bytes extracts the field identified by tag into the variable pointed to by
+// sl. The variable is set to nil if the field is not present. The extracted
+// slice is a copy and may be retained by the caller.
+func (get *TagGetBuffer) Bytes(tag uint64, sl *[]byte) {
+	*sl = nil
+	if get.err == nil {
+		val, ok := get.fields[tag]
+		if ok {
+			*sl = append([]byte{}, val...)
+		}
+	}
+}
+
+// SetError sets the buffer's internal error value if it is not already set.
+// If err is nil, it is ignored.
+func (get *TagGetBuffer) SetError(err error) {
+	if get.err == nil && err != nil {
+		get.err = err
+	}
+}
+
+// Done returns the buffer's internal error value. It is typically called at
+// the end of an UnmarshalBinary method after all fields have been extracted.
+func (get *TagGetBuffer) Done() error {
+	return get.err
+}
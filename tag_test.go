@@ -0,0 +1,107 @@
+package pinion_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/piniondb/pinion"
+)
+
+// contactV1 and contactV2 are successive versions of a record value. The
+// second version adds a phone number and a timestamp.
+type contactV1 struct {
+	id   uint32
+	name string
+}
+
+type contactV2 struct {
+	id    uint32
+	name  string
+	phone string
+	seen  time.Time
+}
+
+func (c contactV1) MarshalBinary() ([]byte, error) {
+	var put pinion.TagPutBuffer
+	put.Uint32(1, c.id)
+	put.Str(2, c.name)
+	return put.Data()
+}
+
+func (c *contactV1) UnmarshalBinary(data []byte) error {
+	get := pinion.NewTagGetBuffer(data)
+	get.Uint32(1, &c.id)
+	get.Str(2, &c.name)
+	return get.Done()
+}
+
+func (c contactV2) MarshalBinary() ([]byte, error) {
+	var put pinion.TagPutBuffer
+	put.Uint32(1, c.id)
+	put.Str(2, c.name)
+	put.Str(3, c.phone)
+	put.Time(4, c.seen)
+	return put.Data()
+}
+
+func (c *contactV2) UnmarshalBinary(data []byte) error {
+	get := pinion.NewTagGetBuffer(data)
+	get.Uint32(1, &c.id)
+	get.Str(2, &c.name)
+	get.Str(3, &c.phone)
+	get.Time(4, &c.seen)
+	return get.Done()
+}
+
+// Test that tagged values can be read by earlier and later record versions
+func TestTagBuffer(t *testing.T) {
+	var data []byte
+	var err error
+	var v1 contactV1
+	seen := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	v2 := contactV2{id: 7, name: "Carol", phone: "555-0100", seen: seen}
+	data, err = contactV1{id: 3, name: "Robert"}.MarshalBinary()
+	if err == nil {
+		err = v2.UnmarshalBinary(data)
+		if err == nil && (v2.id != 3 || v2.name != "Robert" || v2.phone != "" || !v2.seen.IsZero()) {
+			t.Fatalf("unexpected upgraded value %v", v2)
+		}
+	}
+	if err == nil {
+		v2 = contactV2{id: 7, name: "Carol", phone: "555-0100", seen: seen}
+		data, err = v2.MarshalBinary()
+	}
+	if err == nil {
+		err = v1.UnmarshalBinary(data)
+		if err == nil && (v1.id != 7 || v1.name != "Carol") {
+			t.Fatalf("unexpected downgraded value %v", v1)
+		}
+	}
+	if err == nil {
+		v2 = contactV2{}
+		err = v2.UnmarshalBinary(data)
+		if err == nil && (v2.phone != "555-0100" || !v2.seen.Equal(seen)) {
+			t.Fatalf("unexpected roundtrip value %v", v2)
+		}
+	}
+	if err == nil {
+		err = v1.UnmarshalBinary(data[:len(data)-1])
+		if err == nil {
+			t.Fatalf("truncated value should not have been accepted")
+		}
+		err = nil
+	}
+	if err == nil {
+		var put pinion.TagPutBuffer
+		put.Str(1, "a")
+		put.Str(1, "b")
+		_, err = put.Data()
+		if err == nil {
+			t.Fatalf("duplicate tag should not have been accepted")
+		}
+		err = nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
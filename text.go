@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// TextImporter is an optional interface that a record type can implement to
+// allow it to be populated from a row of text fields. This permits data from
+// legacy systems to be migrated with ImportCSV and ImportFixed without
+// reflection or intermediate structures.
+type TextImporter interface {
+	// Populate the record identified by the method receiver from fields.
+	ImportText(fields []string) error
+}
+
+// TextExporter is an optional interface that a record type can implement to
+// allow it to be written as a row of text fields with ExportCSV and
+// ExportFixed.
+type TextExporter interface {
+	// Return the fields of the record identified by the method receiver.
+	ExportText() []string
+}
+
+// importText is the worker function for the import methods. next is called
+// repeatedly to obtain rows until it returns io.EOF.
+func (db *DB) importText(recPtr Record, next func() ([]string, error)) (err error) {
+	var putErr error
+	var fields []string
+	imp, ok := recPtr.(TextImporter)
+	if !ok {
+		return fmt.Errorf("%s records do not implement TextImporter", recPtr.Name())
+	}
+	putErr = db.Put(recPtr, func() bool {
+		fields, err = next()
+		if err == nil {
+			err = imp.ImportText(fields)
+		}
+		return err == nil
+	})
+	if err == io.EOF {
+		err = nil
+	}
+	if err == nil {
+		err = putErr
+	}
+	return
+}
+
+// exportText is the worker function for the export methods. For each record
+// in the order of index idx, put is called with the record's fields.
+func (db *DB) exportText(recPtr Record, idx uint8, put func([]string) error) (err error) {
+	var getErr error
+	exp, ok := recPtr.(TextExporter)
+	if !ok {
+		return fmt.Errorf("%s records do not implement TextExporter", recPtr.Name())
+	}
+	getErr = db.Get(recPtr, idx, func() bool {
+		err = put(exp.ExportText())
+		return err == nil
+	})
+	if err == nil {
+		err = getErr
+	}
+	return
+}
+
+// ImportCSV reads comma-separated rows from rd and stores them in the
+// database. recPtr must implement TextImporter; its ImportText method is called
+// to populate the record with each row before the record is stored as if by
+// Put(). The requirements documented for Put() apply.
+func (db *DB) ImportCSV(recPtr Record, rd io.Reader) error {
+	cr := csv.NewReader(rd)
+	cr.FieldsPerRecord = -1
+	return db.importText(recPtr, cr.Read)
+}
+
+// ExportCSV writes the records of recPtr's type to wr as comma-separated rows
+// in the order of index idx. recPtr must implement TextExporter. As with
+// Get(), the export begins with the first record that matches the initial
+// value of the record pointed to by recPtr.
+func (db *DB) ExportCSV(recPtr Record, idx uint8, wr io.Writer) (err error) {
+	cw := csv.NewWriter(wr)
+	err = db.exportText(recPtr, idx, cw.Write)
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return
+}
+
+// ImportFixed reads rows of fixed-width fields from rd and stores them in the
+// database. widths specifies the number of characters in each field; leading
+// and trailing spaces are removed from each field. A field that extends past the end of a
+// line is shortened or left empty. Otherwise, ImportFixed behaves like
+// ImportCSV().
+func (db *DB) ImportFixed(recPtr Record, rd io.Reader, widths []int) error {
+	scanner := bufio.NewScanner(rd)
+	return db.importText(recPtr, func() (fields []string, err error) {
+		if scanner.Scan() {
+			line := scanner.Text()
+			fields = make([]string, len(widths))
+			for j, width := range widths {
+				pos := 0
+				for n := 0; n < width && pos < len(line); n++ {
+					_, size := utf8.DecodeRuneInString(line[pos:])
+					pos += size
+				}
+				fields[j] = strings.TrimSpace(line[:pos])
+				line = line[pos:]
+			}
+		} else {
+			err = scanner.Err()
+			if err == nil {
+				err = io.EOF
+			}
+		}
+		return
+	})
+}
+
+// ExportFixed writes the records of recPtr's type to wr as rows of
+// fixed-width fields. widths specifies the number of characters in each
+// field; fields are padded with spaces or truncated as needed. Fields beyond
+// the length of widths are not written. Otherwise, ExportFixed behaves like
+// ExportCSV().
+func (db *DB) ExportFixed(recPtr Record, idx uint8, wr io.Writer, widths []int) (err error) {
+	bw := bufio.NewWriter(wr)
+	err = db.exportText(recPtr, idx, func(fields []string) (err error) {
+		for j := 0; j < len(widths) && err == nil; j++ {
+			var fld []rune
+			if j < len(fields) {
+				fld = []rune(fields[j])
+			}
+			if len(fld) > widths[j] {
+				fld = fld[:widths[j]]
+			}
+			_, err = fmt.Fprintf(bw, "%-*s", widths[j], string(fld))
+		}
+		if err == nil {
+			err = bw.WriteByte('\n')
+		}
+		return
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package pinion_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example migrates quantity records between text formats. The
+// quantityType record implements the pinion.TextImporter and
+// pinion.TextExporter interfaces.
+func ExampleDB_ExportCSV() {
+	var db *pinion.DB
+	var q quantityType
+	var buf bytes.Buffer
+	var err error
+	db, err = quantityDB("example/text.db", 8, 10)
+	if err == nil {
+		fmt.Println("--- CSV ---")
+		err = db.ExportCSV(&q, idxQuantityVal, os.Stdout)
+		if err == nil {
+			err = db.ImportCSV(&q, strings.NewReader("15,\n1000,\n"))
+		}
+		if err == nil {
+			err = db.ImportFixed(&q, strings.NewReader("    21 legacy\n 12345\n"), []int{6, 10})
+		}
+		if err == nil {
+			fmt.Println("--- Fixed width ---")
+			q = quantityType{}
+			err = db.ExportFixed(&q, idxQuantityID, &buf, []int{6, 24})
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				fmt.Printf("%s|\n", line)
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// --- CSV ---
+	// 8,eight
+	// 9,nine
+	// 10,ten
+	// --- Fixed width ---
+	// 8     eight                   |
+	// 9     nine                    |
+	// 10    ten                     |
+	// 15    fifteen                 |
+	// 21    twenty one              |
+	// 1000  one thousand            |
+	// 12345 twelve thousand three hu|
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"bytes"
+
+	"go.etcd.io/bbolt"
+)
+
+// typeMetaBuckets lists the buckets within the meta bucket that contain a
+// bucket, named after the type, of information about a type's records
+var typeMetaBuckets = []string{sketchBucketName, idxExpiryBucketName, formatBucketName}
+
+// typeMetaKeyed lists the buckets within the meta bucket whose keys begin
+// with the name of a type and a zero byte
+var typeMetaKeyed = []string{checkpointBucketName, recLockBucketName, countBucketName, sizeBucketName}
+
+// typeClear removes the bucket of recPtr's type and the information about its
+// records held in the meta bucket. The records derived from the type's
+// records are retracted first. The registry entry of the type is
+// removed as well if unregister is true.
+func (db *DB) typeClear(tx *bbolt.Tx, recPtr Record, unregister bool) (err error) {
+	nameStr := recPtr.Name()
+	name := []byte(nameStr)
+	if tx.Bucket(name) != nil {
+		if derive := db.deriver(tx, recPtr); derive != nil {
+			var bck bucketGrpType
+			bck, err = bucketGet(recPtr, recPtr.IndexCount(), false, tx)
+			if err == nil {
+				scratch := recPtr.New()
+				err = bck.idxs[0].ForEach(func(k, v []byte) (err error) {
+					v, err = bck.migrate(scratch, k, v)
+					if err == nil {
+						err = scratch.UnmarshalBinary(v)
+					}
+					if err == nil {
+						err = derive(scratch, nil)
+					}
+					return
+				})
+			}
+		}
+		if err == nil {
+			err = tx.DeleteBucket(name)
+		}
+	}
+	meta := tx.Bucket([]byte(metaBucketName))
+	if meta == nil {
+		return
+	}
+	for _, str := range typeMetaBuckets {
+		if bck := meta.Bucket([]byte(str)); bck != nil && err == nil && bck.Bucket(name) != nil {
+			err = bck.DeleteBucket(name)
+		}
+	}
+	prefix := concat(name, []byte{0})
+	for _, str := range typeMetaKeyed {
+		if bck := meta.Bucket([]byte(str)); bck != nil && err == nil {
+			var keys [][]byte
+			c := bck.Cursor()
+			for k, _ := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				keys = append(keys, concat(k))
+			}
+			for j := 0; j < len(keys) && err == nil; j++ {
+				err = bck.Delete(keys[j])
+			}
+		}
+	}
+	if unregister && err == nil {
+		if reg := meta.Bucket([]byte(registryBucketName)); reg != nil {
+			err = reg.Delete(name)
+		}
+	}
+	return
+}
+
+// DeleteType removes every record of recPtr's type along with its indexes,
+// its sequence and the information pinion keeps about the type, such as its
+// registry entry (see RegisterType), sketches, checkpoints and record locks.
+// Afterward the database is as it was before records of the type were first
+// stored. Records derived from the type's records are retracted. Unlike
+// Delete, DeleteType removes the records of a type that implements Immutable;
+// it is meant for administrative tools and tests. Deleting a type that has
+// no stored records is not an error. Only the type of recPtr is used.
+func (db *DB) DeleteType(recPtr Record) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.DeleteType(recPtr)
+	}
+	return db.update(func(tx *bbolt.Tx) error {
+		return db.typeClear(tx, recPtr, true)
+	})
+}
+
+// Truncate removes every record of recPtr's type and its index entries and
+// resets the sequence that supplies Add with IDs, leaving the type empty.
+// The type's registry entry is retained. Otherwise it functions like
+// DeleteType. Only the type of recPtr is used.
+func (db *DB) Truncate(recPtr Record) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.Truncate(recPtr)
+	}
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		err = db.typeClear(tx, recPtr, false)
+		if err == nil {
+			_, err = bucketGet(recPtr, recPtr.IndexCount(), true, tx)
+		}
+		return
+	})
+}
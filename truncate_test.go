@@ -0,0 +1,64 @@
+package pinion_test
+
+import (
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example empties a record type and then removes it altogether.
+func ExampleDB_Truncate() {
+	var db *pinion.DB
+	var err error
+	var n noteType
+	db, err = pinion.Create("example/truncate.db", 0600, pinion.Options{})
+	if err == nil {
+		wdb := db.Wrap()
+		for _, title := range []string{"Groceries", "Call Carol"} {
+			n = noteType{Title: title}
+			wdb.AddRec(&n)
+		}
+		list := func() {
+			var ids []uint32
+			n = noteType{}
+			wdb.Get(&n, 0, func() bool {
+				ids = append(ids, n.ID)
+				return true
+			})
+			fmt.Println(ids)
+		}
+		list()
+		err = wdb.Error()
+		if err == nil {
+			err = db.Truncate(&n)
+		}
+		if err == nil {
+			list()
+			// The sequence starts afresh
+			n = noteType{Title: "Water plants"}
+			wdb.AddRec(&n)
+			list()
+			err = wdb.Error()
+		}
+		if err == nil {
+			err = db.DeleteType(&n)
+		}
+		if err == nil {
+			var ok bool
+			ok, err = db.Exists(&n, 0)
+			fmt.Println("exists", ok)
+		}
+		if err == nil {
+			err = db.DeleteType(&n)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [1 2]
+	// []
+	// [1]
+	// exists false
+}
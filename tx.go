@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// Tx provides record operations that take place within a single transaction.
+// It is passed to the function given to DB.View or DB.Update, and must not be
+// used after that function returns or from more than one goroutine. The
+// operations behave like the DB methods of the same names, except that all
+// of them, including ones that would otherwise be divided into batches, are
+// part of the one transaction, and records of any number of types may be
+// involved. Only the record types stored in the database itself are
+// available; those served by attached databases are not.
+type Tx struct {
+	db *DB
+}
+
+// bind returns a Tx whose operations run in btx.
+func (db *DB) bind(btx *bbolt.Tx) *Tx {
+	return &Tx{db: &DB{opt: db.opt, path: db.path, hdr: db.Header(), tx: btx, blooms: db.blooms}}
+}
+
+// View calls fn with a Tx for a read-only transaction. Every read made with
+// the Tx sees the database as it was when the transaction began. The error
+// returned by fn is returned. Operations on db itself must not be called from
+// fn while it is running; use those of the Tx instead.
+func (db *DB) View(fn func(tx *Tx) error) error {
+	return db.view(func(btx *bbolt.Tx) error {
+		tx := db.bind(btx)
+		defer func() { tx.db.tx = nil }()
+		return fn(tx)
+	})
+}
+
+// Update calls fn with a Tx for a writeable transaction. If fn returns nil,
+// the transaction is committed; otherwise it is rolled back, leaving the
+// database unchanged, and the error is returned. If an operation of the Tx
+// fails, fn should return its error rather than continue, since the operation
+// may have been partly carried out. Operations on db itself must not be
+// called from fn while it is running; use those of the Tx instead.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	return db.update(func(btx *bbolt.Tx) error {
+		tx := db.bind(btx)
+		defer func() { tx.db.tx = nil }()
+		return fn(tx)
+	})
+}
+
+// PutRecs stores the listed records, which may be of different types, with
+// the semantics of PutRec. All of them are stored in a single transaction, so
+// either every record is stored or, if an error occurs, none is. If other
+// databases are attached, the records must all be served by the same one.
+func (db *DB) PutRecs(list ...Record) error {
+	odb := db
+	for j, recPtr := range list {
+		if owner := db.owner(recPtr); j == 0 {
+			odb = owner
+		} else if owner != odb {
+			return fmt.Errorf("records of types %s and %s are stored in different databases",
+				list[0].Name(), recPtr.Name())
+		}
+	}
+	return odb.Update(func(tx *Tx) (err error) {
+		for j := 0; j < len(list) && err == nil; j++ {
+			err = tx.PutRec(list[j])
+		}
+		return
+	})
+}
+
+// Get functions like DB.Get within the transaction.
+func (tx *Tx) Get(recPtr Record, idx uint8, f func() bool) error {
+	return tx.db.Get(recPtr, idx, f)
+}
+
+// GetRec functions like DB.GetRec within the transaction.
+func (tx *Tx) GetRec(recPtr Record, idx uint8) error {
+	return tx.db.GetRec(recPtr, idx)
+}
+
+// Exists functions like DB.Exists within the transaction.
+func (tx *Tx) Exists(recPtr Record, idx uint8) (bool, error) {
+	return tx.db.Exists(recPtr, idx)
+}
+
+// FirstRec functions like DB.FirstRec within the transaction.
+func (tx *Tx) FirstRec(recPtr Record, idx uint8) error {
+	return tx.db.FirstRec(recPtr, idx)
+}
+
+// LastRec functions like DB.LastRec within the transaction.
+func (tx *Tx) LastRec(recPtr Record, idx uint8) error {
+	return tx.db.LastRec(recPtr, idx)
+}
+
+// Put functions like DB.Put within the transaction.
+func (tx *Tx) Put(recPtr Record, f func() bool) error {
+	return tx.db.Put(recPtr, f)
+}
+
+// PutRec functions like DB.PutRec within the transaction.
+func (tx *Tx) PutRec(recPtr Record) error {
+	return tx.db.PutRec(recPtr)
+}
+
+// Add functions like DB.Add within the transaction.
+func (tx *Tx) Add(recPtr Record, f func() bool) error {
+	return tx.db.Add(recPtr, f)
+}
+
+// AddRec functions like DB.AddRec within the transaction.
+func (tx *Tx) AddRec(recPtr Record) error {
+	return tx.db.AddRec(recPtr)
+}
+
+// Delete functions like DB.Delete within the transaction.
+func (tx *Tx) Delete(recPtr Record, f func() bool) error {
+	return tx.db.Delete(recPtr, f)
+}
+
+// DeleteRec functions like DB.DeleteRec within the transaction.
+func (tx *Tx) DeleteRec(recPtr Record) error {
+	return tx.db.DeleteRec(recPtr)
+}
+
+// ForceDelete functions like DB.ForceDelete within the transaction.
+func (tx *Tx) ForceDelete(recPtr Record, f func() bool) error {
+	return tx.db.ForceDelete(recPtr, f)
+}
+
+// DeleteType functions like DB.DeleteType within the transaction.
+func (tx *Tx) DeleteType(recPtr Record) error {
+	return tx.db.DeleteType(recPtr)
+}
+
+// Truncate functions like DB.Truncate within the transaction.
+func (tx *Tx) Truncate(recPtr Record) error {
+	return tx.db.Truncate(recPtr)
+}
+
+// NextGapless functions like DB.NextGapless within the transaction.
+func (tx *Tx) NextGapless(name string) (uint64, error) {
+	return tx.db.NextGapless(name)
+}
@@ -0,0 +1,93 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+)
+
+// This example demonstrates the composition of several operations on records
+// of different types in one transaction.
+func ExampleDB_Update() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/tx.db", 0600, pinion.Options{})
+	if err == nil {
+		err = db.Update(func(tx *pinion.Tx) (err error) {
+			p := personType{name: nameType{first: "Ada", last: "Lovelace"}}
+			err = tx.AddRec(&p)
+			if err == nil {
+				q := quantityRec(uint32(p.id))
+				err = tx.PutRec(&q)
+			}
+			return
+		})
+		if err == nil {
+			errCancel := errors.New("cancelled")
+			err = db.Update(func(tx *pinion.Tx) (err error) {
+				p := personType{name: nameType{first: "Charles", last: "Babbage"}}
+				err = tx.AddRec(&p)
+				if err == nil {
+					err = errCancel
+				}
+				return
+			})
+			if errors.Is(err, errCancel) {
+				err = nil
+			}
+		}
+		if err == nil {
+			err = db.View(func(tx *pinion.Tx) (err error) {
+				p := personType{}
+				err = tx.Get(&p, idxPersonID, func() bool {
+					q := quantityType{id: uint32(p.id)}
+					if tx.GetRec(&q, idxQuantityID) == nil {
+						fmt.Println(p, q)
+					}
+					return true
+				})
+				if err == nil {
+					q := quantityRec(1)
+					err = tx.PutRec(&q)
+				}
+				return
+			})
+			fmt.Println(err)
+			err = nil
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Ada  Lovelace / 1 [          1 : one]
+	// tx not writable
+}
+
+// This example demonstrates storing records of different types together.
+func ExampleDB_PutRecs() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/putrecs.db", 0600, pinion.Options{})
+	if err == nil {
+		p := personType{id: 7, name: nameType{first: "Grace", last: "Hopper"}}
+		q := quantityRec(7)
+		err = db.PutRecs(&p, &q)
+		if err == nil {
+			p, q = personType{id: 7}, quantityType{id: 7}
+			err = db.GetRec(&p, idxPersonID)
+			if err == nil {
+				err = db.GetRec(&q, idxQuantityID)
+			}
+			fmt.Println(p, q)
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// Grace  Hopper / 7 [          7 : seven]
+}
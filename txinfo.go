@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// TxInfo describes the transactions that pinion has open on a database. A
+// read transaction that stays open for a long time, for example because a Get
+// callback is blocked, prevents bbolt from reclaiming pages that have been
+// freed since the transaction began. This is a common cause of unexpected
+// file growth.
+type TxInfo struct {
+	// ReadAges holds the age of each open read transaction, oldest first.
+	// Its length is the number of open read transactions.
+	ReadAges []time.Duration
+	// Writing is true if a write transaction is active.
+	Writing bool
+	// WriteAge is the age of the active write transaction, if any.
+	WriteAge time.Duration
+}
+
+// txRecType describes an open transaction
+type txRecType struct {
+	start time.Time
+	write bool
+}
+
+// txTrackType tracks the open transactions of a database
+type txTrackType struct {
+	mu   sync.Mutex
+	seq  uint64
+	open map[uint64]txRecType
+}
+
+// begin records the start of a transaction and returns its tracking ID.
+func (trk *txTrackType) begin(write bool) (id uint64) {
+	trk.mu.Lock()
+	if trk.open == nil {
+		trk.open = make(map[uint64]txRecType)
+	}
+	trk.seq++
+	id = trk.seq
+	trk.open[id] = txRecType{start: time.Now(), write: write}
+	trk.mu.Unlock()
+	return
+}
+
+// end records the completion of the transaction identified by id.
+func (trk *txTrackType) end(id uint64) {
+	trk.mu.Lock()
+	delete(trk.open, id)
+	trk.mu.Unlock()
+}
+
+// StaleReader describes a read transaction that has been open longer than
+// the threshold specified by Options.StaleReaderThreshold.
+type StaleReader struct {
+	// Age is the time the transaction has been open.
+	Age time.Duration
+	// Stack is the stack trace of the goroutine that began the transaction,
+	// captured when it began.
+	Stack []byte
+}
+
+// stack returns the stack trace of the calling goroutine.
+func stack() []byte {
+	buf := make([]byte, 4096)
+	for {
+		n := runtime.Stack(buf, false)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// staleWatch arranges for the stale reader hook to be called if the read
+// transaction begun by the calling goroutine remains open longer than the
+// configured threshold. The returned function cancels the watch; it must be
+// called when the transaction ends.
+func (db *DB) staleWatch() (cancel func() bool) {
+	start := time.Now()
+	sr := StaleReader{Stack: stack()}
+	hook := db.opt.StaleReaderHook
+	if hook == nil {
+		hook = func(sr StaleReader) {
+			log.Printf("pinion: read transaction open for %s, begun at:\n%s", sr.Age, sr.Stack)
+		}
+	}
+	return time.AfterFunc(db.opt.StaleReaderThreshold, func() {
+		sr.Age = time.Since(start)
+		hook(sr)
+	}).Stop
+}
+
+// CommitInfo describes the commit of a write transaction. It is passed to
+// Options.CommitHook and Options.SlowCommitHook.
+type CommitInfo struct {
+	// Duration is the time taken to commit the transaction, from the end of
+	// the work done within it until the commit completed.
+	Duration time.Duration
+	// Write is the portion of Duration spent writing pages to disk and
+	// syncing the file.
+	Write time.Duration
+	// Pages is the number of pages written.
+	Pages int
+}
+
+// commitWatch arranges for the commit hooks to be called when tx is
+// committed. The returned function marks the end of the work done within the
+// transaction; it must be called before the transaction is committed.
+func (db *DB) commitWatch(tx *bbolt.Tx) (done func()) {
+	var start time.Time
+	tx.OnCommit(func() {
+		st := tx.Stats()
+		info := CommitInfo{Duration: time.Since(start), Write: st.WriteTime, Pages: st.Write}
+		if db.opt.CommitHook != nil {
+			db.opt.CommitHook(info)
+		}
+		if db.opt.SlowCommitThreshold > 0 && info.Duration >= db.opt.SlowCommitThreshold {
+			if db.opt.SlowCommitHook != nil {
+				db.opt.SlowCommitHook(info)
+			} else {
+				log.Printf("pinion: commit took %s (%s writing %d pages)",
+					info.Duration, info.Write, info.Pages)
+			}
+		}
+	})
+	return func() {
+		start = time.Now()
+	}
+}
+
+// tracked returns a transaction function that runs fn while recording the
+// transaction as open.
+func (db *DB) tracked(write bool, fn func(*bbolt.Tx) error) func(*bbolt.Tx) error {
+	return func(tx *bbolt.Tx) error {
+		id := db.txs.begin(write)
+		defer db.txs.end(id)
+		if !write && db.opt.StaleReaderThreshold > 0 {
+			defer db.staleWatch()()
+		}
+		if write && (db.opt.CommitHook != nil || db.opt.SlowCommitThreshold > 0) {
+			defer db.commitWatch(tx)()
+		}
+		err := fn(tx)
+		if err == nil && write && db.opt.BeforeCommit != nil {
+			err = db.opt.BeforeCommit()
+		}
+		return err
+	}
+}
+
+// TxInfo returns information about the transactions that are currently open.
+// Only transactions begun by pinion are included.
+func (db *DB) TxInfo() (info TxInfo) {
+	now := time.Now()
+	db.txs.mu.Lock()
+	for _, rec := range db.txs.open {
+		age := now.Sub(rec.start)
+		if rec.write {
+			info.Writing = true
+			info.WriteAge = age
+		} else {
+			info.ReadAges = append(info.ReadAges, age)
+		}
+	}
+	db.txs.mu.Unlock()
+	sort.Slice(info.ReadAges, func(i, j int) bool {
+		return info.ReadAges[i] > info.ReadAges[j]
+	})
+	return
+}
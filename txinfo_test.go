@@ -0,0 +1,168 @@
+package pinion_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piniondb/pinion"
+)
+
+// Test reporting of open transactions
+func TestDB_TxInfo(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var info pinion.TxInfo
+	db, err = quantityDB("example/txinfo.db", 1, 3)
+	if err == nil {
+		q := quantityType{}
+		err = db.Get(&q, idxQuantityID, func() bool {
+			info = db.TxInfo()
+			return false
+		})
+		if err == nil && (len(info.ReadAges) != 1 || info.Writing) {
+			t.Fatalf("expecting one read transaction, got %v", info)
+		}
+		if err == nil {
+			err = db.Put(&q, func() bool {
+				info = db.TxInfo()
+				return false
+			})
+		}
+		if err == nil && (len(info.ReadAges) != 0 || !info.Writing) {
+			t.Fatalf("expecting write transaction, got %v", info)
+		}
+		info = db.TxInfo()
+		if len(info.ReadAges) != 0 || info.Writing {
+			t.Fatalf("expecting no transactions, got %v", info)
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test reporting of a read transaction that is held open too long
+func TestDB_StaleReader(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var sr pinion.StaleReader
+	ch := make(chan pinion.StaleReader, 1)
+	opt := pinion.Options{StaleReaderThreshold: 10 * time.Millisecond,
+		StaleReaderHook: func(sr pinion.StaleReader) { ch <- sr }}
+	db, err = pinion.Create("example/stale.db", 0600, opt)
+	if err == nil {
+		var q quantityType
+		err = db.PutRec(&q)
+		if err == nil {
+			err = db.GetRec(&q, idxQuantityID)
+			select {
+			case sr = <-ch:
+				t.Fatalf("unexpected stale reader report")
+			default:
+			}
+		}
+		if err == nil {
+			err = db.Get(&q, idxQuantityID, func() bool {
+				sr = <-ch
+				return false
+			})
+		}
+		if err == nil && (sr.Age < 10*time.Millisecond || !strings.Contains(string(sr.Stack), "TestDB_StaleReader")) {
+			t.Fatalf("unexpected stale reader report %s\n%s", sr.Age, sr.Stack)
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test reporting of commit durations
+func TestDB_CommitHook(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var all, slow []pinion.CommitInfo
+	opt := pinion.Options{SlowCommitThreshold: time.Hour,
+		CommitHook:     func(ci pinion.CommitInfo) { all = append(all, ci) },
+		SlowCommitHook: func(ci pinion.CommitInfo) { slow = append(slow, ci) }}
+	db, err = pinion.Create("example/commit.db", 0600, opt)
+	if err == nil {
+		all = all[:0]
+		var q quantityType
+		err = db.PutRec(&q)
+		if err == nil && (len(all) != 1 || len(slow) != 0) {
+			t.Fatalf("expecting one commit and no slow commits, got %d and %d", len(all), len(slow))
+		}
+		if err == nil && (all[0].Pages == 0 || all[0].Write > all[0].Duration) {
+			t.Fatalf("unexpected commit report %+v", all[0])
+		}
+		if err == nil {
+			err = db.GetRec(&q, idxQuantityID)
+		}
+		if err == nil && len(all) != 1 {
+			t.Fatalf("unexpected commit report for read transaction")
+		}
+		db.Close()
+	}
+	if err == nil {
+		opt.SlowCommitThreshold = time.Nanosecond
+		db, err = pinion.Open("example/commit.db", 0600, opt)
+		if err == nil {
+			all, slow = all[:0], slow[:0]
+			q := quantityType{id: 1}
+			err = db.PutRec(&q)
+			if err == nil && (len(all) != 1 || len(slow) != 1 || slow[0] != all[0]) {
+				t.Fatalf("expecting one slow commit, got %d and %d", len(all), len(slow))
+			}
+			db.Close()
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test injection of a commit failure
+func TestDB_BeforeCommit(t *testing.T) {
+	var db *pinion.DB
+	var err error
+	var commits, count int
+	errInjected := errors.New("injected failure")
+	opt := pinion.Options{BatchSize: 10, BeforeCommit: func() error {
+		commits++
+		if commits == 3 {
+			return errInjected
+		}
+		return nil
+	}}
+	db, err = pinion.Create("example/beforecommit.db", 0600, opt)
+	if err == nil {
+		commits = 0
+		var q quantityType
+		id := uint32(0)
+		err = db.Put(&q, func() bool {
+			id++
+			q = quantityRec(id)
+			return id <= 100
+		})
+		if errors.Is(err, errInjected) {
+			q = quantityType{}
+			err = db.Get(&q, idxQuantityID, func() bool {
+				count++
+				return true
+			})
+			if err == nil && count != 20 {
+				t.Fatalf("expecting 20 records from two committed batches, got %d", count)
+			}
+		} else {
+			t.Fatalf("expecting injected failure, got %v", err)
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// stored is the backing method for GetOrAdd and Upsert. It calls absent if no
+// record with the primary key of recPtr is stored, and otherwise calls
+// present with the stored record's data. If either returns true, the record
+// pointed to by recPtr is then stored. All of this takes place in a single
+// transaction.
+func (db *DB) stored(recPtr Record, absent func() bool, present func(data []byte) (bool, error)) error {
+	return db.update(func(tx *bbolt.Tx) (err error) {
+		var primaryKey, data []byte
+		var write bool
+		put := idxPutType{recPtr: recPtr, scratch: recPtr.New(), count: recPtr.IndexCount()}
+		put.bck, err = bucketGet(recPtr, put.count, true, tx)
+		if err == nil {
+			put.bck.derive = db.deriver(tx, recPtr)
+			put.bck.bloom = db.blooms[recPtr.Name()]
+			put.bck.sketch = db.sketched(recPtr)
+			put.bck.oversize = db.oversize(recPtr)
+			primaryKey, err = recPtr.Key(0)
+		}
+		if err == nil {
+			data = put.bck.idxs[0].Get(primaryKey)
+			if data == nil {
+				write = absent()
+			} else {
+				data, err = put.bck.migrate(recPtr, primaryKey, data)
+				if err == nil {
+					write, err = present(data)
+				}
+			}
+		}
+		if err == nil && write {
+			err = put.idxPut()
+		}
+		return
+	})
+}
+
+// GetOrAdd retrieves or, if it does not exist, stores the record identified
+// by the primary key of the record pointed to by recPtr. Only the field or
+// fields that make up the primary key (index 0) need to be assigned. If a
+// record with that key is stored, it is read into recPtr and added is false.
+// Otherwise, init is called to complete the record, which is then stored with
+// the semantics of PutRec, and added is true; NextID is not called since the
+// record is identified by its key. The lookup and the insertion take place in
+// a single transaction, so concurrent calls with the same key store the record
+// only once. init runs within the transaction and must not call methods of
+// db.
+func (db *DB) GetOrAdd(recPtr Record, init func()) (added bool, err error) {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.GetOrAdd(recPtr, init)
+	}
+	err = db.stored(recPtr, func() bool {
+		init()
+		added = true
+		return true
+	}, func(data []byte) (bool, error) {
+		return false, decode(recPtr, data)
+	})
+	if err != nil {
+		added = false
+	}
+	return
+}
+
+// Upsert stores the record pointed to by recPtr with the semantics of PutRec,
+// resolving a conflict with a stored record that has the same primary key by
+// means of merge. If such a record exists, merge is called with a copy of it
+// and is expected to update the record pointed to by recPtr as needed before
+// it is stored, for example by combining counters or keeping the newer of two
+// timestamps. If merge returns an error, nothing is stored and the error is
+// returned. The lookup, merge and store take place in a single transaction.
+// merge runs within the transaction and must not call methods of db.
+func (db *DB) Upsert(recPtr Record, merge func(stored Record) error) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.Upsert(recPtr, merge)
+	}
+	return db.stored(recPtr, func() bool {
+		return true
+	}, func(data []byte) (write bool, err error) {
+		old := recPtr.New()
+		err = decode(old, data)
+		if err == nil {
+			err = merge(old)
+		}
+		return err == nil, err
+	})
+}
+
+// PutRecStrict inserts one record in the database. It functions like PutRec
+// except that, if a record with the same primary key is already stored,
+// nothing is written and an error wrapping ErrDuplicateKey is returned. This
+// suits records such as registrations for which an overwrite indicates an
+// application error. The check and the insertion take place in a single
+// transaction.
+func (db *DB) PutRecStrict(recPtr Record) error {
+	if odb := db.owner(recPtr); odb != db {
+		return odb.PutRecStrict(recPtr)
+	}
+	return db.stored(recPtr, func() bool {
+		return true
+	}, func(data []byte) (bool, error) {
+		return false, fmt.Errorf("%s record: %w", recPtr.Name(), ErrDuplicateKey)
+	})
+}
@@ -0,0 +1,86 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/str"
+)
+
+// This example demonstrates retrieval or insertion of a record in one step,
+// and the merging of a record with a stored one that has the same key.
+func ExampleDB_GetOrAdd() {
+	var db *pinion.DB
+	var err error
+	var added bool
+	db, err = quantityDB("example/getoradd.db", 1, 3)
+	if err == nil {
+		for _, id := range []uint32{2, 4, 4} {
+			q := quantityType{id: id}
+			added, err = db.GetOrAdd(&q, func() {
+				q.val, _ = str.QuantityEncode(uint(id) * 100)
+			})
+			if err == nil {
+				fmt.Println(q, added)
+			}
+		}
+		// Keep the stored value of a record if the new one has none
+		merge := func(q *quantityType) func(pinion.Record) error {
+			return func(stored pinion.Record) error {
+				if len(q.val) == 0 {
+					q.val = stored.(*quantityType).val
+				}
+				return nil
+			}
+		}
+		for _, id := range []uint32{3, 5} {
+			if err == nil {
+				q := quantityType{id: id}
+				err = db.Upsert(&q, merge(&q))
+				if err == nil {
+					q = quantityType{id: id}
+					err = db.GetRec(&q, idxQuantityID)
+					fmt.Println(q)
+				}
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [          2 : two] false
+	// [          4 : four hundred] true
+	// [          4 : four hundred] false
+	// [          3 : three]
+	// [          5 : ]
+}
+
+// This example demonstrates an insertion that fails rather than overwriting a
+// stored record.
+func ExampleDB_PutRecStrict() {
+	var db *pinion.DB
+	var err error
+	db, err = quantityDB("example/strict.db", 1, 3)
+	if err == nil {
+		for _, id := range []uint32{4, 2} {
+			q := quantityType{id: id}
+			q.val, _ = str.QuantityEncode(uint(id) * 1000)
+			err = db.PutRecStrict(&q)
+			fmt.Println(id, errors.Is(err, pinion.ErrDuplicateKey), err)
+		}
+		q := quantityType{id: 2}
+		err = db.GetRec(&q, idxQuantityID)
+		fmt.Println(q)
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 4 false <nil>
+	// 2 true quantity record: duplicate primary key
+	// [          2 : two]
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStaleRevision is reported when a record that implements Versioner is
+// written with a revision other than that of the stored record
+var ErrStaleRevision = errors.New("record revision is stale")
+
+// The Versioner interface may be implemented by a record type to have pinion
+// detect conflicting updates by means of optimistic locking. Each stored
+// record carries a revision number that is part of its value, so it must be
+// included by MarshalBinary and UnmarshalBinary. Whenever a record is written
+// with Put, Add or any other method that stores records, its revision must
+// match that of the stored record, or be zero if no record with its primary
+// key is stored; otherwise an error wrapping ErrStaleRevision is returned and
+// nothing is written. On success, the revision is incremented by means of
+// SetRevision before the record is stored. A record that is read, modified
+// and written back therefore fails if another writer stored it in the
+// meantime, in which case the application can read it again and retry.
+//
+// Note that the incremented revision is assigned even if the transaction is
+// subsequently rolled back. Merge functions passed to Upsert should copy the
+// revision of the stored record.
+type Versioner interface {
+	Revision() uint64
+	SetRevision(rev uint64)
+}
+
+// revise checks the revision of recPtr, if it implements Versioner, against
+// that of the record stored with the same primary key and increments it.
+// scratch is used to decode the stored record.
+func (bck bucketGrpType) revise(recPtr, scratch Record) (err error) {
+	if v, ok := recPtr.(Versioner); ok {
+		var primaryKey []byte
+		var rev uint64
+		primaryKey, err = recPtr.Key(0)
+		if err == nil {
+			if data := bck.idxs[0].Get(primaryKey); data != nil {
+				data, err = bck.migrate(scratch, primaryKey, data)
+				if err == nil {
+					err = scratch.UnmarshalBinary(data)
+				}
+				if err == nil {
+					rev = scratch.(Versioner).Revision()
+				}
+			}
+		}
+		if err == nil {
+			if v.Revision() == rev {
+				v.SetRevision(rev + 1)
+			} else {
+				err = fmt.Errorf("%s record at revision %d, stored revision is %d: %w",
+					recPtr.Name(), v.Revision(), rev, ErrStaleRevision)
+			}
+		}
+	}
+	return
+}
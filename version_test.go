@@ -0,0 +1,111 @@
+package pinion_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/piniondb/pinion"
+	"github.com/piniondb/store"
+)
+
+// revNoteType is a note that is protected against conflicting updates by its
+// revision.
+type revNoteType struct {
+	id   uint32
+	rev  uint64
+	text string
+}
+
+func (n revNoteType) MarshalBinary() ([]byte, error) {
+	var put store.PutBuffer
+	put.Uint32(n.id)
+	put.Uint64(n.rev)
+	put.Str(n.text)
+	return put.Data()
+}
+
+func (n *revNoteType) UnmarshalBinary(data []byte) error {
+	get := store.NewGetBuffer(data)
+	get.Uint32(&n.id)
+	get.Uint64(&n.rev)
+	get.Str(&n.text)
+	return get.Done()
+}
+
+func (n revNoteType) Name() string {
+	return "note"
+}
+
+func (n revNoteType) IndexCount() uint8 {
+	return 1
+}
+
+func (n revNoteType) New() pinion.Record {
+	return new(revNoteType)
+}
+
+func (n *revNoteType) NextID(id uint64) {
+	n.id = uint32(id)
+}
+
+func (n revNoteType) Key(idx uint8) ([]byte, error) {
+	return store.KeyUint32(n.id), nil
+}
+
+// Revision implements the pinion.Versioner interface
+func (n revNoteType) Revision() uint64 {
+	return n.rev
+}
+
+// SetRevision implements the pinion.Versioner interface
+func (n *revNoteType) SetRevision(rev uint64) {
+	n.rev = rev
+}
+
+// This example demonstrates the rejection of an update that is based on an
+// outdated copy of a record.
+func ExampleVersioner() {
+	var db *pinion.DB
+	var err error
+	db, err = pinion.Create("example/version.db", 0600, pinion.Options{})
+	if err == nil {
+		note := revNoteType{text: "draft"}
+		err = db.AddRec(&note)
+		if err == nil {
+			fmt.Println(note.rev, note.text)
+			a := revNoteType{id: note.id}
+			b := revNoteType{id: note.id}
+			err = db.GetRec(&a, 0)
+			if err == nil {
+				err = db.GetRec(&b, 0)
+			}
+			if err == nil {
+				a.text = "reviewed"
+				err = db.PutRec(&a)
+				fmt.Println(a.rev, a.text)
+			}
+			if err == nil {
+				b.text = "rejected"
+				err = db.PutRec(&b)
+				fmt.Println(errors.Is(err, pinion.ErrStaleRevision))
+				fmt.Println(err)
+				err = db.GetRec(&b, 0)
+				if err == nil {
+					b.text = "published"
+					err = db.PutRec(&b)
+					fmt.Println(b.rev, b.text)
+				}
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 1 draft
+	// 2 reviewed
+	// true
+	// note record at revision 1, stored revision is 2: record revision is stale
+	// 3 published
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2016 Kurt Jung (Gmail: piniondb)
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package pinion
+
+import (
+	"go.etcd.io/bbolt"
+)
+
+// OpenView returns a read-only handle to db that shares its open file and
+// memory map. Opening a view costs little more than an allocation; no file is
+// opened and, unlike OpenSnapshot, nothing is copied. This makes it practical
+// to give each request of a service its own handle, for example to pass to
+// code that must not modify the database. Attempts to write through a view
+// fail with bbolt.ErrDatabaseReadOnly. Each read sees the records committed
+// through db at the time it begins. Databases attached to db are not
+// available through the view. Close releases the view without affecting db;
+// once db is closed, its views report ErrNotOpen.
+func (db *DB) OpenView() (view *DB, err error) {
+	if db.bolt() == nil {
+		return nil, ErrNotOpen
+	}
+	view = &DB{viewOf: db, opt: db.opt, path: db.path, hdr: db.Header()}
+	view.opt.BoltOpt.ReadOnly = true
+	return
+}
+
+// Snapshot returns a read-only handle to db that holds a single read
+// transaction open until it is closed. Every read made through the snapshot,
+// with any of the methods of DB, sees the database as it was when Snapshot
+// was called, so a sequence of reads is consistent even while records are
+// being written through db. As with a view, writes fail and attached
+// databases are not available. A snapshot should be used by one goroutine at
+// a time and closed promptly: the transaction it holds prevents bbolt from
+// reusing pages freed after it began, and db cannot be closed until it ends.
+// Moreover, a write that must enlarge bbolt's memory map waits until every
+// open read transaction has ended, so a write made from the goroutine holding
+// a snapshot can deadlock. Setting Options.BoltOpt.InitialMmapSize to exceed
+// the expected size of the file avoids such waits.
+// The transaction is included in the information reported by TxInfo and, if
+// Options.StaleReaderThreshold is set, is reported when held too long.
+func (db *DB) Snapshot() (snap *DB, err error) {
+	var btx *bbolt.Tx
+	bdb, release := db.acquire()
+	defer release()
+	if bdb == nil {
+		return nil, ErrNotOpen
+	}
+	btx, err = bdb.Begin(false)
+	if err == nil {
+		id := db.txs.begin(false)
+		stop := func() bool { return false }
+		if db.opt.StaleReaderThreshold > 0 {
+			stop = db.staleWatch()
+		}
+		snap = &DB{viewOf: db, opt: db.opt, path: db.path, hdr: db.Header(), tx: btx}
+		snap.opt.BoltOpt.ReadOnly = true
+		snap.release = func() {
+			stop()
+			db.txs.end(id)
+			btx.Rollback()
+		}
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package pinion_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/piniondb/pinion"
+	"go.etcd.io/bbolt"
+)
+
+// Test read-only views that share the file of an open database
+func TestDB_OpenView(t *testing.T) {
+	var db, v1, v2 *pinion.DB
+	var err error
+	db, err = quantityDB("example/view.db", 1, 10)
+	if err == nil {
+		v1, err = db.OpenView()
+		if err == nil {
+			v2, err = db.OpenView()
+		}
+		if err == nil {
+			q := quantityType{id: 4}
+			err = v1.GetRec(&q, idxQuantityID)
+			if err == nil && q.String() != quantityRec(4).String() {
+				t.Fatalf("unexpected record %s", q)
+			}
+		}
+		if err == nil {
+			q := quantityRec(11)
+			if putErr := v2.PutRec(&q); !errors.Is(putErr, bbolt.ErrDatabaseReadOnly) {
+				t.Fatalf("expecting ErrDatabaseReadOnly, got %v", putErr)
+			}
+			err = db.PutRec(&q)
+			if err == nil {
+				var found bool
+				found, err = v2.Exists(&q, idxQuantityID)
+				if err == nil && !found {
+					t.Fatalf("record written through database not visible in view")
+				}
+			}
+		}
+		if err == nil {
+			err = v1.Close()
+			if err == nil {
+				q := quantityType{id: 4}
+				if getErr := v1.GetRec(&q, idxQuantityID); !errors.Is(getErr, pinion.ErrNotOpen) {
+					t.Fatalf("expecting ErrNotOpen from closed view, got %v", getErr)
+				}
+				err = db.GetRec(&q, idxQuantityID)
+			}
+		}
+		db.Close()
+		if err == nil {
+			q := quantityType{id: 4}
+			if getErr := v2.GetRec(&q, idxQuantityID); !errors.Is(getErr, pinion.ErrNotOpen) {
+				t.Fatalf("expecting ErrNotOpen after database closed, got %v", getErr)
+			}
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Test reads that share one transaction
+func TestDB_SnapshotTx(t *testing.T) {
+	var db, snap *pinion.DB
+	var err error
+	var count int
+	// A memory map that is large enough from the start lets the database be
+	// written while the snapshot is held
+	db, err = pinion.Create("example/snaptx.db", 0600, pinion.Options{BoltOpt: bbolt.Options{InitialMmapSize: 1 << 22}})
+	if err == nil {
+		id := uint32(0)
+		var q quantityType
+		err = db.Put(&q, func() bool {
+			id++
+			q = quantityRec(id)
+			return id <= 10
+		})
+	}
+	if err == nil {
+		snap, err = db.Snapshot()
+		if err == nil {
+			if info := db.TxInfo(); len(info.ReadAges) != 1 {
+				t.Fatalf("expecting one open read transaction, got %v", info)
+			}
+			q := quantityRec(11)
+			err = db.PutRec(&q)
+			if err == nil {
+				q = quantityType{}
+				err = snap.Get(&q, idxQuantityID, func() bool {
+					count++
+					return true
+				})
+			}
+			if err == nil && count != 10 {
+				t.Fatalf("expecting 10 records in snapshot, got %d", count)
+			}
+			if err == nil {
+				q = quantityType{id: 11}
+				if getErr := snap.GetRec(&q, idxQuantityID); !errors.Is(getErr, pinion.ErrRecNotFound) {
+					t.Fatalf("expecting ErrRecNotFound for record written after snapshot, got %v", getErr)
+				}
+				err = db.GetRec(&q, idxQuantityID)
+			}
+			if err == nil {
+				if putErr := snap.PutRec(&q); putErr == nil {
+					t.Fatalf("expecting error writing through snapshot")
+				}
+				err = snap.Close()
+			}
+			if err == nil {
+				if info := db.TxInfo(); len(info.ReadAges) != 0 {
+					t.Fatalf("expecting no open read transactions, got %v", info)
+				}
+				if getErr := snap.GetRec(&q, idxQuantityID); !errors.Is(getErr, pinion.ErrNotOpen) {
+					t.Fatalf("expecting ErrNotOpen from closed snapshot, got %v", getErr)
+				}
+			}
+		}
+		db.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
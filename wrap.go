@@ -18,6 +18,9 @@ package pinion
 
 import (
 	"io"
+	"sync"
+
+	"github.com/piniondb/store"
 )
 
 // WrapDB is a wrapper around DB that maintains error state internally. Its
@@ -27,14 +30,31 @@ import (
 // simplify code paths by deferring error handling until a series of database
 // operations have completed.
 //
-// Unlike a DB instance, a WrapDB instance is not safe for concurrent use. It
-// is intended to be used locally for a relatively small sequence of method
-// calls and then, after examining the error value returned by Error(), allowed
-// to fall out of scope. Multiple goroutines may wrap a single *pinion.DB
-// instance concurrently.
+// Unlike a DB instance, a WrapDB instance returned by Wrap or WrapBuffered is
+// not safe for concurrent use. It is intended to be used locally for a
+// relatively small sequence of method calls and then, after examining the
+// error value returned by Error(), allowed to fall out of scope. Multiple
+// goroutines may wrap a single *pinion.DB instance concurrently. An instance
+// that must be shared by several goroutines can be obtained with WrapShared.
 type WrapDB struct {
 	hnd *DB
 	err error
+	// mu, if not nil, protects err and buf; it is set for instances returned
+	// by WrapShared
+	mu *sync.Mutex
+	// buffered is set for instances returned by WrapBuffered
+	buffered bool
+	buf      []bufType
+	// collect is set by CollectAll; errs holds every error reported
+	collect bool
+	errs    []error
+}
+
+// bufType holds a record accumulated by a buffered WrapDB
+type bufType struct {
+	proto Record // Used only to obtain the record type
+	data  []byte
+	add   bool
 }
 
 // Wrap returns a wrapped database instance that simplifies error handling.
@@ -44,90 +64,400 @@ func (db *DB) Wrap() (wdb *WrapDB) {
 	return
 }
 
+// WrapShared returns a wrapped database instance like Wrap that is safe for
+// concurrent use by multiple goroutines. Database operations themselves are
+// not serialized; only access to the error state is. The first error reported
+// by any goroutine is retained, and operations begun after it has been
+// recorded are bypassed. Operations already in progress in other goroutines
+// run to completion, so a shared instance is best suited to collecting the
+// outcome of a set of independent operations.
+func (db *DB) WrapShared() (wdb *WrapDB) {
+	wdb = db.Wrap()
+	wdb.mu = new(sync.Mutex)
+	return
+}
+
+// lock acquires the instance's mutex, if it has one.
+func (wdb *WrapDB) lock() {
+	if wdb.mu != nil {
+		wdb.mu.Lock()
+	}
+}
+
+// unlock releases the instance's mutex, if it has one.
+func (wdb *WrapDB) unlock() {
+	if wdb.mu != nil {
+		wdb.mu.Unlock()
+	}
+}
+
+// ok reports whether the instance is free of errors.
+func (wdb *WrapDB) ok() bool {
+	wdb.lock()
+	defer wdb.unlock()
+	return wdb.err == nil || wdb.collect
+}
+
+// set records err unless it is nil or an error has already been recorded.
+func (wdb *WrapDB) set(err error) {
+	if err != nil {
+		wdb.lock()
+		if wdb.err == nil {
+			wdb.err = err
+		}
+		if wdb.collect {
+			wdb.errs = append(wdb.errs, err)
+		}
+		wdb.unlock()
+	}
+}
+
+// result records the error value returned by a database operation. The
+// error state of an instance that is not shared is simply replaced by err; a
+// shared instance retains the first error reported by any goroutine.
+func (wdb *WrapDB) result(err error) {
+	if wdb.mu == nil && !wdb.collect {
+		wdb.err = err
+	} else {
+		wdb.set(err)
+	}
+}
+
+// CollectAll switches the receiver to a mode in which every error is retained
+// rather than only the first, and in which operations are carried out even
+// after an error has been reported. This suits validation passes in which
+// every failure should be reported at once. Error returns the first error and
+// Errors returns all of them. The receiver is returned to permit chaining, for
+// example db.Wrap().CollectAll(). It should be called before the instance is
+// used.
+func (wdb *WrapDB) CollectAll() *WrapDB {
+	wdb.collect = true
+	return wdb
+}
+
+// WrapBuffered returns a wrapped database instance like Wrap except that
+// records passed to PutRec and AddRec are accumulated rather than written
+// immediately. Accumulated records are written in batches of the size used by
+// Put and Add, which is far faster than writing them one transaction at a
+// time. This gives per-record call sites the performance of the feed
+// functions without restructuring. A batch is written when it is full, when
+// Flush or Error is called, and before any other operation is carried out so
+// that the operation sees every preceding write. The application must call
+// Flush or Error when it is done; records that are still accumulated when the
+// wrapper falls out of scope are lost. Because records are stored later, the
+// autoincremented IDs assigned by AddRec are not available to the caller, and
+// errors such as constraint violations are reported when the batch is
+// written. Records that remain accumulated when an error occurs are discarded.
+func (db *DB) WrapBuffered() (wdb *WrapDB) {
+	wdb = db.Wrap()
+	wdb.buffered = true
+	return
+}
+
+// bufPut accumulates a copy of the record pointed to by recPtr.
+func (wdb *WrapDB) bufPut(recPtr Record, add bool) {
+	data, err := recPtr.MarshalBinary()
+	if err == nil {
+		wdb.lock()
+		wdb.buf = append(wdb.buf, bufType{proto: recPtr, data: data, add: add})
+		full := len(wdb.buf) >= wdb.hnd.batchSize()
+		wdb.unlock()
+		if full {
+			wdb.Flush()
+		}
+	} else {
+		wdb.set(err)
+	}
+}
+
+// Flush writes the records accumulated by a buffered instance. Consecutive
+// records of the same type are written together. It does nothing for an
+// instance returned by Wrap.
+func (wdb *WrapDB) Flush() {
+	wdb.lock()
+	buf := wdb.buf
+	wdb.buf = nil
+	wdb.unlock()
+	for len(buf) > 0 && wdb.ok() {
+		j := 1
+		name := buf[0].proto.Name()
+		for j < len(buf) && buf[j].add == buf[0].add && buf[j].proto.Name() == name {
+			j++
+		}
+		run := buf[:j]
+		buf = buf[j:]
+		scratch := run[0].proto.New()
+		var err error
+		k := 0
+		wdb.result(wdb.hnd.recPut(scratch, func() bool {
+			if k < len(run) && err == nil {
+				err = scratch.UnmarshalBinary(run[k].data)
+				k++
+				return err == nil
+			}
+			return false
+		}, run[0].add, nil))
+		wdb.set(err)
+	}
+}
+
 // ErrorSet allows the application to transfer its own error to the wrapped
 // database instance. This may simplify code paths in the application because
 // it allows the response to an error to be handled in one place. WrapDB cannot
 // already be in an error state. If err is nil, it is ignored and will not
 // overwrite the internal error value.
 func (wdb *WrapDB) ErrorSet(err error) {
-	if wdb.err == nil && err != nil {
-		wdb.err = err
-	}
+	wdb.set(err)
 }
 
-// ErrorClear clears the internal error value. The current value before being
-// cleared is returned.
+// ErrorClear clears the internal error value and any errors retained in
+// CollectAll mode. The current value before being cleared is returned.
+// Accumulated records are written first.
 func (wdb *WrapDB) ErrorClear() (err error) {
+	wdb.Flush()
+	wdb.lock()
 	err = wdb.err
 	wdb.err = nil
+	wdb.errs = nil
+	wdb.unlock()
 	return
 }
 
 // Error returns the internal error value. It does not change the internal
-// value.
+// value other than by writing accumulated records.
 func (wdb *WrapDB) Error() error {
+	wdb.Flush()
+	wdb.lock()
+	defer wdb.unlock()
 	return wdb.err
 }
 
+// Errors returns every error reported to an instance in CollectAll mode, in
+// the order in which they occurred. Accumulated records are written first. For
+// an instance that is not in CollectAll mode, the result holds at most the
+// internal error value.
+func (wdb *WrapDB) Errors() (list []error) {
+	wdb.Flush()
+	wdb.lock()
+	defer wdb.unlock()
+	if wdb.collect {
+		list = append(list, wdb.errs...)
+	} else if wdb.err != nil {
+		list = []error{wdb.err}
+	}
+	return
+}
+
 // Get is the locally-wrapped version of *DB.Get().
 func (wdb *WrapDB) Get(recPtr Record, idx uint8, f func() bool) {
-	if wdb.err == nil {
-		wdb.err = wdb.hnd.Get(recPtr, idx, f)
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.Get(recPtr, idx, f))
 	}
 }
 
 // GetRec is the locally-wrapped version of *DB.GetRec().
 func (wdb *WrapDB) GetRec(recPtr Record, idx uint8) {
-	if wdb.err == nil {
-		wdb.err = wdb.hnd.GetRec(recPtr, idx)
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.GetRec(recPtr, idx))
+	}
+}
+
+// FirstRec is the locally-wrapped version of *DB.FirstRec().
+func (wdb *WrapDB) FirstRec(recPtr Record, idx uint8) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.FirstRec(recPtr, idx))
+	}
+}
+
+// LastRec is the locally-wrapped version of *DB.LastRec().
+func (wdb *WrapDB) LastRec(recPtr Record, idx uint8) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.LastRec(recPtr, idx))
 	}
 }
 
+// NextRec is the locally-wrapped version of *DB.NextRec().
+func (wdb *WrapDB) NextRec(recPtr Record, idx uint8) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.NextRec(recPtr, idx))
+	}
+}
+
+// PrevRec is the locally-wrapped version of *DB.PrevRec().
+func (wdb *WrapDB) PrevRec(recPtr Record, idx uint8) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.PrevRec(recPtr, idx))
+	}
+}
+
+// GetRange is the locally-wrapped version of *DB.GetRange().
+func (wdb *WrapDB) GetRange(loPtr, hiPtr Record, idx uint8, f func() bool) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.GetRange(loPtr, hiPtr, idx, f))
+	}
+}
+
+// GetPrefix is the locally-wrapped version of *DB.GetPrefix().
+func (wdb *WrapDB) GetPrefix(recPtr Record, idx uint8, prefixLen int, f func() bool) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.GetPrefix(recPtr, idx, prefixLen, f))
+	}
+}
+
+// GetWhere is the locally-wrapped version of *DB.GetWhere().
+func (wdb *WrapDB) GetWhere(recPtr Record, idx uint8, keep func(key []byte) bool, f func() bool) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.GetWhere(recPtr, idx, keep, f))
+	}
+}
+
+// GetKeys is the locally-wrapped version of *DB.GetKeys().
+func (wdb *WrapDB) GetKeys(recPtr Record, idx uint8, f func(key, primaryKey []byte) bool) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.GetKeys(recPtr, idx, f))
+	}
+}
+
+// GetKeyRange is the locally-wrapped version of *DB.GetKeyRange().
+func (wdb *WrapDB) GetKeyRange(recPtr Record, idx uint8, lo, hi []byte, f func() bool) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.GetKeyRange(recPtr, idx, lo, hi, f))
+	}
+}
+
+// GetMatch is the locally-wrapped version of *DB.GetMatch().
+func (wdb *WrapDB) GetMatch(recPtr Record, idx uint8, bound func(kb *store.KeyBuffer), f func() bool) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.GetMatch(recPtr, idx, bound, f))
+	}
+}
+
+// GetPage is the locally-wrapped version of *DB.GetPage(). It returns an
+// empty token if the wrapper is in an error state.
+func (wdb *WrapDB) GetPage(recPtr Record, idx uint8, token string, f func() bool) (next string) {
+	wdb.Flush()
+	if wdb.ok() {
+		var err error
+		next, err = wdb.hnd.GetPage(recPtr, idx, token, f)
+		wdb.result(err)
+	}
+	return
+}
+
+// Exists is the locally-wrapped version of *DB.Exists(). It returns false if
+// the wrapper is in an error state.
+func (wdb *WrapDB) Exists(recPtr Record, idx uint8) (found bool) {
+	wdb.Flush()
+	if wdb.ok() {
+		var err error
+		found, err = wdb.hnd.Exists(recPtr, idx)
+		wdb.result(err)
+	}
+	return
+}
+
 // Delete is the locally-wrapped version of *DB.Delete().
 func (wdb *WrapDB) Delete(recPtr Record, f func() bool) {
-	if wdb.err == nil {
-		wdb.err = wdb.hnd.Delete(recPtr, f)
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.Delete(recPtr, f))
 	}
 }
 
 // DeleteRec is the locally-wrapped version of *DB.DeleteRec().
 func (wdb *WrapDB) DeleteRec(recPtr Record) {
-	if wdb.err == nil {
-		wdb.err = wdb.hnd.DeleteRec(recPtr)
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.DeleteRec(recPtr))
 	}
 }
 
 // Put is the locally-wrapped version of *DB.Put().
 func (wdb *WrapDB) Put(recPtr Record, f func() bool) {
-	if wdb.err == nil {
-		wdb.err = wdb.hnd.Put(recPtr, f)
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.Put(recPtr, f))
 	}
 }
 
 // PutRec is the locally-wrapped version of *DB.PutRec().
 func (wdb *WrapDB) PutRec(recPtr Record) {
-	if wdb.err == nil {
-		wdb.err = wdb.hnd.PutRec(recPtr)
+	if wdb.ok() {
+		if wdb.buffered {
+			wdb.bufPut(recPtr, false)
+		} else {
+			wdb.result(wdb.hnd.PutRec(recPtr))
+		}
+	}
+}
+
+// PutRecs is the locally-wrapped version of *DB.PutRecs().
+func (wdb *WrapDB) PutRecs(list ...Record) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.PutRecs(list...))
+	}
+}
+
+// PutRecStrict is the locally-wrapped version of *DB.PutRecStrict().
+func (wdb *WrapDB) PutRecStrict(recPtr Record) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.PutRecStrict(recPtr))
+	}
+}
+
+// View is the locally-wrapped version of *DB.View().
+func (wdb *WrapDB) View(fn func(tx *Tx) error) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.View(fn))
+	}
+}
+
+// Update is the locally-wrapped version of *DB.Update().
+func (wdb *WrapDB) Update(fn func(tx *Tx) error) {
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.Update(fn))
 	}
 }
 
 // Add is the locally-wrapped version of *DB.Add().
 func (wdb *WrapDB) Add(recPtr Record, f func() bool) {
-	if wdb.err == nil {
-		wdb.err = wdb.hnd.Add(recPtr, f)
+	wdb.Flush()
+	if wdb.ok() {
+		wdb.result(wdb.hnd.Add(recPtr, f))
 	}
 }
 
 // AddRec is the locally-wrapped version of *DB.AddRec().
 func (wdb *WrapDB) AddRec(recPtr Record) {
-	if wdb.err == nil {
-		wdb.err = wdb.hnd.AddRec(recPtr)
+	if wdb.ok() {
+		if wdb.buffered {
+			wdb.bufPut(recPtr, true)
+		} else {
+			wdb.result(wdb.hnd.AddRec(recPtr))
+		}
 	}
 }
 
 // HexDump is the locally-wrapped version of *DB.HexDump().
 func (wdb *WrapDB) HexDump(wr io.Writer) {
-	if wdb.err == nil {
+	wdb.Flush()
+	if wdb.ok() {
 		wdb.hnd.HexDump(wr)
 	}
 }